@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -15,6 +16,7 @@ import (
 
 	"markly-backend/internal/config"
 	"markly-backend/internal/database"
+	"markly-backend/internal/loaders"
 	securitymw "markly-backend/internal/middleware"
 	"markly-backend/graph"
 )
@@ -23,6 +25,18 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Schema migrations: main migrate up|down [N]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+	if cfg.UsesPlaceholderJWTSecret() {
+		log.Println("Warning: using a sample JWT secret; set JWT_SECRET before deploying")
+	}
+
 	// Connect to database
 	db, err := database.Connect(&cfg.Database)
 	if err != nil {
@@ -30,6 +44,10 @@ func main() {
 	}
 	database.SetDB(db)
 
+	if err := migrateOnStart(db, &cfg.Database); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
 	// Create images directory if it doesn't exist
 	imagesDir := "/tmp/markly/images"
 	if err := os.MkdirAll(imagesDir, 0755); err != nil {
@@ -37,6 +55,27 @@ func main() {
 		imagesDir = "/tmp" // Fallback to tmp directory
 	}
 
+	// Resolver and the services it owns
+	resolver, err := graph.NewResolver(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize services:", err)
+	}
+
+	// Fill in the canonical URLs of bookmarks saved before they were tracked
+	if err := resolver.DuplicateService.NormalizeURLs(context.Background()); err != nil {
+		log.Printf("Warning: Failed to normalize bookmark URLs: %v", err)
+	}
+
+	// Purge deleted accounts once their grace period ends
+	go resolver.AccountService.RunPurger(context.Background(), time.Hour)
+	// Purge bookmarks and collections that have been in the trash too long
+	go resolver.TrashService.RunPurger(context.Background(), time.Hour)
+
+	trustedProxies, err := securitymw.ParseTrustedProxies(cfg.Security.TrustedProxies)
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+
 	// Initialize router
 	r := chi.NewRouter()
 
@@ -48,7 +87,7 @@ func main() {
 	
 	// Standard Middleware
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(securitymw.ClientIP(trustedProxies))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
@@ -72,7 +111,7 @@ func main() {
 	}).Handler)
 	
 	// Authentication Middleware
-	r.Use(securitymw.AuthMiddleware(&cfg.JWT))
+	r.Use(securitymw.AuthMiddleware(resolver.TokenService, resolver.RefreshTokenService, resolver.RefreshTokenService, resolver.APITokenService))
 
 	// Static file serving for images
 	fileServer := http.FileServer(http.Dir(imagesDir))
@@ -85,15 +124,28 @@ func main() {
 	})
 
 	// GraphQL server
-	resolver := graph.NewResolver()
 	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AroundFields(securitymw.AuthRateLimiter(
+		"login", "register", "requestPasswordReset", "resetPassword", "verifyEmail", "resendVerification",
+		"verifyTotp", "confirmTotp", "disableTotp", "changePassword", "changeEmail", "deleteAccount",
+	))
 	
 	// GraphQL endpoints with additional rate limiting
 	r.Route("/graphql", func(r chi.Router) {
 		r.Use(securitymw.GraphQLRateLimiter())
+		r.Use(loaders.Middleware(db))
 		r.Handle("/", srv)
 	})
 	
+	// Bookmark export downloads
+	r.Get("/export", resolver.ExportService.ServeHTTP)
+
+	// OpenID Connect single sign-on
+	if resolver.OIDCService != nil {
+		r.Get("/auth/oidc/login", resolver.OIDCService.Login)
+		r.Get("/auth/oidc/callback", resolver.OIDCService.Callback)
+	}
+
 	// Disable GraphQL playground in production
 	if os.Getenv("ENVIRONMENT") != "production" {
 		r.Handle("/", playground.Handler("GraphQL playground", "/graphql"))
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/config"
+	"markly-backend/internal/database"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert the last N applied migrations (default 1)
+  status      list migrations and whether they are applied`
+
+// runMigrate implements the migrate subcommand and returns the exit code
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+	case "down":
+		if len(args) > 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of migrations to revert: %q\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := database.Connect(&cfg.Database)
+	if err != nil {
+		log.Printf("Failed to connect to database: %v", err)
+		return 1
+	}
+	migrator, err := newMigrator(db, &cfg.Database)
+	if err != nil {
+		log.Printf("Failed to load migrations: %v", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Printf("Migration failed: %v", err)
+			return 1
+		}
+		log.Printf("Applied %d migration(s)", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Printf("Migration failed: %v", err)
+			return 1
+		}
+		log.Printf("Reverted %d migration(s)", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Printf("Failed to read migration status: %v", err)
+			return 1
+		}
+		printMigrationStatus(statuses)
+	}
+	return 0
+}
+
+func printMigrationStatus(statuses []database.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Dirty:
+			state = "dirty"
+		case status.Applied && status.AppliedAt != nil:
+			state = "applied " + status.AppliedAt.Format(time.RFC3339)
+		case status.Applied:
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, state)
+	}
+	w.Flush()
+}
+
+// migrateOnStart brings the schema up to date before the server starts, or
+// checks that it already is when MIGRATE_ON_START is off
+func migrateOnStart(db *gorm.DB, cfg *config.DatabaseConfig) error {
+	migrator, err := newMigrator(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if cfg.MigrateOnStart {
+		_, err := migrator.Up(ctx)
+		return err
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migration(s) pending; run \"migrate up\" first", pending)
+	}
+	return nil
+}
+
+func newMigrator(db *gorm.DB, cfg *config.DatabaseConfig) (*database.Migrator, error) {
+	lockTimeout, err := time.ParseDuration(cfg.MigrationLockTimeout)
+	if err != nil {
+		log.Printf("Invalid MIGRATION_LOCK_TIMEOUT %q, using default: %v", cfg.MigrationLockTimeout, err)
+		lockTimeout = time.Minute
+	}
+	return database.NewMigrator(db, lockTimeout)
+}
@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+const testImportFile = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<DL><p>
+<DT><A HREF="https://example.com/">Example</A>
+</DL><p>`
+
+func TestRequireVerifiedEmailGatesImportsAndTokens(t *testing.T) {
+	gated := map[string]func(r *mutationResolver, userID uint) error{
+		"importBookmarks": func(r *mutationResolver, userID uint) error {
+			file := graphql.Upload{File: strings.NewReader(testImportFile), Size: int64(len(testImportFile))}
+			_, err := r.ImportBookmarks(userContext(userID), file, model.ImportFormatNetscapeHTML)
+			return err
+		},
+		"createApiToken": func(r *mutationResolver, userID uint) error {
+			input := model.CreateAPITokenInput{Name: "script", Scopes: []string{"bookmarks:read"}}
+			_, err := r.CreateAPIToken(userContext(userID), input)
+			return err
+		},
+	}
+
+	for name, mutate := range gated {
+		t.Run(name, func(t *testing.T) {
+			resolver := newTestResolver(t)
+			resolver.RequireEmailVerification = true
+			r := &mutationResolver{resolver}
+			user := testdb.CreateUser(t, resolver.DB, "alice")
+
+			if err := mutate(r, user.ID); errorCode(err) != "EMAIL_NOT_VERIFIED" {
+				t.Fatalf("unverified user: got %v, want EMAIL_NOT_VERIFIED", err)
+			}
+
+			if err := resolver.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("email_verified", true).Error; err != nil {
+				t.Fatalf("verify user: %v", err)
+			}
+			if err := mutate(r, user.ID); err != nil {
+				t.Fatalf("verified user: %v", err)
+			}
+		})
+	}
+}
+
+func TestRequireVerifiedEmailDisabled(t *testing.T) {
+	resolver := newTestResolver(t)
+	user := testdb.CreateUser(t, resolver.DB, "alice")
+
+	if err := resolver.requireVerifiedEmail(userContext(user.ID), user.ID); err != nil {
+		t.Fatalf("verification not required: got %v", err)
+	}
+}
+
+func TestRequireVerifiedEmailLeavesEditsOpen(t *testing.T) {
+	resolver := newTestResolver(t)
+	resolver.RequireEmailVerification = true
+	r := &mutationResolver{resolver}
+	user := testdb.CreateUser(t, resolver.DB, "alice")
+
+	description, color := "", "#3b82f6"
+	input := model.CreateCollectionInput{Name: "Reading", Description: &description, Color: &color}
+	if _, err := r.CreateCollection(userContext(user.ID), input); err != nil {
+		t.Fatalf("createCollection by an unverified user: %v", err)
+	}
+}
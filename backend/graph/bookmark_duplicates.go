@@ -0,0 +1,61 @@
+package graph
+
+import (
+	"strconv"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"gorm.io/gorm"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/utils"
+)
+
+// normalizeBookmarkURL sets the canonical URL that bookmark is compared with
+// other bookmarks by
+func (r *Resolver) normalizeBookmarkURL(bookmark *models.Bookmark) error {
+	if err := r.DuplicateService.Normalize(bookmark); err != nil {
+		return utils.ValidationError{Field: "url", Message: "Invalid URL format"}
+	}
+	return nil
+}
+
+// rejectDuplicateURL fails with a DUPLICATE_BOOKMARK error if the user
+// already has another bookmark for bookmark's canonical URL
+func (r *Resolver) rejectDuplicateURL(tx *gorm.DB, bookmark *models.Bookmark) error {
+	duplicate, err := r.DuplicateService.FindDuplicate(tx, bookmark.UserID, *bookmark.NormalizedURL, bookmark.ID)
+	if err != nil {
+		return err
+	}
+	if duplicate == nil {
+		return nil
+	}
+	return &gqlerror.Error{
+		Message: "URL is already bookmarked",
+		Extensions: map[string]interface{}{
+			"code":       "DUPLICATE_BOOKMARK",
+			"bookmarkId": strconv.FormatUint(uint64(duplicate.ID), 10),
+		},
+	}
+}
+
+// saveBookmarkURL runs save, which stores bookmark, and reports a duplicate
+// instead of the unique index violation when another request stored the same
+// URL in the meantime
+func (r *Resolver) saveBookmarkURL(bookmark *models.Bookmark, save func(tx *gorm.DB) error) error {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := r.rejectDuplicateURL(tx, bookmark); err != nil {
+			return err
+		}
+		return save(tx)
+	})
+	if err == nil {
+		return nil
+	}
+	if _, duplicate := err.(*gqlerror.Error); duplicate {
+		return err
+	}
+	if dupErr := r.rejectDuplicateURL(r.DB, bookmark); dupErr != nil {
+		return dupErr
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/database"
+	"markly-backend/internal/models"
+	"markly-backend/internal/search"
+)
+
+// applyBookmarkFilter narrows a bookmark query to the given filter. It is
+// shared by every resolver that lists bookmarks so they all agree on what a
+// filter matches.
+func applyBookmarkFilter(query *gorm.DB, filter *model.BookmarkFilter) (*gorm.DB, error) {
+	if filter == nil {
+		return query, nil
+	}
+
+	dialect := database.DialectOf(query)
+	if filter.Search != nil {
+		q, err := search.Parse(*filter.Search)
+		if err != nil {
+			return nil, err
+		}
+		query = q.Apply(query)
+	}
+	if filter.CollectionID != nil {
+		collectionID, err := strconv.ParseUint(*filter.CollectionID, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid collection ID")
+		}
+		if filter.IncludeDescendants != nil && *filter.IncludeDescendants {
+			query = query.Where("collection_id IN ("+collectionSubtree+")", collectionID)
+		} else {
+			query = query.Where("collection_id = ?", collectionID)
+		}
+	}
+	if len(filter.Tags) > 0 {
+		// Search for bookmarks that contain all of the specified tags
+		for _, tag := range filter.Tags {
+			query = query.Where(dialect.JSONArrayContains("tags", tag))
+		}
+	}
+
+	// The date range and domain narrow the query as the after:, before: and
+	// site: search operators do
+	var narrow search.Query
+	if filter.CreatedAfter != nil {
+		after, err := time.Parse(time.RFC3339, *filter.CreatedAfter)
+		if err != nil {
+			return nil, errors.New("invalid createdAfter timestamp")
+		}
+		narrow.After = &after
+	}
+	if filter.CreatedBefore != nil {
+		before, err := time.Parse(time.RFC3339, *filter.CreatedBefore)
+		if err != nil {
+			return nil, errors.New("invalid createdBefore timestamp")
+		}
+		narrow.Before = &before
+	}
+	if filter.Domain != nil {
+		if host := search.SiteHost(*filter.Domain); host != "" {
+			narrow.Sites = []string{host}
+		}
+	}
+
+	return narrow.Apply(query), nil
+}
+
+// listBookmarks returns the page of userID's bookmarks matching filter. It
+// backs Query.bookmarks and SmartCollection.bookmarks.
+func listBookmarks(db *gorm.DB, userID uint, filter *model.BookmarkFilter, limit *int, offset *int) ([]*model.Bookmark, error) {
+	// Build query
+	query, err := applyBookmarkFilter(db.Where("user_id = ?", userID), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply pagination
+	if limit != nil {
+		query = query.Limit(*limit)
+	}
+	if offset != nil {
+		query = query.Offset(*offset)
+	}
+
+	// Find bookmarks
+	var bookmarks []models.Bookmark
+	if err := query.Find(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+
+	// Convert to GraphQL models
+	result := make([]*model.Bookmark, 0, len(bookmarks))
+	for i := range bookmarks {
+		result = append(result, toGraphQLBookmark(&bookmarks[i]))
+	}
+	return result, nil
+}
@@ -0,0 +1,203 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+	"markly-backend/internal/netscape"
+	"markly-backend/internal/utils"
+)
+
+const (
+	// importFallbackCollection receives bookmarks that sit outside any folder
+	importFallbackCollection = "Imported Bookmarks"
+	maxImportEntries         = 10000
+	maxImportFileSize        = 10 << 20
+	maxCollectionNameLength  = 50
+	maxImportTags            = 20
+)
+
+// importCollectionKey identifies a collection by its name among the children
+// of its parent. parentID is zero for top-level collections.
+type importCollectionKey struct {
+	parentID uint
+	name     string
+}
+
+// importBookmarks stores parsed bookmarks for userID in a single transaction,
+// creating a nested collection for each folder that does not exist yet. Entries that
+// fail validation or whose URL is already bookmarked, compared in canonical form,
+// are reported rather than aborting the import.
+func (r *mutationResolver) importBookmarks(ctx context.Context, userID uint, entries []netscape.Bookmark) (*model.ImportReport, error) {
+	if len(entries) > maxImportEntries {
+		return nil, fmt.Errorf("import contains too many bookmarks (maximum %d)", maxImportEntries)
+	}
+
+	report := &model.ImportReport{
+		Entries: make([]*model.ImportEntryResult, 0, len(entries)),
+	}
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var collections []models.Collection
+		if err := tx.Where("user_id = ?", userID).Order("id").Find(&collections).Error; err != nil {
+			return err
+		}
+		collectionIDs := make(map[importCollectionKey]uint, len(collections))
+		for _, collection := range collections {
+			key := importCollectionKey{name: collection.Name}
+			if collection.ParentID != nil {
+				key.parentID = *collection.ParentID
+			}
+			if _, exists := collectionIDs[key]; !exists {
+				collectionIDs[key] = collection.ID
+			}
+		}
+
+		var existingURLs []string
+		if err := tx.Model(&models.Bookmark{}).Where("user_id = ? AND normalized_url IS NOT NULL", userID).
+			Pluck("normalized_url", &existingURLs).Error; err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(existingURLs)+len(entries))
+		for _, url := range existingURLs {
+			seen[url] = true
+		}
+
+		for _, entry := range entries {
+			result := &model.ImportEntryResult{Title: entry.Title, URL: entry.URL}
+			report.Entries = append(report.Entries, result)
+
+			title := entry.Title
+			if strings.TrimSpace(title) == "" {
+				title = entry.URL
+			}
+			if err := utils.ValidateURL(entry.URL); err != nil {
+				rejectImportEntry(report, result, err.Error())
+				continue
+			}
+			if err := utils.ValidateTitle(title); err != nil {
+				rejectImportEntry(report, result, err.Error())
+				continue
+			}
+
+			bookmark := models.Bookmark{URL: strings.TrimSpace(entry.URL), UserID: userID}
+			if err := r.normalizeBookmarkURL(&bookmark); err != nil {
+				rejectImportEntry(report, result, err.Error())
+				continue
+			}
+			if seen[*bookmark.NormalizedURL] {
+				result.Status = model.ImportEntryStatusSkippedDuplicate
+				reason := "URL is already bookmarked"
+				result.Reason = &reason
+				report.Skipped++
+				continue
+			}
+
+			path := importCollectionPath(entry.Folders)
+			name := strings.Join(path, " / ")
+			result.Collection = &name
+			var collectionID uint
+			for _, folder := range path {
+				key := importCollectionKey{parentID: collectionID, name: folder}
+				id, exists := collectionIDs[key]
+				if !exists {
+					collection := models.Collection{Name: folder, UserID: userID}
+					if collectionID != 0 {
+						parentID := collectionID
+						collection.ParentID = &parentID
+					}
+					if err := tx.Create(&collection).Error; err != nil {
+						return err
+					}
+					id = collection.ID
+					collectionIDs[key] = id
+					report.CollectionsCreated++
+				}
+				collectionID = id
+			}
+
+			bookmark.Title = utils.SanitizeString(title)
+			bookmark.Tags = importTags(entry.Tags)
+			bookmark.CollectionID = collectionID
+			bookmark.CreatedAt = entry.AddDate
+			bookmark.UpdatedAt = entry.LastModified
+			if entry.Description != "" {
+				description := utils.SanitizeString(truncateRunes(entry.Description, 1000))
+				bookmark.Description = &description
+			}
+			if bookmark.UpdatedAt.IsZero() {
+				bookmark.UpdatedAt = bookmark.CreatedAt
+			}
+
+			if err := tx.Create(&bookmark).Error; err != nil {
+				return err
+			}
+			if err := r.TagService.LinkTags(tx, &bookmark); err != nil {
+				return err
+			}
+			seen[*bookmark.NormalizedURL] = true
+
+			result.Status = model.ImportEntryStatusCreated
+			result.Bookmark = toGraphQLBookmark(&bookmark)
+			report.Created++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func rejectImportEntry(report *model.ImportReport, result *model.ImportEntryResult, reason string) {
+	result.Status = model.ImportEntryStatusRejected
+	result.Reason = &reason
+	report.Rejected++
+}
+
+// importCollectionPath maps a folder path to the names of the nested
+// collections its bookmarks are stored in, outermost first. Folders whose
+// name is not a valid collection name are left out of the path.
+func importCollectionPath(folders []string) []string {
+	var path []string
+	for _, folder := range folders {
+		name := utils.SanitizeString(truncateRunes(strings.TrimSpace(folder), maxCollectionNameLength))
+		if utils.ValidateCollectionName(name) == nil {
+			path = append(path, name)
+		}
+	}
+	if len(path) == 0 {
+		return []string{importFallbackCollection}
+	}
+	return path
+}
+
+// importTags normalizes the tags of an imported bookmark, dropping any that
+// would not pass validation instead of rejecting the whole entry.
+func importTags(tags []string) []string {
+	var valid []string
+	for _, tag := range utils.SanitizeTags(tags) {
+		if utils.ValidateTags([]string{tag}) == nil {
+			valid = append(valid, tag)
+		}
+		if len(valid) == maxImportTags {
+			break
+		}
+	}
+	return valid
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+const importFile = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<DL><p>
+<DT><H3>Work</H3>
+<DL><p>
+    <DT><H3>Reading</H3>
+    <DL><p>
+        <DT><A HREF="https://go.dev/doc/" ADD_DATE="1700000000" TAGS="go,docs">Go docs</A>
+        <DD>The Go documentation
+    </DL><p>
+    <DT><A HREF="https://example.com/known?utm_source=newsletter">Already saved</A>
+</DL><p>
+<DT><A HREF="https://Go.Dev/doc?utm_medium=feed">Go docs again</A>
+<DT><A>No link</A>
+<DT><A HREF="https://example.com/loose">Loose &amp; easy</A>
+</DL><p>`
+
+func importBookmarkFile(t *testing.T, r *mutationResolver, userID uint, file string) *model.ImportReport {
+	t.Helper()
+
+	upload := graphql.Upload{File: strings.NewReader(file), Size: int64(len(file))}
+	report, err := r.ImportBookmarks(userContext(userID), upload, model.ImportFormatNetscapeHTML)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return report
+}
+
+func TestImportBookmarksReport(t *testing.T) {
+	resolver := newTestResolver(t)
+	r := &mutationResolver{resolver}
+	user := testdb.CreateUser(t, resolver.DB, "alice")
+
+	work := testdb.CreateCollection(t, resolver.DB, user.ID, "Work", 0)
+	known := testdb.CreateBookmark(t, resolver.DB, user.ID, work.ID, "https://example.com/known")
+	if err := resolver.normalizeBookmarkURL(known); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if err := resolver.DB.Save(known).Error; err != nil {
+		t.Fatalf("save bookmark: %v", err)
+	}
+
+	report := importBookmarkFile(t, r, user.ID, importFile)
+
+	if report.Created != 2 || report.Skipped != 2 || report.Rejected != 1 {
+		t.Errorf("created %d, skipped %d, rejected %d; want 2, 2, 1", report.Created, report.Skipped, report.Rejected)
+	}
+	// Work already exists, so only Reading and the fallback collection are new
+	if report.CollectionsCreated != 2 {
+		t.Errorf("collectionsCreated = %d, want 2", report.CollectionsCreated)
+	}
+
+	wantStatus := []model.ImportEntryStatus{
+		model.ImportEntryStatusCreated,
+		model.ImportEntryStatusSkippedDuplicate,
+		model.ImportEntryStatusSkippedDuplicate,
+		model.ImportEntryStatusRejected,
+		model.ImportEntryStatusCreated,
+	}
+	if len(report.Entries) != len(wantStatus) {
+		t.Fatalf("got %d entries, want %d", len(report.Entries), len(wantStatus))
+	}
+	for i, entry := range report.Entries {
+		if entry.Status != wantStatus[i] {
+			t.Errorf("entry %d (%s): status %s, want %s", i, entry.Title, entry.Status, wantStatus[i])
+		}
+		if entry.Status != model.ImportEntryStatusCreated && entry.Reason == nil {
+			t.Errorf("entry %d (%s): no reason given", i, entry.Title)
+		}
+	}
+
+	goDocs := report.Entries[0]
+	if goDocs.Collection == nil || *goDocs.Collection != "Work / Reading" {
+		t.Errorf("collection = %v, want Work / Reading", goDocs.Collection)
+	}
+	if loose := report.Entries[4]; loose.Collection == nil || *loose.Collection != importFallbackCollection {
+		t.Errorf("collection = %v, want %s", loose.Collection, importFallbackCollection)
+	}
+
+	var stored models.Bookmark
+	if err := resolver.DB.Where("user_id = ? AND url = ?", user.ID, "https://go.dev/doc/").First(&stored).Error; err != nil {
+		t.Fatalf("load imported bookmark: %v", err)
+	}
+	if stored.NormalizedURL == nil || *stored.NormalizedURL != "https://go.dev/doc" {
+		t.Errorf("normalized_url = %v, want https://go.dev/doc", stored.NormalizedURL)
+	}
+	if !stored.CreatedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("created_at = %v, want the ADD_DATE", stored.CreatedAt)
+	}
+	if stored.Description == nil || *stored.Description != "The Go documentation" {
+		t.Errorf("description = %v", stored.Description)
+	}
+	var reading models.Collection
+	if err := resolver.DB.First(&reading, stored.CollectionID).Error; err != nil {
+		t.Fatalf("load collection: %v", err)
+	}
+	if reading.Name != "Reading" || reading.ParentID == nil || *reading.ParentID != work.ID {
+		t.Errorf("imported into %q under %v, want Reading under %d", reading.Name, reading.ParentID, work.ID)
+	}
+
+	var count int64
+	resolver.DB.Model(&models.Bookmark{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 3 {
+		t.Errorf("user has %d bookmarks, want 3", count)
+	}
+}
+
+func TestImportBookmarksTwiceSkipsEverything(t *testing.T) {
+	resolver := newTestResolver(t)
+	r := &mutationResolver{resolver}
+	user := testdb.CreateUser(t, resolver.DB, "alice")
+
+	first := importBookmarkFile(t, r, user.ID, importFile)
+	second := importBookmarkFile(t, r, user.ID, importFile)
+
+	if second.Created != 0 || second.CollectionsCreated != 0 {
+		t.Errorf("second import created %d bookmarks and %d collections", second.Created, second.CollectionsCreated)
+	}
+	if second.Skipped != first.Created+first.Skipped {
+		t.Errorf("second import skipped %d, want %d", second.Skipped, first.Created+first.Skipped)
+	}
+}
+
+func TestImportBookmarksIsPerUser(t *testing.T) {
+	resolver := newTestResolver(t)
+	r := &mutationResolver{resolver}
+	alice := testdb.CreateUser(t, resolver.DB, "alice")
+	bob := testdb.CreateUser(t, resolver.DB, "bob")
+
+	importBookmarkFile(t, r, alice.ID, importFile)
+	report := importBookmarkFile(t, r, bob.ID, importFile)
+
+	// Alice's copies must not count as duplicates for Bob
+	if report.Created != 3 {
+		t.Errorf("created %d, want 3", report.Created)
+	}
+}
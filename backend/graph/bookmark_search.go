@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+	"markly-backend/internal/search"
+)
+
+// scoredBookmark is a bookmark along with how well it matched a search
+type scoredBookmark struct {
+	models.Bookmark
+	SearchScore float64
+}
+
+// searchBookmarks runs a search query over userID's bookmarks and returns a
+// page of the matches, best first. Equally good matches come newest first.
+func searchBookmarks(db *gorm.DB, userID uint, input string, limit *int, offset *int) (*model.SearchResults, error) {
+	if (limit != nil && *limit < 0) || (offset != nil && *offset < 0) {
+		return nil, errors.New("limit and offset must not be negative")
+	}
+
+	q, err := search.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	query := q.Apply(db.Model(&models.Bookmark{}).Where("bookmarks.user_id = ?", userID))
+
+	var totalCount int64
+	if err := query.Session(&gorm.Session{}).Count(&totalCount).Error; err != nil {
+		return nil, err
+	}
+
+	pageSize := defaultPageSize
+	if limit != nil {
+		pageSize = min(*limit, maxPageSize)
+	}
+	pageQuery := query.Session(&gorm.Session{}).
+		Select("bookmarks.*, ? AS search_score", q.Rank(db)).
+		Order("search_score DESC, bookmarks.created_at DESC, bookmarks.id DESC").
+		Limit(pageSize)
+	if offset != nil {
+		pageQuery = pageQuery.Offset(*offset)
+	}
+
+	var bookmarks []scoredBookmark
+	if err := pageQuery.Scan(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+
+	results := &model.SearchResults{
+		Results:    make([]*model.SearchResult, len(bookmarks)),
+		TotalCount: int(totalCount),
+	}
+	for i := range bookmarks {
+		highlights := q.Highlights(&bookmarks[i].Bookmark)
+		result := &model.SearchResult{
+			Bookmark:   toGraphQLBookmark(&bookmarks[i].Bookmark),
+			Score:      bookmarks[i].SearchScore,
+			Highlights: make([]*model.SearchHighlight, len(highlights)),
+		}
+		for j, highlight := range highlights {
+			result.Highlights[j] = &model.SearchHighlight{Field: highlight.Field, Snippet: highlight.Snippet}
+		}
+		results.Results[i] = result
+	}
+	return results, nil
+}
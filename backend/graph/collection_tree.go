@@ -0,0 +1,192 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+)
+
+// collectionSubtree selects the ID of a collection and of every collection
+// nested in it, at any depth. UNION rather than UNION ALL keeps it finite
+// should the tree ever hold a cycle.
+const collectionSubtree = "WITH RECURSIVE subtree (id) AS (" +
+	"SELECT id FROM collections WHERE id = ? " +
+	"UNION SELECT c.id FROM collections c JOIN subtree ON c.parent_id = subtree.id" +
+	") SELECT id FROM subtree"
+
+// findParentCollection checks that parentID is one of userID's collections
+func findParentCollection(db *gorm.DB, userID uint, parentID uint) error {
+	var count int64
+	if err := db.Model(&models.Collection{}).Where("id = ? AND user_id = ?", parentID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("parent collection not found")
+	}
+	return nil
+}
+
+// moveCollection nests one of userID's collections in parentID, or makes it
+// a top-level collection when parentID is nil. A collection cannot be moved
+// into itself or any collection nested in it.
+func moveCollection(db *gorm.DB, userID uint, collectionID uint, parentID *uint) (*models.Collection, error) {
+	var moved *models.Collection
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Locking every collection of the user keeps two concurrent moves
+		// from nesting two collections in each other
+		var collections []models.Collection
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).Order("id").Find(&collections).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]*models.Collection, len(collections))
+		for i := range collections {
+			byID[collections[i].ID] = &collections[i]
+		}
+
+		moved = byID[collectionID]
+		if moved == nil {
+			return errors.New("collection not found")
+		}
+
+		if parentID != nil {
+			if byID[*parentID] == nil {
+				return errors.New("parent collection not found")
+			}
+			seen := make(map[uint]bool)
+			for id := parentID; id != nil && !seen[*id]; {
+				if *id == collectionID {
+					return errors.New("a collection cannot be moved into itself or a collection nested in it")
+				}
+				seen[*id] = true
+				parent := byID[*id]
+				if parent == nil {
+					break
+				}
+				id = parent.ParentID
+			}
+		}
+
+		moved.ParentID = parentID
+		return tx.Model(moved).Update("parent_id", parentID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// deleteCollection moves one of userID's collections to the trash. strategy
+// decides what happens to its bookmarks and nested collections: CASCADE
+// trashes them with it, MOVE_TO moves them into targetID first, and
+// REJECT_IF_NOT_EMPTY refuses to delete a collection that holds any.
+func (r *mutationResolver) deleteCollection(ctx context.Context, userID, collectionID uint, strategy model.DeleteCollectionStrategy, targetID *uint) (*model.CollectionDeletion, error) {
+	if strategy == model.DeleteCollectionStrategyMoveTo && targetID == nil {
+		return nil, errors.New("moveToCollectionId is required to move the contents of the collection")
+	}
+	if strategy != model.DeleteCollectionStrategyMoveTo && targetID != nil {
+		return nil, errors.New("moveToCollectionId is only used with the MOVE_TO strategy")
+	}
+
+	result := &model.CollectionDeletion{}
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locked like in moveCollection, so nothing is moved into the
+		// collection while it is being deleted
+		var collections []models.Collection
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).Order("id").Find(&collections).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]*models.Collection, len(collections))
+		hasChildren := false
+		for i := range collections {
+			byID[collections[i].ID] = &collections[i]
+			if parentID := collections[i].ParentID; parentID != nil && *parentID == collectionID {
+				hasChildren = true
+			}
+		}
+		if byID[collectionID] == nil {
+			return errors.New("collection not found")
+		}
+
+		switch strategy {
+		case model.DeleteCollectionStrategyRejectIfNotEmpty:
+			var count int64
+			if err := tx.Model(&models.Bookmark{}).Where("collection_id = ?", collectionID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 || hasChildren {
+				return errors.New("collection is not empty")
+			}
+
+		case model.DeleteCollectionStrategyMoveTo:
+			if byID[*targetID] == nil {
+				return errors.New("target collection not found")
+			}
+			seen := make(map[uint]bool)
+			for id := targetID; id != nil && !seen[*id]; {
+				if *id == collectionID {
+					return errors.New("the contents of a collection cannot be moved into itself or a collection nested in it")
+				}
+				seen[*id] = true
+				parent := byID[*id]
+				if parent == nil {
+					break
+				}
+				id = parent.ParentID
+			}
+
+			moved := tx.Model(&models.Bookmark{}).Where("collection_id = ?", collectionID).Update("collection_id", *targetID)
+			if moved.Error != nil {
+				return moved.Error
+			}
+			result.BookmarksMoved = int(moved.RowsAffected)
+			if err := tx.Model(&models.Collection{}).Where("parent_id = ?", collectionID).
+				Update("parent_id", *targetID).Error; err != nil {
+				return err
+			}
+		}
+
+		deleted, err := r.TrashService.TrashCollection(tx, userID, collectionID)
+		if err != nil {
+			return err
+		}
+		result.BookmarksDeleted = int(deleted)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// collectionAncestors returns the collections that collection is nested in,
+// from the top level down to its parent, given all of its owner's collections
+func collectionAncestors(collection *models.Collection, collections []models.Collection) []*models.Collection {
+	byID := make(map[uint]*models.Collection, len(collections))
+	for i := range collections {
+		byID[collections[i].ID] = &collections[i]
+	}
+
+	var ancestors []*models.Collection
+	seen := map[uint]bool{collection.ID: true}
+	for id := collection.ParentID; id != nil && !seen[*id]; {
+		parent := byID[*id]
+		if parent == nil {
+			break
+		}
+		seen[parent.ID] = true
+		ancestors = append(ancestors, parent)
+		id = parent.ParentID
+	}
+
+	for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+		ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+	}
+	return ancestors
+}
@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+	"markly-backend/internal/services"
+)
+
+// toGraphQLUser converts a database user into its GraphQL representation
+func toGraphQLUser(user *models.User) *model.User {
+	return &model.User{
+		ID:            strconv.FormatUint(uint64(user.ID), 10),
+		Email:         user.Email,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     user.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toGraphQLCollection converts a database collection into its GraphQL representation
+func toGraphQLCollection(collection *models.Collection) *model.Collection {
+	return &model.Collection{
+		ID:          strconv.FormatUint(uint64(collection.ID), 10),
+		Name:        collection.Name,
+		Description: collection.Description,
+		Color:       collection.Color,
+		ParentID:    formatOptionalID(collection.ParentID),
+		UserID:      strconv.FormatUint(uint64(collection.UserID), 10),
+		CreatedAt:   collection.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   collection.UpdatedAt.Format(time.RFC3339),
+		DeletedAt:   formatDeletedAt(collection.DeletedAt),
+	}
+}
+
+// toGraphQLBookmark converts a database bookmark into its GraphQL representation
+func toGraphQLBookmark(bookmark *models.Bookmark) *model.Bookmark {
+	return &model.Bookmark{
+		ID:            strconv.FormatUint(uint64(bookmark.ID), 10),
+		Title:         bookmark.Title,
+		URL:           bookmark.URL,
+		NormalizedURL: bookmark.NormalizedURL,
+		Description:   bookmark.Description,
+		Notes:         bookmark.Notes,
+		Favicon:       bookmark.Favicon,
+		Screenshot:    bookmark.Screenshot,
+		Tags:          bookmark.Tags,
+		CollectionID:  strconv.FormatUint(uint64(bookmark.CollectionID), 10),
+		UserID:        strconv.FormatUint(uint64(bookmark.UserID), 10),
+		CreatedAt:     bookmark.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     bookmark.UpdatedAt.Format(time.RFC3339),
+		DeletedAt:     formatDeletedAt(bookmark.DeletedAt),
+	}
+}
+
+// formatOptionalID formats a nullable foreign key as a GraphQL ID
+func formatOptionalID(id *uint) *string {
+	if id == nil {
+		return nil
+	}
+	formatted := strconv.FormatUint(uint64(*id), 10)
+	return &formatted
+}
+
+// formatDeletedAt formats when a row was moved to the trash, or returns nil
+// if it is not in the trash
+func formatDeletedAt(deletedAt gorm.DeletedAt) *string {
+	if !deletedAt.Valid {
+		return nil
+	}
+	formatted := deletedAt.Time.Format(time.RFC3339)
+	return &formatted
+}
+
+// parseID parses a GraphQL ID into a database primary key
+func parseID(id string) (uint, error) {
+	parsed, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint(parsed), nil
+}
+
+// toGraphQLAPIToken converts a personal access token into its GraphQL representation
+func toGraphQLAPIToken(token *models.APIToken) *model.APIToken {
+	result := &model.APIToken{
+		ID:        strconv.FormatUint(uint64(token.ID), 10),
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt.Format(time.RFC3339),
+	}
+	if result.Scopes == nil {
+		result.Scopes = []string{}
+	}
+	if token.ExpiresAt != nil {
+		expiresAt := token.ExpiresAt.Format(time.RFC3339)
+		result.ExpiresAt = &expiresAt
+	}
+	if token.LastUsedAt != nil {
+		lastUsedAt := token.LastUsedAt.Format(time.RFC3339)
+		result.LastUsedAt = &lastUsedAt
+	}
+	return result
+}
+
+func toGraphQLSession(session *models.Session, currentSessionID string) *model.Session {
+	return &model.Session{
+		ID:         strconv.FormatUint(uint64(session.ID), 10),
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		CreatedAt:  session.CreatedAt.Format(time.RFC3339),
+		LastSeenAt: session.LastSeenAt.Format(time.RFC3339),
+		Current:    session.FamilyID == currentSessionID,
+	}
+}
+
+// toGraphQLTag converts a tag and its usage count into its GraphQL representation
+func toGraphQLTag(usage *services.TagUsage) *model.Tag {
+	return &model.Tag{
+		ID:            strconv.FormatUint(uint64(usage.ID), 10),
+		Name:          usage.Name,
+		BookmarkCount: int(usage.BookmarkCount),
+		CreatedAt:     usage.CreatedAt.Format(time.RFC3339),
+	}
+}
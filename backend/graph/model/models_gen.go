@@ -2,44 +2,105 @@
 
 package model
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type AccountDeletion struct {
+	PurgeAt *string `json:"purgeAt,omitempty"`
+}
+
+type APIToken struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  *string  `json:"expiresAt,omitempty"`
+	LastUsedAt *string  `json:"lastUsedAt,omitempty"`
+	CreatedAt  string   `json:"createdAt"`
+}
+
 type AuthPayload struct {
-	Token string `json:"token"`
-	User  *User  `json:"user"`
+	Token         *string        `json:"token,omitempty"`
+	RefreshToken  *string        `json:"refreshToken,omitempty"`
+	User          *User          `json:"user"`
+	TotpChallenge *TotpChallenge `json:"totpChallenge,omitempty"`
 }
 
 type Bookmark struct {
-	ID           string      `json:"id"`
-	Title        string      `json:"title"`
-	URL          string      `json:"url"`
-	Description  *string     `json:"description,omitempty"`
-	Notes        *string     `json:"notes,omitempty"`
-	Favicon      *string     `json:"favicon,omitempty"`
-	Screenshot   *string     `json:"screenshot,omitempty"`
-	Tags         []string    `json:"tags,omitempty"`
-	CollectionID string      `json:"collectionId"`
-	Collection   *Collection `json:"collection"`
-	UserID       string      `json:"userId"`
-	User         *User       `json:"user"`
-	CreatedAt    string      `json:"createdAt"`
-	UpdatedAt    string      `json:"updatedAt"`
+	ID            string      `json:"id"`
+	Title         string      `json:"title"`
+	URL           string      `json:"url"`
+	NormalizedURL *string     `json:"normalizedUrl,omitempty"`
+	Description   *string     `json:"description,omitempty"`
+	Notes         *string     `json:"notes,omitempty"`
+	Favicon       *string     `json:"favicon,omitempty"`
+	Screenshot    *string     `json:"screenshot,omitempty"`
+	Tags          []string    `json:"tags,omitempty"`
+	CollectionID  string      `json:"collectionId"`
+	Collection    *Collection `json:"collection"`
+	UserID        string      `json:"userId"`
+	User          *User       `json:"user"`
+	CreatedAt     string      `json:"createdAt"`
+	UpdatedAt     string      `json:"updatedAt"`
+	DeletedAt     *string     `json:"deletedAt,omitempty"`
+}
+
+type BookmarkConnection struct {
+	Edges      []*BookmarkEdge `json:"edges"`
+	PageInfo   *PageInfo       `json:"pageInfo"`
+	TotalCount int             `json:"totalCount"`
+}
+
+type BookmarkEdge struct {
+	Cursor string    `json:"cursor"`
+	Node   *Bookmark `json:"node"`
 }
 
 type BookmarkFilter struct {
-	Search       *string  `json:"search,omitempty"`
-	Tags         []string `json:"tags,omitempty"`
-	CollectionID *string  `json:"collectionId,omitempty"`
+	Search             *string  `json:"search,omitempty"`
+	Tags               []string `json:"tags,omitempty"`
+	CollectionID       *string  `json:"collectionId,omitempty"`
+	IncludeDescendants *bool    `json:"includeDescendants,omitempty"`
+	CreatedAfter       *string  `json:"createdAfter,omitempty"`
+	CreatedBefore      *string  `json:"createdBefore,omitempty"`
+	Domain             *string  `json:"domain,omitempty"`
+}
+
+type BookmarkOrder struct {
+	Field     BookmarkOrderField `json:"field"`
+	Direction OrderDirection     `json:"direction"`
 }
 
 type Collection struct {
-	ID          string      `json:"id"`
-	Name        string      `json:"name"`
-	Description *string     `json:"description,omitempty"`
-	Color       *string     `json:"color,omitempty"`
-	UserID      string      `json:"userId"`
-	User        *User       `json:"user"`
-	Bookmarks   []*Bookmark `json:"bookmarks"`
-	CreatedAt   string      `json:"createdAt"`
-	UpdatedAt   string      `json:"updatedAt"`
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Description *string       `json:"description,omitempty"`
+	Color       *string       `json:"color,omitempty"`
+	ParentID    *string       `json:"parentId,omitempty"`
+	Parent      *Collection   `json:"parent,omitempty"`
+	Children    []*Collection `json:"children"`
+	Ancestors   []*Collection `json:"ancestors"`
+	UserID      string        `json:"userId"`
+	User        *User         `json:"user"`
+	Bookmarks   []*Bookmark   `json:"bookmarks"`
+	CreatedAt   string        `json:"createdAt"`
+	UpdatedAt   string        `json:"updatedAt"`
+	DeletedAt   *string       `json:"deletedAt,omitempty"`
+}
+
+type CollectionDeletion struct {
+	BookmarksMoved   int `json:"bookmarksMoved"`
+	BookmarksDeleted int `json:"bookmarksDeleted"`
+}
+
+type CreateAPITokenInput struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt *string  `json:"expiresAt,omitempty"`
 }
 
 type CreateBookmarkInput struct {
@@ -55,6 +116,46 @@ type CreateCollectionInput struct {
 	Name        string  `json:"name"`
 	Description *string `json:"description,omitempty"`
 	Color       *string `json:"color,omitempty"`
+	ParentID    *string `json:"parentId,omitempty"`
+}
+
+type CreateSmartCollectionInput struct {
+	Name        string          `json:"name"`
+	Description *string         `json:"description,omitempty"`
+	Color       *string         `json:"color,omitempty"`
+	Filter      *BookmarkFilter `json:"filter"`
+}
+
+type CreatedAPIToken struct {
+	Token    string    `json:"token"`
+	APIToken *APIToken `json:"apiToken"`
+}
+
+type DuplicateGroup struct {
+	NormalizedURL string      `json:"normalizedUrl"`
+	Bookmarks     []*Bookmark `json:"bookmarks"`
+}
+
+type ExportLink struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type ImportEntryResult struct {
+	Title      string            `json:"title"`
+	URL        string            `json:"url"`
+	Collection *string           `json:"collection,omitempty"`
+	Status     ImportEntryStatus `json:"status"`
+	Reason     *string           `json:"reason,omitempty"`
+	Bookmark   *Bookmark         `json:"bookmark,omitempty"`
+}
+
+type ImportReport struct {
+	Created            int                  `json:"created"`
+	Skipped            int                  `json:"skipped"`
+	Rejected           int                  `json:"rejected"`
+	CollectionsCreated int                  `json:"collectionsCreated"`
+	Entries            []*ImportEntryResult `json:"entries"`
 }
 
 type LoginInput struct {
@@ -65,6 +166,13 @@ type LoginInput struct {
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
 type Query struct {
 }
 
@@ -74,6 +182,76 @@ type RegisterInput struct {
 	Password string `json:"password"`
 }
 
+type SearchHighlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+type SearchResult struct {
+	Bookmark   *Bookmark          `json:"bookmark"`
+	Score      float64            `json:"score"`
+	Highlights []*SearchHighlight `json:"highlights"`
+}
+
+type SearchResults struct {
+	Results    []*SearchResult `json:"results"`
+	TotalCount int             `json:"totalCount"`
+}
+
+type Session struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IPAddress  string `json:"ipAddress"`
+	CreatedAt  string `json:"createdAt"`
+	LastSeenAt string `json:"lastSeenAt"`
+	Current    bool   `json:"current"`
+}
+
+type SmartCollection struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description *string                `json:"description,omitempty"`
+	Color       *string                `json:"color,omitempty"`
+	Filter      *SmartCollectionFilter `json:"filter"`
+	UserID      string                 `json:"userId"`
+	User        *User                  `json:"user"`
+	Bookmarks   []*Bookmark            `json:"bookmarks"`
+	CreatedAt   string                 `json:"createdAt"`
+	UpdatedAt   string                 `json:"updatedAt"`
+}
+
+type SmartCollectionFilter struct {
+	Search             *string  `json:"search,omitempty"`
+	Tags               []string `json:"tags,omitempty"`
+	CollectionID       *string  `json:"collectionId,omitempty"`
+	IncludeDescendants bool     `json:"includeDescendants"`
+	CreatedAfter       *string  `json:"createdAfter,omitempty"`
+	CreatedBefore      *string  `json:"createdBefore,omitempty"`
+	Domain             *string  `json:"domain,omitempty"`
+}
+
+type Tag struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	BookmarkCount int    `json:"bookmarkCount"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+type TotpChallenge struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type TotpEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+}
+
+type Trash struct {
+	Collections []*Collection `json:"collections"`
+	Bookmarks   []*Bookmark   `json:"bookmarks"`
+}
+
 type UpdateBookmarkInput struct {
 	Title        *string  `json:"title,omitempty"`
 	URL          *string  `json:"url,omitempty"`
@@ -89,11 +267,356 @@ type UpdateCollectionInput struct {
 	Color       *string `json:"color,omitempty"`
 }
 
+type UpdateSmartCollectionInput struct {
+	Name        *string         `json:"name,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	Color       *string         `json:"color,omitempty"`
+	Filter      *BookmarkFilter `json:"filter,omitempty"`
+}
+
 type User struct {
-	ID          string        `json:"id"`
-	Email       string        `json:"email"`
-	Username    string        `json:"username"`
-	CreatedAt   string        `json:"createdAt"`
-	UpdatedAt   string        `json:"updatedAt"`
-	Collections []*Collection `json:"collections"`
+	ID            string        `json:"id"`
+	Email         string        `json:"email"`
+	Username      string        `json:"username"`
+	EmailVerified bool          `json:"emailVerified"`
+	TotpEnabled   bool          `json:"totpEnabled"`
+	CreatedAt     string        `json:"createdAt"`
+	UpdatedAt     string        `json:"updatedAt"`
+	Collections   []*Collection `json:"collections"`
+}
+
+type BookmarkOrderField string
+
+const (
+	BookmarkOrderFieldCreatedAt BookmarkOrderField = "CREATED_AT"
+	BookmarkOrderFieldUpdatedAt BookmarkOrderField = "UPDATED_AT"
+	BookmarkOrderFieldTitle     BookmarkOrderField = "TITLE"
+)
+
+var AllBookmarkOrderField = []BookmarkOrderField{
+	BookmarkOrderFieldCreatedAt,
+	BookmarkOrderFieldUpdatedAt,
+	BookmarkOrderFieldTitle,
+}
+
+func (e BookmarkOrderField) IsValid() bool {
+	switch e {
+	case BookmarkOrderFieldCreatedAt, BookmarkOrderFieldUpdatedAt, BookmarkOrderFieldTitle:
+		return true
+	}
+	return false
+}
+
+func (e BookmarkOrderField) String() string {
+	return string(e)
+}
+
+func (e *BookmarkOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = BookmarkOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid BookmarkOrderField", str)
+	}
+	return nil
+}
+
+func (e BookmarkOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *BookmarkOrderField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e BookmarkOrderField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type DeleteCollectionStrategy string
+
+const (
+	DeleteCollectionStrategyCascade          DeleteCollectionStrategy = "CASCADE"
+	DeleteCollectionStrategyMoveTo           DeleteCollectionStrategy = "MOVE_TO"
+	DeleteCollectionStrategyRejectIfNotEmpty DeleteCollectionStrategy = "REJECT_IF_NOT_EMPTY"
+)
+
+var AllDeleteCollectionStrategy = []DeleteCollectionStrategy{
+	DeleteCollectionStrategyCascade,
+	DeleteCollectionStrategyMoveTo,
+	DeleteCollectionStrategyRejectIfNotEmpty,
+}
+
+func (e DeleteCollectionStrategy) IsValid() bool {
+	switch e {
+	case DeleteCollectionStrategyCascade, DeleteCollectionStrategyMoveTo, DeleteCollectionStrategyRejectIfNotEmpty:
+		return true
+	}
+	return false
+}
+
+func (e DeleteCollectionStrategy) String() string {
+	return string(e)
+}
+
+func (e *DeleteCollectionStrategy) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DeleteCollectionStrategy(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DeleteCollectionStrategy", str)
+	}
+	return nil
+}
+
+func (e DeleteCollectionStrategy) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *DeleteCollectionStrategy) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e DeleteCollectionStrategy) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type ExportFormat string
+
+const (
+	ExportFormatNetscapeHTML ExportFormat = "NETSCAPE_HTML"
+	ExportFormatJSON         ExportFormat = "JSON"
+	ExportFormatCSV          ExportFormat = "CSV"
+)
+
+var AllExportFormat = []ExportFormat{
+	ExportFormatNetscapeHTML,
+	ExportFormatJSON,
+	ExportFormatCSV,
+}
+
+func (e ExportFormat) IsValid() bool {
+	switch e {
+	case ExportFormatNetscapeHTML, ExportFormatJSON, ExportFormatCSV:
+		return true
+	}
+	return false
+}
+
+func (e ExportFormat) String() string {
+	return string(e)
+}
+
+func (e *ExportFormat) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ExportFormat(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ExportFormat", str)
+	}
+	return nil
+}
+
+func (e ExportFormat) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ExportFormat) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ExportFormat) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type ImportEntryStatus string
+
+const (
+	ImportEntryStatusCreated          ImportEntryStatus = "CREATED"
+	ImportEntryStatusSkippedDuplicate ImportEntryStatus = "SKIPPED_DUPLICATE"
+	ImportEntryStatusRejected         ImportEntryStatus = "REJECTED"
+)
+
+var AllImportEntryStatus = []ImportEntryStatus{
+	ImportEntryStatusCreated,
+	ImportEntryStatusSkippedDuplicate,
+	ImportEntryStatusRejected,
+}
+
+func (e ImportEntryStatus) IsValid() bool {
+	switch e {
+	case ImportEntryStatusCreated, ImportEntryStatusSkippedDuplicate, ImportEntryStatusRejected:
+		return true
+	}
+	return false
+}
+
+func (e ImportEntryStatus) String() string {
+	return string(e)
+}
+
+func (e *ImportEntryStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ImportEntryStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ImportEntryStatus", str)
+	}
+	return nil
+}
+
+func (e ImportEntryStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ImportEntryStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ImportEntryStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type ImportFormat string
+
+const (
+	ImportFormatNetscapeHTML ImportFormat = "NETSCAPE_HTML"
+)
+
+var AllImportFormat = []ImportFormat{
+	ImportFormatNetscapeHTML,
+}
+
+func (e ImportFormat) IsValid() bool {
+	switch e {
+	case ImportFormatNetscapeHTML:
+		return true
+	}
+	return false
+}
+
+func (e ImportFormat) String() string {
+	return string(e)
+}
+
+func (e *ImportFormat) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ImportFormat(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ImportFormat", str)
+	}
+	return nil
+}
+
+func (e ImportFormat) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ImportFormat) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ImportFormat) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type OrderDirection string
+
+const (
+	OrderDirectionAsc  OrderDirection = "ASC"
+	OrderDirectionDesc OrderDirection = "DESC"
+)
+
+var AllOrderDirection = []OrderDirection{
+	OrderDirectionAsc,
+	OrderDirectionDesc,
+}
+
+func (e OrderDirection) IsValid() bool {
+	switch e {
+	case OrderDirectionAsc, OrderDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e OrderDirection) String() string {
+	return string(e)
+}
+
+func (e *OrderDirection) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderDirection", str)
+	}
+	return nil
+}
+
+func (e OrderDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *OrderDirection) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e OrderDirection) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,197 @@
+package graph
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// bookmarkOrderColumns maps the public ordering fields to database columns.
+// Only columns listed here are ever interpolated into SQL.
+var bookmarkOrderColumns = map[model.BookmarkOrderField]string{
+	model.BookmarkOrderFieldCreatedAt: "created_at",
+	model.BookmarkOrderFieldUpdatedAt: "updated_at",
+	model.BookmarkOrderFieldTitle:     "title",
+}
+
+// bookmarkCursor identifies a position in an ordered bookmark list. The
+// bookmark ID breaks ties so the ordering is total and stable.
+type bookmarkCursor struct {
+	Field model.BookmarkOrderField `json:"f"`
+	Value string                   `json:"v"`
+	ID    uint                     `json:"id"`
+}
+
+func encodeBookmarkCursor(field model.BookmarkOrderField, bookmark *models.Bookmark) string {
+	cursor := bookmarkCursor{Field: field, ID: bookmark.ID}
+	switch field {
+	case model.BookmarkOrderFieldUpdatedAt:
+		cursor.Value = bookmark.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case model.BookmarkOrderFieldTitle:
+		cursor.Value = bookmark.Title
+	default:
+		cursor.Value = bookmark.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeBookmarkCursor(encoded string, field model.BookmarkOrderField) (*bookmarkCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var cursor bookmarkCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	if cursor.Field != field {
+		return nil, errors.New("cursor does not match the requested ordering")
+	}
+	return &cursor, nil
+}
+
+// value returns the cursor's sort key in the type the database compares against
+func (c *bookmarkCursor) value() (interface{}, error) {
+	if c.Field == model.BookmarkOrderFieldTitle {
+		return c.Value, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return t, nil
+}
+
+// keysetCondition restricts query to rows strictly after (or before) cursor
+// in the ordering given by column and ascending.
+func keysetCondition(query *gorm.DB, column string, cursor *bookmarkCursor, after bool, ascending bool) (*gorm.DB, error) {
+	value, err := cursor.value()
+	if err != nil {
+		return nil, err
+	}
+
+	op := "<"
+	if after == ascending {
+		op = ">"
+	}
+
+	condition := fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", column, op, column, op)
+	return query.Where(condition, value, value, cursor.ID), nil
+}
+
+// paginateBookmarks applies Relay-style cursor pagination to an already
+// filtered bookmark query.
+func paginateBookmarks(query *gorm.DB, first *int, after *string, last *int, before *string, orderBy *model.BookmarkOrder) (*model.BookmarkConnection, error) {
+	if first != nil && last != nil {
+		return nil, errors.New("first and last cannot be used together")
+	}
+	if (first != nil && *first < 0) || (last != nil && *last < 0) {
+		return nil, errors.New("first and last must not be negative")
+	}
+
+	order := model.BookmarkOrder{Field: model.BookmarkOrderFieldCreatedAt, Direction: model.OrderDirectionDesc}
+	if orderBy != nil {
+		order = *orderBy
+	}
+	column, ok := bookmarkOrderColumns[order.Field]
+	if !ok {
+		return nil, errors.New("invalid order field")
+	}
+	ascending := order.Direction == model.OrderDirectionAsc
+
+	var totalCount int64
+	if err := query.Session(&gorm.Session{}).Model(&models.Bookmark{}).Count(&totalCount).Error; err != nil {
+		return nil, err
+	}
+
+	pageQuery := query.Session(&gorm.Session{})
+	if after != nil {
+		cursor, err := decodeBookmarkCursor(*after, order.Field)
+		if err != nil {
+			return nil, err
+		}
+		if pageQuery, err = keysetCondition(pageQuery, column, cursor, true, ascending); err != nil {
+			return nil, err
+		}
+	}
+	if before != nil {
+		cursor, err := decodeBookmarkCursor(*before, order.Field)
+		if err != nil {
+			return nil, err
+		}
+		if pageQuery, err = keysetCondition(pageQuery, column, cursor, false, ascending); err != nil {
+			return nil, err
+		}
+	}
+
+	// Paging backwards reads the list in reverse and flips the page afterwards
+	backward := last != nil
+	limit := defaultPageSize
+	if first != nil {
+		limit = *first
+	} else if last != nil {
+		limit = *last
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	direction := "DESC"
+	if ascending != backward {
+		direction = "ASC"
+	}
+
+	var bookmarks []models.Bookmark
+	if err := pageQuery.
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(limit + 1).
+		Find(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+
+	hasMore := len(bookmarks) > limit
+	if hasMore {
+		bookmarks = bookmarks[:limit]
+	}
+	if backward {
+		for i, j := 0, len(bookmarks)-1; i < j; i, j = i+1, j-1 {
+			bookmarks[i], bookmarks[j] = bookmarks[j], bookmarks[i]
+		}
+	}
+
+	connection := &model.BookmarkConnection{
+		Edges: make([]*model.BookmarkEdge, 0, len(bookmarks)),
+		PageInfo: &model.PageInfo{
+			HasNextPage:     (!backward && hasMore) || (backward && before != nil),
+			HasPreviousPage: (backward && hasMore) || (!backward && after != nil),
+		},
+		TotalCount: int(totalCount),
+	}
+	for i := range bookmarks {
+		connection.Edges = append(connection.Edges, &model.BookmarkEdge{
+			Cursor: encodeBookmarkCursor(order.Field, &bookmarks[i]),
+			Node:   toGraphQLBookmark(&bookmarks[i]),
+		})
+	}
+	if len(connection.Edges) > 0 {
+		connection.PageInfo.StartCursor = &connection.Edges[0].Cursor
+		connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+
+	return connection, nil
+}
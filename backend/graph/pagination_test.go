@@ -0,0 +1,258 @@
+package graph
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+// seedPaginationBookmarks stores bookmarks for a new user whose titles,
+// creation and update times repeat, so every ordering has ties for the ID to
+// break. Another user's bookmark is stored too, to show it is never counted.
+func seedPaginationBookmarks(t *testing.T, r *Resolver) (uint, []models.Bookmark) {
+	t.Helper()
+
+	alice := testdb.CreateUser(t, r.DB, "alice")
+	collection := testdb.CreateCollection(t, r.DB, alice.ID, "Reading", 0)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := []struct {
+		title   string
+		created int
+		updated int
+	}{
+		{"b", 0, 5}, {"a", 1, 4}, {"b", 1, 4}, {"c", 2, 3},
+		{"a", 2, 3}, {"b", 2, 3}, {"c", 3, 0},
+	}
+
+	var bookmarks []models.Bookmark
+	for i, row := range rows {
+		bookmark := testdb.CreateBookmark(t, r.DB, alice.ID, collection.ID, "https://example.com/"+strconv.Itoa(i))
+		bookmark.Title = row.title
+		bookmark.CreatedAt = base.Add(time.Duration(row.created) * time.Minute)
+		bookmark.UpdatedAt = base.Add(time.Duration(row.updated) * time.Minute)
+		if err := r.DB.Model(bookmark).UpdateColumns(map[string]interface{}{
+			"title":      bookmark.Title,
+			"created_at": bookmark.CreatedAt,
+			"updated_at": bookmark.UpdatedAt,
+		}).Error; err != nil {
+			t.Fatalf("update bookmark: %v", err)
+		}
+		bookmarks = append(bookmarks, *bookmark)
+	}
+
+	bob := testdb.CreateUser(t, r.DB, "bob")
+	testdb.CreateBookmark(t, r.DB, bob.ID, testdb.CreateCollection(t, r.DB, bob.ID, "Reading", 0).ID, "https://example.com/bob")
+	return alice.ID, bookmarks
+}
+
+// expectedOrder sorts bookmarks the way order asks, breaking ties by ID
+func expectedOrder(bookmarks []models.Bookmark, order model.BookmarkOrder) []string {
+	sorted := append([]models.Bookmark(nil), bookmarks...)
+	less := func(a, b models.Bookmark) bool {
+		switch order.Field {
+		case model.BookmarkOrderFieldTitle:
+			if a.Title != b.Title {
+				return a.Title < b.Title
+			}
+		case model.BookmarkOrderFieldUpdatedAt:
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.Before(b.UpdatedAt)
+			}
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if order.Direction == model.OrderDirectionAsc {
+			return less(sorted[i], sorted[j])
+		}
+		return less(sorted[j], sorted[i])
+	})
+
+	ids := make([]string, len(sorted))
+	for i, bookmark := range sorted {
+		ids[i] = strconv.FormatUint(uint64(bookmark.ID), 10)
+	}
+	return ids
+}
+
+func edgeIDs(connection *model.BookmarkConnection) []string {
+	ids := make([]string, len(connection.Edges))
+	for i, edge := range connection.Edges {
+		ids[i] = edge.Node.ID
+	}
+	return ids
+}
+
+func equalStrings(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBookmarksConnectionPagesThroughTies(t *testing.T) {
+	resolver := newTestResolver(t)
+	r := &queryResolver{resolver}
+	userID, bookmarks := seedPaginationBookmarks(t, resolver)
+	ctx := userContext(userID)
+	pageSize := 2
+
+	for _, field := range model.AllBookmarkOrderField {
+		for _, direction := range model.AllOrderDirection {
+			order := model.BookmarkOrder{Field: field, Direction: direction}
+			want := expectedOrder(bookmarks, order)
+
+			t.Run(string(field)+"_"+string(direction)+"_forward", func(t *testing.T) {
+				var got []string
+				var after *string
+				for page := 0; ; page++ {
+					connection, err := r.BookmarksConnection(ctx, nil, &pageSize, after, nil, nil, &order)
+					if err != nil {
+						t.Fatalf("page %d: %v", page, err)
+					}
+					if connection.TotalCount != len(bookmarks) {
+						t.Errorf("page %d: totalCount = %d, want %d", page, connection.TotalCount, len(bookmarks))
+					}
+					if connection.PageInfo.HasPreviousPage != (page > 0) {
+						t.Errorf("page %d: hasPreviousPage = %v", page, connection.PageInfo.HasPreviousPage)
+					}
+					got = append(got, edgeIDs(connection)...)
+					if !connection.PageInfo.HasNextPage {
+						break
+					}
+					after = connection.PageInfo.EndCursor
+				}
+				if !equalStrings(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+
+			t.Run(string(field)+"_"+string(direction)+"_backward", func(t *testing.T) {
+				var got []string
+				var before *string
+				for page := 0; ; page++ {
+					connection, err := r.BookmarksConnection(ctx, nil, nil, nil, &pageSize, before, &order)
+					if err != nil {
+						t.Fatalf("page %d: %v", page, err)
+					}
+					if connection.PageInfo.HasNextPage != (page > 0) {
+						t.Errorf("page %d: hasNextPage = %v", page, connection.PageInfo.HasNextPage)
+					}
+					got = append(edgeIDs(connection), got...)
+					if !connection.PageInfo.HasPreviousPage {
+						break
+					}
+					before = connection.PageInfo.StartCursor
+				}
+				if !equalStrings(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestBookmarksConnectionBetweenCursors(t *testing.T) {
+	resolver := newTestResolver(t)
+	r := &queryResolver{resolver}
+	userID, bookmarks := seedPaginationBookmarks(t, resolver)
+	ctx := userContext(userID)
+	order := model.BookmarkOrder{Field: model.BookmarkOrderFieldTitle, Direction: model.OrderDirectionAsc}
+	want := expectedOrder(bookmarks, order)
+
+	all, err := r.BookmarksConnection(ctx, nil, nil, nil, nil, nil, &order)
+	if err != nil {
+		t.Fatalf("list bookmarks: %v", err)
+	}
+	if got := edgeIDs(all); !equalStrings(got, want) {
+		t.Fatalf("default page: got %v, want %v", got, want)
+	}
+
+	after, before := all.Edges[1].Cursor, all.Edges[5].Cursor
+	connection, err := r.BookmarksConnection(ctx, nil, nil, &after, nil, &before, &order)
+	if err != nil {
+		t.Fatalf("list between cursors: %v", err)
+	}
+	if got := edgeIDs(connection); !equalStrings(got, want[2:5]) {
+		t.Errorf("got %v, want %v", got, want[2:5])
+	}
+	if connection.TotalCount != len(bookmarks) {
+		t.Errorf("totalCount = %d, want %d", connection.TotalCount, len(bookmarks))
+	}
+}
+
+func TestBookmarksConnectionTotalCountFollowsFilter(t *testing.T) {
+	resolver := newTestResolver(t)
+	r := &queryResolver{resolver}
+	userID, _ := seedPaginationBookmarks(t, resolver)
+	createdAfter := "2025-03-01T12:02:00Z"
+	first := 0
+
+	connection, err := r.BookmarksConnection(userContext(userID), &model.BookmarkFilter{CreatedAfter: &createdAfter}, &first, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("list bookmarks: %v", err)
+	}
+	if len(connection.Edges) != 0 {
+		t.Errorf("first: 0 returned %d edges", len(connection.Edges))
+	}
+	if connection.TotalCount != 4 {
+		t.Errorf("totalCount = %d, want 4", connection.TotalCount)
+	}
+}
+
+func TestBookmarksConnectionRejectsInvalidArguments(t *testing.T) {
+	resolver := newTestResolver(t)
+	r := &queryResolver{resolver}
+	userID, _ := seedPaginationBookmarks(t, resolver)
+	ctx := userContext(userID)
+
+	encode := func(raw string) *string {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(raw))
+		return &cursor
+	}
+	notBase64 := "not a cursor!"
+	titleOrder := &model.BookmarkOrder{Field: model.BookmarkOrderFieldTitle, Direction: model.OrderDirectionAsc}
+	one, negative := 1, -1
+
+	tests := []struct {
+		name    string
+		first   *int
+		after   *string
+		last    *int
+		before  *string
+		orderBy *model.BookmarkOrder
+	}{
+		{name: "after is not base64", after: &notBase64},
+		{name: "before is not base64", before: &notBase64},
+		{name: "after is not JSON", after: encode("{")},
+		{name: "cursor for another ordering", after: encode(`{"f":"TITLE","v":"a","id":1}`)},
+		{name: "cursor for created at from a title ordering", before: encode(`{"f":"CREATED_AT","v":"2025-03-01T12:00:00Z","id":1}`), orderBy: titleOrder},
+		{name: "cursor with a malformed time", after: encode(`{"f":"CREATED_AT","v":"yesterday","id":1}`)},
+		{name: "first and last", first: &one, last: &one},
+		{name: "negative first", first: &negative},
+		{name: "negative last", last: &negative},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := r.BookmarksConnection(ctx, nil, tt.first, tt.after, tt.last, tt.before, tt.orderBy); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
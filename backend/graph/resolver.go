@@ -1,7 +1,17 @@
 package graph
 
 import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/config"
 	"markly-backend/internal/database"
+	"markly-backend/internal/loaders"
+	"markly-backend/internal/mail"
+	"markly-backend/internal/middleware"
 	"markly-backend/internal/services"
 	"gorm.io/gorm"
 )
@@ -11,15 +21,150 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct{
-	DB                  *gorm.DB
-	ImageCaptureService *services.ImageCaptureService
+	DB                       *gorm.DB
+	ImageCaptureService      *services.ImageCaptureService
+	ExportService            *services.ExportService
+	RefreshTokenService      *services.RefreshTokenService
+	TokenService             *services.TokenService
+	LoginThrottleService     *services.LoginThrottleService
+	PasswordResetService     *services.PasswordResetService
+	EmailVerificationService *services.EmailVerificationService
+	APITokenService          *services.APITokenService
+	TOTPService              *services.TOTPService
+	AccountService           *services.AccountService
+	TagService               *services.TagService
+	TrashService             *services.TrashService
+	DuplicateService         *services.DuplicateService
+	// OIDCService is nil unless single sign-on is configured
+	OIDCService *services.OIDCService
+
+	// RequireEmailVerification restricts unverified accounts
+	RequireEmailVerification bool
 }
 
-func NewResolver() *Resolver {
+func NewResolver(cfg *config.Config) (*Resolver, error) {
 	db := database.GetDB()
 	imageCaptureService := services.NewImageCaptureService("/tmp/markly/images", "http://localhost:8081")
+	exportService := services.NewExportService(db, cfg.Server.PublicURL, imageCaptureService)
+
+	refreshExpiry, err := time.ParseDuration(cfg.JWT.RefreshExpiry)
+	if err != nil {
+		log.Printf("Invalid JWT_REFRESH_EXPIRY %q, using default: %v", cfg.JWT.RefreshExpiry, err)
+		refreshExpiry = 30 * 24 * time.Hour
+	}
+	refreshTokenService := services.NewRefreshTokenService(db, refreshExpiry)
+
+	tokenService, err := services.NewTokenService(&cfg.JWT, time.Duration(cfg.Security.JWTExpiryHours)*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	loginAttemptWindow, err := time.ParseDuration(cfg.Security.LoginAttemptWindow)
+	if err != nil {
+		log.Printf("Invalid LOGIN_ATTEMPT_WINDOW %q, using default: %v", cfg.Security.LoginAttemptWindow, err)
+		loginAttemptWindow = 15 * time.Minute
+	}
+	maxLoginAttempts := cfg.Security.MaxLoginAttempts
+	if maxLoginAttempts < 1 {
+		maxLoginAttempts = 5
+	}
+	loginThrottleService := services.NewLoginThrottleService(db, maxLoginAttempts, loginAttemptWindow)
+
+	passwordResetExpiry, err := time.ParseDuration(cfg.Security.PasswordResetExpiry)
+	if err != nil {
+		log.Printf("Invalid PASSWORD_RESET_EXPIRY %q, using default: %v", cfg.Security.PasswordResetExpiry, err)
+		passwordResetExpiry = time.Hour
+	}
+	mailer := mail.New(&cfg.Mail)
+	passwordResetService := services.NewPasswordResetService(db, mailer, cfg.Server.AppURL, passwordResetExpiry)
+
+	emailVerificationExpiry, err := time.ParseDuration(cfg.Security.EmailVerificationExpiry)
+	if err != nil {
+		log.Printf("Invalid EMAIL_VERIFICATION_EXPIRY %q, using default: %v", cfg.Security.EmailVerificationExpiry, err)
+		emailVerificationExpiry = 48 * time.Hour
+	}
+	emailVerificationService := services.NewEmailVerificationService(db, mailer, cfg.Server.AppURL, emailVerificationExpiry)
+
+	accountDeletionGracePeriod, err := time.ParseDuration(cfg.Security.AccountDeletionGracePeriod)
+	if err != nil {
+		log.Printf("Invalid ACCOUNT_DELETION_GRACE_PERIOD %q, deleting accounts immediately: %v", cfg.Security.AccountDeletionGracePeriod, err)
+		accountDeletionGracePeriod = 0
+	}
+
+	trashRetention, err := time.ParseDuration(cfg.Security.TrashRetention)
+	if err != nil {
+		log.Printf("Invalid TRASH_RETENTION %q, using default: %v", cfg.Security.TrashRetention, err)
+		trashRetention = 30 * 24 * time.Hour
+	}
+
+	tagService := services.NewTagService(db)
+
+	accountService := services.NewAccountService(db, imageCaptureService, accountDeletionGracePeriod)
+	totpService := services.NewTOTPService(db)
+
+	var oidcService *services.OIDCService
+	if cfg.OIDC.Enabled() {
+		oidcService = services.NewOIDCService(&cfg.OIDC, db, cfg.JWT.Secret, cfg.Server.AppURL, refreshTokenService, tokenService, accountService, totpService)
+	}
+
 	return &Resolver{
-		DB:                  db,
-		ImageCaptureService: imageCaptureService,
+		DB:                       db,
+		ImageCaptureService:      imageCaptureService,
+		ExportService:            exportService,
+		RefreshTokenService:      refreshTokenService,
+		TokenService:             tokenService,
+		LoginThrottleService:     loginThrottleService,
+		PasswordResetService:     passwordResetService,
+		EmailVerificationService: emailVerificationService,
+		APITokenService:          services.NewAPITokenService(db),
+		TOTPService:              totpService,
+		AccountService:           accountService,
+		TagService:               tagService,
+		TrashService:             services.NewTrashService(db, imageCaptureService, trashRetention),
+		DuplicateService:         services.NewDuplicateService(db, tagService),
+		OIDCService:              oidcService,
+		RequireEmailVerification: cfg.Security.RequireEmailVerification,
+	}, nil
+}
+
+// requestLoaders returns the batch loaders for the current request
+func (r *Resolver) requestLoaders(ctx context.Context) (*loaders.Loaders, error) {
+	if _, ok := ctx.Value(middleware.UserIDKey).(uint); !ok {
+		return nil, errors.New("user not authenticated")
+	}
+
+	l, ok := loaders.For(ctx)
+	if !ok {
+		return nil, errors.New("request loaders not configured")
+	}
+	return l, nil
+}
+
+// loadUser resolves a user reference through the request's user loader. It
+// needs the same scope as Query.me, as the bookmarks and collections that
+// mutations return lead to their user too.
+func (r *Resolver) loadUser(ctx context.Context, id string) (*model.User, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	l, err := r.requestLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := parseID(id)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
 	}
+
+	user, err := l.UserByID.Load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	return toGraphQLUser(user), nil
 }
@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"markly-backend/internal/middleware"
+	"markly-backend/internal/services"
+	"markly-backend/internal/testdb"
+)
+
+// newTestResolver returns a resolver backed by a fresh test database, with
+// the services the bookmark and account resolvers need
+func newTestResolver(t *testing.T) *Resolver {
+	t.Helper()
+
+	db := testdb.Open(t)
+	tagService := services.NewTagService(db)
+	return &Resolver{
+		DB:               db,
+		APITokenService:  services.NewAPITokenService(db),
+		TagService:       tagService,
+		DuplicateService: services.NewDuplicateService(db, tagService),
+	}
+}
+
+// userContext returns a context signed in as userID
+func userContext(userID uint) context.Context {
+	return context.WithValue(context.Background(), middleware.UserIDKey, userID)
+}
+
+// errorCode returns the code extension of a GraphQL error, or "" if err
+// carries none
+func errorCode(err error) string {
+	var gqlErr *gqlerror.Error
+	if !errors.As(err, &gqlErr) {
+		return ""
+	}
+	code, _ := gqlErr.Extensions["code"].(string)
+	return code
+}
@@ -8,25 +8,204 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"log"
 	"markly-backend/graph/model"
 	"markly-backend/internal/middleware"
 	"markly-backend/internal/models"
+	"markly-backend/internal/netscape"
+	"markly-backend/internal/services"
 	"markly-backend/internal/utils"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"gorm.io/gorm"
 )
 
+// Collection is the resolver for the collection field.
+func (r *bookmarkResolver) Collection(ctx context.Context, obj *model.Bookmark) (*model.Collection, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	l, err := r.requestLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	collectionID, err := parseID(obj.CollectionID)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	collection, err := l.CollectionByID.Load(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		return nil, errors.New("collection not found")
+	}
+
+	return toGraphQLCollection(collection), nil
+}
+
+// User is the resolver for the user field.
+func (r *bookmarkResolver) User(ctx context.Context, obj *model.Bookmark) (*model.User, error) {
+	return r.loadUser(ctx, obj.UserID)
+}
+
+// Parent is the resolver for the parent field.
+func (r *collectionResolver) Parent(ctx context.Context, obj *model.Collection) (*model.Collection, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	if obj.ParentID == nil {
+		return nil, nil
+	}
+
+	l, err := r.requestLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parentID, err := parseID(*obj.ParentID)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	parent, err := l.CollectionByID.Load(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, nil
+	}
+
+	return toGraphQLCollection(parent), nil
+}
+
+// Children is the resolver for the children field.
+func (r *collectionResolver) Children(ctx context.Context, obj *model.Collection) ([]*model.Collection, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	l, err := r.requestLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := parseID(obj.UserID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+	collectionID, err := parseID(obj.ID)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	// Every collection of the user is loaded once per request and shared by
+	// the children and ancestors of all the collections in the response
+	collections, err := l.CollectionsByUserID.Load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Collection, 0)
+	for i := range collections {
+		if parentID := collections[i].ParentID; parentID != nil && *parentID == collectionID {
+			result = append(result, toGraphQLCollection(&collections[i]))
+		}
+	}
+
+	return result, nil
+}
+
+// Ancestors is the resolver for the ancestors field.
+func (r *collectionResolver) Ancestors(ctx context.Context, obj *model.Collection) ([]*model.Collection, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	l, err := r.requestLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := parseID(obj.UserID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+	collectionID, err := parseID(obj.ID)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	collections, err := l.CollectionsByUserID.Load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Collection, 0)
+	for i := range collections {
+		if collections[i].ID == collectionID {
+			for _, ancestor := range collectionAncestors(&collections[i], collections) {
+				result = append(result, toGraphQLCollection(ancestor))
+			}
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// User is the resolver for the user field.
+func (r *collectionResolver) User(ctx context.Context, obj *model.Collection) (*model.User, error) {
+	return r.loadUser(ctx, obj.UserID)
+}
+
+// Bookmarks is the resolver for the bookmarks field.
+func (r *collectionResolver) Bookmarks(ctx context.Context, obj *model.Collection) ([]*model.Bookmark, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	l, err := r.requestLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	collectionID, err := parseID(obj.ID)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	bookmarks, err := l.BookmarksByCollectionID.Load(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Bookmark, 0, len(bookmarks))
+	for i := range bookmarks {
+		result = append(result, toGraphQLBookmark(&bookmarks[i]))
+	}
+
+	return result, nil
+}
+
 // Register is the resolver for the register field.
 func (r *mutationResolver) Register(ctx context.Context, input model.RegisterInput) (*model.AuthPayload, error) {
 	// Validate input
 	if err := utils.ValidateRegisterInput(input.Email, input.Username, input.Password); err != nil {
 		return nil, err
 	}
-	
+
 	// Sanitize input
 	email := strings.ToLower(strings.TrimSpace(input.Email))
 	username := utils.SanitizeString(input.Username)
-	
+
 	// Check if user already exists
 	var existingUser models.User
 	if err := r.DB.Where("email = ? OR username = ?", email, username).First(&existingUser).Error; err == nil {
@@ -50,22 +229,13 @@ func (r *mutationResolver) Register(ctx context.Context, input model.RegisterInp
 		return nil, err
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID)
-	if err != nil {
-		return nil, err
+	// Registration still succeeds if the mail cannot be queued; the user can ask for another
+	if err := r.EmailVerificationService.Send(ctx, &user); err != nil {
+		log.Printf("Failed to create email verification token: %v", err)
 	}
 
-	return &model.AuthPayload{
-		Token: token,
-		User: &model.User{
-			ID:        strconv.FormatUint(uint64(user.ID), 10),
-			Email:     user.Email,
-			Username:  user.Username,
-			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		},
-	}, nil
+	// Start a session and issue its tokens
+	return r.issueAuthPayload(ctx, &user)
 }
 
 // Login is the resolver for the login field.
@@ -74,286 +244,1488 @@ func (r *mutationResolver) Login(ctx context.Context, input model.LoginInput) (*
 	if err := utils.ValidateEmail(input.Email); err != nil {
 		return nil, errors.New("invalid email format")
 	}
-	
+
 	if input.Password == "" {
 		return nil, errors.New("password is required")
 	}
-	
+
 	// Sanitize email
 	email := strings.ToLower(strings.TrimSpace(input.Email))
-	
+
+	// Refuse to check passwords while the account or client is locked out
+	ip := middleware.ClientIPFromContext(ctx)
+	if err := r.LoginThrottleService.Check(ctx, email, ip); err != nil {
+		return nil, loginError(err)
+	}
+
 	// Find user by email
 	var user models.User
 	if err := r.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, r.loginFailed(ctx, email, ip)
 	}
 
 	// Check password
 	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		return nil, r.loginFailed(ctx, email, ip)
+	}
+
+	// Deleted accounts past their grace period are only waiting for the purger
+	if user.DeletionScheduledAt != nil && !time.Now().Before(*user.DeletionScheduledAt) {
 		return nil, errors.New("invalid credentials")
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID)
+	// Accounts with two-factor authentication finish signing in with verifyTotp.
+	// Failed attempts are only cleared once the second step succeeds.
+	totpEnabled, err := r.TOTPService.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if totpEnabled {
+		challenge, err := r.TOTPService.CreateChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &model.AuthPayload{
+			User: toGraphQLUser(&user),
+			TotpChallenge: &model.TotpChallenge{
+				Token:     challenge.Token,
+				ExpiresAt: challenge.ExpiresAt.Format(time.RFC3339),
+			},
+		}, nil
+	}
+
+	if err := r.LoginThrottleService.RecordSuccess(ctx, email); err != nil {
+		log.Printf("Failed to clear login attempts: %v", err)
+	}
+
+	// Start a session and issue its tokens
+	return r.issueAuthPayload(ctx, &user)
+}
+
+// RefreshToken is the resolver for the refreshToken field.
+func (r *mutationResolver) RefreshToken(ctx context.Context, token string) (*model.AuthPayload, error) {
+	if strings.TrimSpace(token) == "" {
+		return nil, errors.New("refresh token is required")
+	}
+
+	// Exchange the refresh token for the next one in its session
+	userID, refresh, err := r.RefreshTokenService.Rotate(ctx, token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) ||
+			errors.Is(err, services.ErrRefreshTokenExpired) ||
+			errors.Is(err, services.ErrRefreshTokenReused) {
+			return nil, err
+		}
+		return nil, errors.New("failed to refresh session")
+	}
+
+	// Find user
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	accessToken, _, err := r.TokenService.GenerateAccessToken(user.ID, refresh.FamilyID)
 	if err != nil {
 		return nil, err
 	}
 
 	return &model.AuthPayload{
-		Token: token,
-		User: &model.User{
-			ID:        strconv.FormatUint(uint64(user.ID), 10),
-			Email:     user.Email,
-			Username:  user.Username,
-			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		},
+		Token:        &accessToken,
+		RefreshToken: &refresh.Token,
+		User:         toGraphQLUser(&user),
 	}, nil
 }
 
-// CreateCollection is the resolver for the createCollection field.
-func (r *mutationResolver) CreateCollection(ctx context.Context, input model.CreateCollectionInput) (*model.Collection, error) {
+// Logout is the resolver for the logout field.
+func (r *mutationResolver) Logout(ctx context.Context, refreshToken *string) (bool, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
-		return nil, errors.New("user not authenticated")
+		return false, errors.New("user not authenticated")
 	}
 
-	// Validate input
-	if err := utils.ValidateCollectionName(input.Name); err != nil {
-		return nil, err
-	}
-	
-	if err := utils.ValidateDescription(*input.Description); err != nil {
-		return nil, err
+	claims, ok := middleware.GetTokenClaimsFromContext(ctx)
+	if !ok {
+		return false, errors.New("user not authenticated")
 	}
-	
-	if err := utils.ValidateColor(*input.Color); err != nil {
-		return nil, err
+
+	// Revoke the session the access token belongs to, and the refresh token's
+	// session if the client passed one from elsewhere
+	if claims.SessionID != "" {
+		if err := r.RefreshTokenService.RevokeSession(ctx, userID, claims.SessionID); err != nil {
+			return false, err
+		}
 	}
-	
-	// Sanitize input
-	name := utils.SanitizeString(input.Name)
-	description := utils.SanitizeString(*input.Description)
-	
-	// Create collection
-	collection := models.Collection{
-		Name:        name,
-		Description: &description,
-		Color:       input.Color,
-		UserID:      userID,
+	if refreshToken != nil {
+		if err := r.RefreshTokenService.RevokeSessionByToken(ctx, userID, *refreshToken); err != nil && !errors.Is(err, services.ErrInvalidRefreshToken) {
+			return false, err
+		}
 	}
 
-	if err := r.DB.Create(&collection).Error; err != nil {
-		return nil, err
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := r.RefreshTokenService.RevokeAccessToken(ctx, userID, claims.ID, expiresAt); err != nil {
+		return false, err
 	}
 
-	return &model.Collection{
-		ID:          strconv.FormatUint(uint64(collection.ID), 10),
-		Name:        collection.Name,
-		Description: collection.Description,
-		Color:       collection.Color,
-		UserID:      strconv.FormatUint(uint64(collection.UserID), 10),
-		CreatedAt:   collection.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   collection.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	return true, nil
 }
 
-// UpdateCollection is the resolver for the updateCollection field.
-func (r *mutationResolver) UpdateCollection(ctx context.Context, id string, input model.UpdateCollectionInput) (*model.Collection, error) {
-	// Get user from context
-	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
-	if !ok {
-		return nil, errors.New("user not authenticated")
+// RequestPasswordReset is the resolver for the requestPasswordReset field.
+func (r *mutationResolver) RequestPasswordReset(ctx context.Context, email string) (bool, error) {
+	if err := utils.ValidateEmail(email); err != nil {
+		return false, errors.New("invalid email format")
 	}
 
-	// Parse collection ID
-	collectionID, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		return nil, errors.New("invalid collection ID")
+	// Always report success so the response does not reveal whether the address is registered
+	if err := r.PasswordResetService.Request(ctx, strings.ToLower(strings.TrimSpace(email))); err != nil {
+		log.Printf("Failed to create password reset token: %v", err)
+		return false, errors.New("failed to request password reset")
 	}
 
-	// Find collection
-	var collection models.Collection
-	if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
-		return nil, errors.New("collection not found")
+	return true, nil
+}
+
+// ResetPassword is the resolver for the resetPassword field.
+func (r *mutationResolver) ResetPassword(ctx context.Context, token string, newPassword string) (bool, error) {
+	if strings.TrimSpace(token) == "" {
+		return false, errors.New("reset token is required")
+	}
+	if err := utils.ValidatePassword(newPassword); err != nil {
+		return false, err
 	}
 
-	// Update fields
-	if input.Name != nil {
-		collection.Name = *input.Name
+	userID, err := r.PasswordResetService.Reset(ctx, token, newPassword)
+	if err != nil {
+		return false, err
 	}
-	if input.Description != nil {
-		collection.Description = input.Description
+
+	// Sign out everywhere; whoever knew the old password may hold a session
+	if err := r.RefreshTokenService.RevokeAllSessions(ctx, userID); err != nil {
+		return false, err
 	}
-	if input.Color != nil {
-		collection.Color = input.Color
+
+	return true, nil
+}
+
+// VerifyEmail is the resolver for the verifyEmail field.
+func (r *mutationResolver) VerifyEmail(ctx context.Context, token string) (*model.User, error) {
+	if strings.TrimSpace(token) == "" {
+		return nil, errors.New("verification token is required")
 	}
 
-	if err := r.DB.Save(&collection).Error; err != nil {
+	user, err := r.EmailVerificationService.Verify(ctx, token)
+	if err != nil {
 		return nil, err
 	}
 
-	return &model.Collection{
-		ID:          strconv.FormatUint(uint64(collection.ID), 10),
-		Name:        collection.Name,
-		Description: collection.Description,
-		Color:       collection.Color,
-		UserID:      strconv.FormatUint(uint64(collection.UserID), 10),
-		CreatedAt:   collection.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   collection.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	return toGraphQLUser(user), nil
 }
 
-// DeleteCollection is the resolver for the deleteCollection field.
-func (r *mutationResolver) DeleteCollection(ctx context.Context, id string) (bool, error) {
+// ResendVerification is the resolver for the resendVerification field.
+func (r *mutationResolver) ResendVerification(ctx context.Context) (bool, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
 		return false, errors.New("user not authenticated")
 	}
+	if err := requireSession(ctx); err != nil {
+		return false, err
+	}
 
-	// Parse collection ID
-	collectionID, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		return false, errors.New("invalid collection ID")
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return false, errors.New("user not found")
+	}
+	if user.EmailVerified {
+		return false, errors.New("email address is already verified")
 	}
 
-	// Delete collection (and associated bookmarks due to foreign key constraint)
-	result := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).Delete(&models.Collection{})
-	if result.Error != nil {
-		return false, result.Error
+	if err := r.EmailVerificationService.Send(ctx, &user); err != nil {
+		return false, err
 	}
 
-	return result.RowsAffected > 0, nil
+	return true, nil
 }
 
-// CreateBookmark is the resolver for the createBookmark field.
-func (r *mutationResolver) CreateBookmark(ctx context.Context, input model.CreateBookmarkInput) (*model.Bookmark, error) {
+// ChangePassword is the resolver for the changePassword field.
+func (r *mutationResolver) ChangePassword(ctx context.Context, currentPassword string, newPassword string) (bool, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
-		return nil, errors.New("user not authenticated")
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return false, err
 	}
 
-	// Validate input
-	if err := utils.ValidateTitle(input.Title); err != nil {
-		return nil, err
+	if err := utils.ValidatePassword(newPassword); err != nil {
+		return false, err
 	}
-	
-	if err := utils.ValidateURL(input.URL); err != nil {
-		return nil, err
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return false, errors.New("user not found")
 	}
-	
-	if input.Description != nil {
-		if err := utils.ValidateDescription(*input.Description); err != nil {
-			return nil, err
+	if err := r.checkPassword(ctx, &user, currentPassword); err != nil {
+		return false, err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return false, errors.New("failed to process password")
+	}
+
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return err
 		}
+		// Outstanding reset links would undo the change
+		return tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return false, errors.New("failed to change password")
+	}
+
+	// Sign out other devices; whoever knew the old password may hold a session
+	if claims, ok := middleware.GetTokenClaimsFromContext(ctx); ok && claims.SessionID != "" {
+		err = r.RefreshTokenService.RevokeOtherSessions(ctx, userID, claims.SessionID)
+	} else {
+		err = r.RefreshTokenService.RevokeAllSessions(ctx, userID)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ChangeEmail is the resolver for the changeEmail field.
+func (r *mutationResolver) ChangeEmail(ctx context.Context, newEmail string, password string) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return false, err
+	}
+
+	if err := utils.ValidateEmail(newEmail); err != nil {
+		return false, errors.New("invalid email format")
+	}
+	email := strings.ToLower(strings.TrimSpace(newEmail))
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return false, errors.New("user not found")
+	}
+	if email == user.Email {
+		return false, errors.New("this is already your email address")
+	}
+	if err := r.checkPassword(ctx, &user, password); err != nil {
+		return false, err
+	}
+
+	if err := r.EmailVerificationService.RequestChange(ctx, &user, email); err != nil {
+		if errors.Is(err, services.ErrEmailInUse) {
+			return false, err
+		}
+		log.Printf("Failed to request email change: %v", err)
+		return false, errors.New("failed to change email")
+	}
+
+	return true, nil
+}
+
+// ChangeUsername is the resolver for the changeUsername field.
+func (r *mutationResolver) ChangeUsername(ctx context.Context, username string) (*model.User, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+
+	// Validate and sanitize as at registration
+	if err := utils.ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	username = utils.SanitizeString(username)
+
+	// Check if the username is taken
+	var existingUser models.User
+	if err := r.DB.Where("username = ? AND id <> ?", username, userID).First(&existingUser).Error; err == nil {
+		return nil, errors.New("username is already taken")
+	}
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if err := r.DB.Model(&user).Update("username", username).Error; err != nil {
+		return nil, errors.New("failed to change username")
+	}
+
+	return toGraphQLUser(&user), nil
+}
+
+// CreateAPIToken is the resolver for the createApiToken field.
+func (r *mutationResolver) CreateAPIToken(ctx context.Context, input model.CreateAPITokenInput) (*model.CreatedAPIToken, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.requireVerifiedEmail(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresAt != nil {
+		parsed, err := time.Parse(time.RFC3339, *input.ExpiresAt)
+		if err != nil {
+			return nil, errors.New("invalid expiry, expected an RFC 3339 timestamp")
+		}
+		expiresAt = &parsed
+	}
+
+	token, apiToken, err := r.APITokenService.Create(ctx, userID, utils.SanitizeString(input.Name), input.Scopes, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.CreatedAPIToken{
+		Token:    token,
+		APIToken: toGraphQLAPIToken(apiToken),
+	}, nil
+}
+
+// RevokeAPIToken is the resolver for the revokeApiToken field.
+func (r *mutationResolver) RevokeAPIToken(ctx context.Context, id string) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return false, err
+	}
+
+	tokenID, err := parseID(id)
+	if err != nil {
+		return false, errors.New("invalid token ID")
+	}
+
+	if err := r.APITokenService.Revoke(ctx, userID, tokenID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return false, err
+	}
+
+	sessionID, err := parseID(id)
+	if err != nil {
+		return false, errors.New("invalid session ID")
+	}
+
+	// Access tokens for the session stop working with it
+	if err := r.RefreshTokenService.RevokeSessionByID(ctx, userID, sessionID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RevokeAllOtherSessions is the resolver for the revokeAllOtherSessions field.
+func (r *mutationResolver) RevokeAllOtherSessions(ctx context.Context) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return false, err
+	}
+
+	claims, ok := middleware.GetTokenClaimsFromContext(ctx)
+	if !ok || claims.SessionID == "" {
+		return false, errors.New("user not authenticated")
+	}
+
+	if err := r.RefreshTokenService.RevokeOtherSessions(ctx, userID, claims.SessionID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// VerifyTotp is the resolver for the verifyTotp field.
+func (r *mutationResolver) VerifyTotp(ctx context.Context, challengeToken string, code string) (*model.AuthPayload, error) {
+	if strings.TrimSpace(challengeToken) == "" || strings.TrimSpace(code) == "" {
+		return nil, errors.New("challenge token and code are required")
+	}
+
+	userID, err := r.TOTPService.ChallengeUser(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	err = r.checkTOTPCode(ctx, &user, func() error {
+		_, err := r.TOTPService.CompleteChallenge(ctx, challengeToken, code)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.LoginThrottleService.RecordSuccess(ctx, user.Email); err != nil {
+		log.Printf("Failed to clear login attempts: %v", err)
+	}
+
+	// Start a session and issue its tokens
+	return r.issueAuthPayload(ctx, &user)
+}
+
+// BeginTotpEnrollment is the resolver for the beginTotpEnrollment field.
+func (r *mutationResolver) BeginTotpEnrollment(ctx context.Context) (*model.TotpEnrollment, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	enrollment, err := r.TOTPService.BeginEnrollment(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.TotpEnrollment{
+		Secret:     enrollment.Secret,
+		OtpauthURI: enrollment.OTPAuthURI,
+	}, nil
+}
+
+// ConfirmTotp is the resolver for the confirmTotp field.
+func (r *mutationResolver) ConfirmTotp(ctx context.Context, code string) ([]string, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	var codes []string
+	err := r.checkTOTPCode(ctx, &user, func() error {
+		var err error
+		codes, err = r.TOTPService.Confirm(ctx, userID, code)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTotp is the resolver for the disableTotp field.
+func (r *mutationResolver) DisableTotp(ctx context.Context, code string) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return false, err
+	}
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return false, errors.New("user not found")
+	}
+
+	err := r.checkTOTPCode(ctx, &user, func() error {
+		return r.TOTPService.Disable(ctx, userID, code)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteAccount is the resolver for the deleteAccount field.
+func (r *mutationResolver) DeleteAccount(ctx context.Context, password string) (*model.AccountDeletion, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if err := r.checkPassword(ctx, &user, password); err != nil {
+		return nil, err
+	}
+
+	// Sign out everywhere first, whether the account is purged now or waits
+	// for the grace period to end
+	if err := r.RefreshTokenService.RevokeAllSessions(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	purgeAt, err := r.AccountService.Delete(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to delete account %d: %v", userID, err)
+		return nil, errors.New("failed to delete account")
+	}
+
+	result := &model.AccountDeletion{}
+	if purgeAt != nil {
+		formatted := purgeAt.Format(time.RFC3339)
+		result.PurgeAt = &formatted
+	}
+
+	return result, nil
+}
+
+// CreateCollection is the resolver for the createCollection field.
+func (r *mutationResolver) CreateCollection(ctx context.Context, input model.CreateCollectionInput) (*model.Collection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	// Validate input
+	if err := utils.ValidateCollectionName(input.Name); err != nil {
+		return nil, err
+	}
+
+	if err := utils.ValidateDescription(*input.Description); err != nil {
+		return nil, err
+	}
+
+	if err := utils.ValidateColor(*input.Color); err != nil {
+		return nil, err
+	}
+
+	// Sanitize input
+	name := utils.SanitizeString(input.Name)
+	description := utils.SanitizeString(*input.Description)
+
+	// Create collection
+	collection := models.Collection{
+		Name:        name,
+		Description: &description,
+		Color:       input.Color,
+		UserID:      userID,
+	}
+
+	if input.ParentID != nil {
+		parentID, err := parseID(*input.ParentID)
+		if err != nil {
+			return nil, errors.New("invalid parent collection ID")
+		}
+		if err := findParentCollection(r.DB, userID, parentID); err != nil {
+			return nil, err
+		}
+		collection.ParentID = &parentID
+	}
+
+	if err := r.DB.Create(&collection).Error; err != nil {
+		return nil, err
+	}
+
+	return toGraphQLCollection(&collection), nil
+}
+
+// UpdateCollection is the resolver for the updateCollection field.
+func (r *mutationResolver) UpdateCollection(ctx context.Context, id string, input model.UpdateCollectionInput) (*model.Collection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	// Parse collection ID
+	collectionID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	// Find collection
+	var collection models.Collection
+	if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
+		return nil, errors.New("collection not found")
+	}
+
+	// Update fields
+	if input.Name != nil {
+		collection.Name = *input.Name
+	}
+	if input.Description != nil {
+		collection.Description = input.Description
+	}
+	if input.Color != nil {
+		collection.Color = input.Color
+	}
+
+	if err := r.DB.Save(&collection).Error; err != nil {
+		return nil, err
+	}
+
+	return toGraphQLCollection(&collection), nil
+}
+
+// DeleteCollection is the resolver for the deleteCollection field.
+func (r *mutationResolver) DeleteCollection(ctx context.Context, id string, strategy model.DeleteCollectionStrategy, moveToCollectionID *string) (*model.CollectionDeletion, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	// Parse collection ID
+	collectionID, err := parseID(id)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	var targetID *uint
+	if moveToCollectionID != nil {
+		parsed, err := parseID(*moveToCollectionID)
+		if err != nil {
+			return nil, errors.New("invalid target collection ID")
+		}
+		targetID = &parsed
+	}
+
+	return r.deleteCollection(ctx, userID, collectionID, strategy, targetID)
+}
+
+// MoveCollection is the resolver for the moveCollection field.
+func (r *mutationResolver) MoveCollection(ctx context.Context, id string, parentID *string) (*model.Collection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	collectionID, err := parseID(id)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	var parent *uint
+	if parentID != nil {
+		parsed, err := parseID(*parentID)
+		if err != nil {
+			return nil, errors.New("invalid parent collection ID")
+		}
+		parent = &parsed
+	}
+
+	collection, err := moveCollection(r.DB, userID, collectionID, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGraphQLCollection(collection), nil
+}
+
+// CreateSmartCollection is the resolver for the createSmartCollection field.
+func (r *mutationResolver) CreateSmartCollection(ctx context.Context, input model.CreateSmartCollectionInput) (*model.SmartCollection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	// Validate input
+	if err := utils.ValidateCollectionName(input.Name); err != nil {
+		return nil, err
+	}
+	if input.Description != nil {
+		if err := utils.ValidateDescription(*input.Description); err != nil {
+			return nil, err
+		}
+	}
+	if input.Color != nil {
+		if err := utils.ValidateColor(*input.Color); err != nil {
+			return nil, err
+		}
+	}
+
+	collection := models.SmartCollection{
+		Name:   utils.SanitizeString(input.Name),
+		Color:  input.Color,
+		UserID: userID,
+	}
+	if input.Description != nil {
+		description := utils.SanitizeString(*input.Description)
+		collection.Description = &description
+	}
+	if err := setSmartCollectionFilter(r.DB, userID, &collection, input.Filter); err != nil {
+		return nil, err
+	}
+
+	if err := r.DB.Create(&collection).Error; err != nil {
+		return nil, err
+	}
+
+	return toGraphQLSmartCollection(&collection), nil
+}
+
+// UpdateSmartCollection is the resolver for the updateSmartCollection field.
+func (r *mutationResolver) UpdateSmartCollection(ctx context.Context, id string, input model.UpdateSmartCollectionInput) (*model.SmartCollection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	collectionID, err := parseID(id)
+	if err != nil {
+		return nil, errors.New("invalid smart collection ID")
+	}
+
+	var collection models.SmartCollection
+	if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
+		return nil, errors.New("smart collection not found")
+	}
+
+	// Update fields
+	if input.Name != nil {
+		if err := utils.ValidateCollectionName(*input.Name); err != nil {
+			return nil, err
+		}
+		collection.Name = utils.SanitizeString(*input.Name)
+	}
+	if input.Description != nil {
+		if err := utils.ValidateDescription(*input.Description); err != nil {
+			return nil, err
+		}
+		description := utils.SanitizeString(*input.Description)
+		collection.Description = &description
+	}
+	if input.Color != nil {
+		if err := utils.ValidateColor(*input.Color); err != nil {
+			return nil, err
+		}
+		collection.Color = input.Color
+	}
+	if input.Filter != nil {
+		if err := setSmartCollectionFilter(r.DB, userID, &collection, input.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.DB.Save(&collection).Error; err != nil {
+		return nil, err
+	}
+
+	return toGraphQLSmartCollection(&collection), nil
+}
+
+// DeleteSmartCollection is the resolver for the deleteSmartCollection field.
+func (r *mutationResolver) DeleteSmartCollection(ctx context.Context, id string) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return false, err
+	}
+
+	collectionID, err := parseID(id)
+	if err != nil {
+		return false, errors.New("invalid smart collection ID")
+	}
+
+	result := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).Delete(&models.SmartCollection{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// CreateBookmark is the resolver for the createBookmark field.
+func (r *mutationResolver) CreateBookmark(ctx context.Context, input model.CreateBookmarkInput) (*model.Bookmark, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	// Validate input
+	if err := utils.ValidateTitle(input.Title); err != nil {
+		return nil, err
+	}
+
+	if err := utils.ValidateURL(input.URL); err != nil {
+		return nil, err
+	}
+
+	if input.Description != nil {
+		if err := utils.ValidateDescription(*input.Description); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.Notes != nil {
+		if err := utils.ValidateNotes(*input.Notes); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.Tags != nil {
+		if err := utils.ValidateTags(input.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	// Parse collection ID
+	collectionID, err := strconv.ParseUint(input.CollectionID, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	// Verify collection belongs to user
+	var collection models.Collection
+	if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
+		return nil, errors.New("collection not found")
+	}
+
+	// Sanitize input
+	title := utils.SanitizeString(input.Title)
+	url := strings.TrimSpace(input.URL)
+
+	var description *string
+	if input.Description != nil {
+		sanitized := utils.SanitizeString(*input.Description)
+		description = &sanitized
+	}
+
+	var notes *string
+	if input.Notes != nil {
+		sanitized := utils.SanitizeString(*input.Notes)
+		notes = &sanitized
+	}
+
+	var tags []string
+	if input.Tags != nil {
+		tags = utils.SanitizeTags(input.Tags)
+	}
+
+	// Create bookmark
+	bookmark := models.Bookmark{
+		Title:        title,
+		URL:          url,
+		Description:  description,
+		Notes:        notes,
+		Tags:         tags,
+		CollectionID: uint(collectionID),
+		UserID:       userID,
+	}
+	if err := r.normalizeBookmarkURL(&bookmark); err != nil {
+		return nil, err
+	}
+
+	err = r.saveBookmarkURL(&bookmark, func(tx *gorm.DB) error {
+		if err := tx.Create(&bookmark).Error; err != nil {
+			return err
+		}
+		return r.TagService.LinkTags(tx, &bookmark)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Capture images asynchronously (non-blocking)
+	go func() {
+		if r.ImageCaptureService != nil {
+			result := r.ImageCaptureService.CaptureImages(input.URL)
+
+			// Update bookmark with captured images
+			updateData := map[string]interface{}{}
+			if result.FaviconURL != nil {
+				updateData["favicon"] = *result.FaviconURL
+			}
+			if result.ScreenshotURL != nil {
+				updateData["screenshot"] = *result.ScreenshotURL
+			}
+
+			if len(updateData) > 0 {
+				r.DB.Model(&bookmark).Updates(updateData)
+			}
+		}
+	}()
+
+	return toGraphQLBookmark(&bookmark), nil
+}
+
+// UpdateBookmark is the resolver for the updateBookmark field.
+func (r *mutationResolver) UpdateBookmark(ctx context.Context, id string, input model.UpdateBookmarkInput) (*model.Bookmark, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	// Parse bookmark ID
+	bookmarkID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid bookmark ID")
+	}
+
+	// Find bookmark
+	var bookmark models.Bookmark
+	if err := r.DB.Where("id = ? AND user_id = ?", bookmarkID, userID).First(&bookmark).Error; err != nil {
+		return nil, errors.New("bookmark not found")
+	}
+
+	// Update fields
+	if input.Title != nil {
+		bookmark.Title = *input.Title
+	}
+	urlChanged := false
+	if input.URL != nil {
+		if err := utils.ValidateURL(*input.URL); err != nil {
+			return nil, err
+		}
+		url := strings.TrimSpace(*input.URL)
+		urlChanged = url != bookmark.URL
+		bookmark.URL = url
+	}
+	if input.Description != nil {
+		bookmark.Description = input.Description
+	}
+	if input.Notes != nil {
+		bookmark.Notes = input.Notes
+	}
+	if input.Tags != nil {
+		if err := utils.ValidateTags(input.Tags); err != nil {
+			return nil, err
+		}
+		bookmark.Tags = utils.SanitizeTags(input.Tags)
+	}
+	if input.CollectionID != nil {
+		collectionID, err := strconv.ParseUint(*input.CollectionID, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid collection ID")
+		}
+		// Verify collection belongs to user
+		var collection models.Collection
+		if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
+			return nil, errors.New("collection not found")
+		}
+		bookmark.CollectionID = uint(collectionID)
+	}
+
+	save := func(tx *gorm.DB) error {
+		if err := tx.Save(&bookmark).Error; err != nil {
+			return err
+		}
+		if input.Tags == nil {
+			return nil
+		}
+		return r.TagService.LinkTags(tx, &bookmark)
+	}
+	if urlChanged {
+		if err := r.normalizeBookmarkURL(&bookmark); err != nil {
+			return nil, err
+		}
+		err = r.saveBookmarkURL(&bookmark, save)
+	} else {
+		err = r.DB.Transaction(save)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toGraphQLBookmark(&bookmark), nil
+}
+
+// DeleteBookmark is the resolver for the deleteBookmark field.
+func (r *mutationResolver) DeleteBookmark(ctx context.Context, id string) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return false, err
+	}
+
+	// Parse bookmark ID
+	bookmarkID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return false, errors.New("invalid bookmark ID")
+	}
+
+	// Move bookmark to the trash
+	return r.TrashService.TrashBookmark(ctx, userID, uint(bookmarkID))
+}
+
+// RestoreBookmark is the resolver for the restoreBookmark field.
+func (r *mutationResolver) RestoreBookmark(ctx context.Context, id string) (*model.Bookmark, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	bookmarkID, err := parseID(id)
+	if err != nil {
+		return nil, errors.New("invalid bookmark ID")
+	}
+
+	bookmark, err := r.TrashService.RestoreBookmark(ctx, userID, bookmarkID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGraphQLBookmark(bookmark), nil
+}
+
+// RestoreCollection is the resolver for the restoreCollection field.
+func (r *mutationResolver) RestoreCollection(ctx context.Context, id string) (*model.Collection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	collectionID, err := parseID(id)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	collection, err := r.TrashService.RestoreCollection(ctx, userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGraphQLCollection(collection), nil
+}
+
+// EmptyTrash is the resolver for the emptyTrash field.
+func (r *mutationResolver) EmptyTrash(ctx context.Context) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return false, err
+	}
+
+	if err := r.TrashService.Empty(ctx, userID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// MergeBookmarks is the resolver for the mergeBookmarks field.
+func (r *mutationResolver) MergeBookmarks(ctx context.Context, targetID string, sourceIds []string) (*model.Bookmark, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	target, err := parseID(targetID)
+	if err != nil {
+		return nil, errors.New("invalid bookmark ID")
+	}
+	if len(sourceIds) == 0 {
+		return nil, errors.New("at least one source bookmark is required")
+	}
+	sources := make([]uint, len(sourceIds))
+	for i, id := range sourceIds {
+		if sources[i], err = parseID(id); err != nil {
+			return nil, errors.New("invalid bookmark ID")
+		}
+	}
+
+	bookmark, err := r.DuplicateService.Merge(ctx, userID, target, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGraphQLBookmark(bookmark), nil
+}
+
+// RenameTag is the resolver for the renameTag field.
+func (r *mutationResolver) RenameTag(ctx context.Context, id string, name string) (*model.Tag, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	tagID, err := parseID(id)
+	if err != nil {
+		return nil, errors.New("invalid tag ID")
+	}
+
+	if err := utils.ValidateTags([]string{name}); err != nil {
+		return nil, err
+	}
+	sanitized := utils.SanitizeTags([]string{name})
+	if len(sanitized) == 0 {
+		return nil, errors.New("invalid tag name")
+	}
+
+	usage, err := r.TagService.Rename(ctx, userID, tagID, sanitized[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return toGraphQLTag(usage), nil
+}
+
+// MergeTags is the resolver for the mergeTags field.
+func (r *mutationResolver) MergeTags(ctx context.Context, sourceIds []string, targetID string) (*model.Tag, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	if len(sourceIds) == 0 {
+		return nil, errors.New("at least one source tag is required")
+	}
+	sourceIDs := make([]uint, len(sourceIds))
+	for i, id := range sourceIds {
+		sourceID, err := parseID(id)
+		if err != nil {
+			return nil, errors.New("invalid tag ID")
+		}
+		sourceIDs[i] = sourceID
+	}
+	targetTagID, err := parseID(targetID)
+	if err != nil {
+		return nil, errors.New("invalid tag ID")
+	}
+
+	usage, err := r.TagService.Merge(ctx, userID, sourceIDs, targetTagID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGraphQLTag(usage), nil
+}
+
+// DeleteTag is the resolver for the deleteTag field.
+func (r *mutationResolver) DeleteTag(ctx context.Context, id string) (bool, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return false, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return false, err
+	}
+
+	tagID, err := parseID(id)
+	if err != nil {
+		return false, errors.New("invalid tag ID")
+	}
+
+	if err := r.TagService.Delete(ctx, userID, tagID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ImportBookmarks is the resolver for the importBookmarks field.
+func (r *mutationResolver) ImportBookmarks(ctx context.Context, file graphql.Upload, format model.ImportFormat) (*model.ImportReport, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksWrite); err != nil {
+		return nil, err
+	}
+
+	if err := r.requireVerifiedEmail(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if format != model.ImportFormatNetscapeHTML {
+		return nil, errors.New("unsupported import format")
+	}
+
+	if file.Size > maxImportFileSize {
+		return nil, errors.New("import file is too large")
+	}
+
+	entries, err := netscape.Parse(file.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bookmark file: %w", err)
+	}
+
+	return r.importBookmarks(ctx, userID, entries)
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	// Find user
+	var user models.User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	return toGraphQLUser(&user), nil
+}
+
+// Collections is the resolver for the collections field.
+func (r *queryResolver) Collections(ctx context.Context) ([]*model.Collection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	// Find collections
+	var collections []models.Collection
+	if err := r.DB.Where("user_id = ?", userID).Find(&collections).Error; err != nil {
+		return nil, err
+	}
+
+	// Convert to GraphQL models
+	var result []*model.Collection
+	for i := range collections {
+		result = append(result, toGraphQLCollection(&collections[i]))
+	}
+
+	return result, nil
+}
+
+// Collection is the resolver for the collection field.
+func (r *queryResolver) Collection(ctx context.Context, id string) (*model.Collection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	// Parse collection ID
+	collectionID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid collection ID")
+	}
+
+	// Find collection
+	var collection models.Collection
+	if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
+		return nil, errors.New("collection not found")
+	}
+
+	return toGraphQLCollection(&collection), nil
+}
+
+// SmartCollections is the resolver for the smartCollections field.
+func (r *queryResolver) SmartCollections(ctx context.Context) ([]*model.SmartCollection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
+
+	var collections []models.SmartCollection
+	if err := r.DB.Where("user_id = ?", userID).Order("name, id").Find(&collections).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.SmartCollection, 0, len(collections))
+	for i := range collections {
+		result = append(result, toGraphQLSmartCollection(&collections[i]))
 	}
-	
-	if input.Notes != nil {
-		if err := utils.ValidateNotes(*input.Notes); err != nil {
-			return nil, err
-		}
+
+	return result, nil
+}
+
+// SmartCollection is the resolver for the smartCollection field.
+func (r *queryResolver) SmartCollection(ctx context.Context, id string) (*model.SmartCollection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
 	}
-	
-	if input.Tags != nil {
-		if err := utils.ValidateTags(*input.Tags); err != nil {
-			return nil, err
-		}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
 	}
 
-	// Parse collection ID
-	collectionID, err := strconv.ParseUint(input.CollectionID, 10, 64)
+	collectionID, err := parseID(id)
 	if err != nil {
-		return nil, errors.New("invalid collection ID")
+		return nil, errors.New("invalid smart collection ID")
 	}
 
-	// Verify collection belongs to user
-	var collection models.Collection
+	var collection models.SmartCollection
 	if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
-		return nil, errors.New("collection not found")
+		return nil, errors.New("smart collection not found")
 	}
 
-	// Sanitize input
-	title := utils.SanitizeString(input.Title)
-	url := strings.TrimSpace(input.URL)
-	
-	var description *string
-	if input.Description != nil {
-		sanitized := utils.SanitizeString(*input.Description)
-		description = &sanitized
-	}
-	
-	var notes *string
-	if input.Notes != nil {
-		sanitized := utils.SanitizeString(*input.Notes)
-		notes = &sanitized
+	return toGraphQLSmartCollection(&collection), nil
+}
+
+// Bookmarks is the resolver for the bookmarks field.
+func (r *queryResolver) Bookmarks(ctx context.Context, filter *model.BookmarkFilter, limit *int, offset *int) ([]*model.Bookmark, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
 	}
-	
-	var tags []string
-	if input.Tags != nil {
-		tags = utils.SanitizeTags(*input.Tags)
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
 	}
 
-	// Create bookmark
-	bookmark := models.Bookmark{
-		Title:        title,
-		URL:          url,
-		Description:  description,
-		Notes:        notes,
-		Tags:         tags,
-		CollectionID: uint(collectionID),
-		UserID:       userID,
-	}
+	return listBookmarks(r.DB, userID, filter, limit, offset)
+}
 
-	if err := r.DB.Create(&bookmark).Error; err != nil {
+// BookmarksConnection is the resolver for the bookmarksConnection field.
+func (r *queryResolver) BookmarksConnection(ctx context.Context, filter *model.BookmarkFilter, first *int, after *string, last *int, before *string, orderBy *model.BookmarkOrder) (*model.BookmarkConnection, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
 		return nil, err
 	}
 
-	// Capture images asynchronously (non-blocking)
-	go func() {
-		if r.ImageCaptureService != nil {
-			result := r.ImageCaptureService.CaptureImages(input.URL)
-			
-			// Update bookmark with captured images
-			updateData := map[string]interface{}{}
-			if result.FaviconURL != nil {
-				updateData["favicon"] = *result.FaviconURL
-			}
-			if result.ScreenshotURL != nil {
-				updateData["screenshot"] = *result.ScreenshotURL
-			}
-			
-			if len(updateData) > 0 {
-				r.DB.Model(&bookmark).Updates(updateData)
-			}
-		}
-	}()
+	// Build query
+	query, err := applyBookmarkFilter(r.DB.Where("user_id = ?", userID), filter)
+	if err != nil {
+		return nil, err
+	}
 
-	return &model.Bookmark{
-		ID:           strconv.FormatUint(uint64(bookmark.ID), 10),
-		Title:        bookmark.Title,
-		URL:          bookmark.URL,
-		Description:  bookmark.Description,
-		Notes:        bookmark.Notes,
-		Favicon:      bookmark.Favicon,
-		Screenshot:   bookmark.Screenshot,
-		Tags:         bookmark.Tags,
-		CollectionID: strconv.FormatUint(uint64(bookmark.CollectionID), 10),
-		UserID:       strconv.FormatUint(uint64(bookmark.UserID), 10),
-		CreatedAt:    bookmark.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:    bookmark.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	return paginateBookmarks(query, first, after, last, before, orderBy)
 }
 
-// UpdateBookmark is the resolver for the updateBookmark field.
-func (r *mutationResolver) UpdateBookmark(ctx context.Context, id string, input model.UpdateBookmarkInput) (*model.Bookmark, error) {
+// Bookmark is the resolver for the bookmark field.
+func (r *queryResolver) Bookmark(ctx context.Context, id string) (*model.Bookmark, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
 		return nil, errors.New("user not authenticated")
 	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
 
 	// Parse bookmark ID
 	bookmarkID, err := strconv.ParseUint(id, 10, 64)
@@ -367,272 +1739,296 @@ func (r *mutationResolver) UpdateBookmark(ctx context.Context, id string, input
 		return nil, errors.New("bookmark not found")
 	}
 
-	// Update fields
-	if input.Title != nil {
-		bookmark.Title = *input.Title
+	return toGraphQLBookmark(&bookmark), nil
+}
+
+// SearchBookmarks is the resolver for the searchBookmarks field.
+func (r *queryResolver) SearchBookmarks(ctx context.Context, query string, limit *int, offset *int) (*model.SearchResults, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
 	}
-	if input.URL != nil {
-		bookmark.URL = *input.URL
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
 	}
-	if input.Description != nil {
-		bookmark.Description = input.Description
+
+	return searchBookmarks(r.DB, userID, query, limit, offset)
+}
+
+// Tags is the resolver for the tags field.
+func (r *queryResolver) Tags(ctx context.Context) ([]*model.Tag, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
 	}
-	if input.Notes != nil {
-		bookmark.Notes = input.Notes
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
 	}
-	if input.Tags != nil {
-		bookmark.Tags = input.Tags
+
+	usages, err := r.TagService.List(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
-	if input.CollectionID != nil {
-		collectionID, err := strconv.ParseUint(*input.CollectionID, 10, 64)
-		if err != nil {
-			return nil, errors.New("invalid collection ID")
-		}
-		// Verify collection belongs to user
-		var collection models.Collection
-		if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
-			return nil, errors.New("collection not found")
-		}
-		bookmark.CollectionID = uint(collectionID)
+
+	tags := make([]*model.Tag, len(usages))
+	for i := range usages {
+		tags[i] = toGraphQLTag(&usages[i])
 	}
+	return tags, nil
+}
 
-	if err := r.DB.Save(&bookmark).Error; err != nil {
+// Trash is the resolver for the trash field.
+func (r *queryResolver) Trash(ctx context.Context) (*model.Trash, error) {
+	// Get user from context
+	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
+	if !ok {
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
 		return nil, err
 	}
 
-	return &model.Bookmark{
-		ID:           strconv.FormatUint(uint64(bookmark.ID), 10),
-		Title:        bookmark.Title,
-		URL:          bookmark.URL,
-		Description:  bookmark.Description,
-		Notes:        bookmark.Notes,
-		Favicon:      bookmark.Favicon,
-		Screenshot:   bookmark.Screenshot,
-		Tags:         bookmark.Tags,
-		CollectionID: strconv.FormatUint(uint64(bookmark.CollectionID), 10),
-		UserID:       strconv.FormatUint(uint64(bookmark.UserID), 10),
-		CreatedAt:    bookmark.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:    bookmark.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	collections, bookmarks, err := r.TrashService.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.Trash{
+		Collections: make([]*model.Collection, 0, len(collections)),
+		Bookmarks:   make([]*model.Bookmark, 0, len(bookmarks)),
+	}
+	for i := range collections {
+		result.Collections = append(result.Collections, toGraphQLCollection(&collections[i]))
+	}
+	for i := range bookmarks {
+		result.Bookmarks = append(result.Bookmarks, toGraphQLBookmark(&bookmarks[i]))
+	}
+
+	return result, nil
 }
 
-// DeleteBookmark is the resolver for the deleteBookmark field.
-func (r *mutationResolver) DeleteBookmark(ctx context.Context, id string) (bool, error) {
+// Duplicates is the resolver for the duplicates field.
+func (r *queryResolver) Duplicates(ctx context.Context) ([]*model.DuplicateGroup, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
-		return false, errors.New("user not authenticated")
+		return nil, errors.New("user not authenticated")
+	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
 	}
 
-	// Parse bookmark ID
-	bookmarkID, err := strconv.ParseUint(id, 10, 64)
+	groups, err := r.DuplicateService.Groups(ctx, userID)
 	if err != nil {
-		return false, errors.New("invalid bookmark ID")
+		return nil, err
 	}
 
-	// Delete bookmark
-	result := r.DB.Where("id = ? AND user_id = ?", bookmarkID, userID).Delete(&models.Bookmark{})
-	if result.Error != nil {
-		return false, result.Error
+	result := make([]*model.DuplicateGroup, 0, len(groups))
+	for _, group := range groups {
+		bookmarks := make([]*model.Bookmark, 0, len(group.Bookmarks))
+		for i := range group.Bookmarks {
+			bookmarks = append(bookmarks, toGraphQLBookmark(&group.Bookmarks[i]))
+		}
+		result = append(result, &model.DuplicateGroup{
+			NormalizedURL: group.NormalizedURL,
+			Bookmarks:     bookmarks,
+		})
 	}
 
-	return result.RowsAffected > 0, nil
+	return result, nil
 }
 
-// Me is the resolver for the me field.
-func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+// ExportBookmarks is the resolver for the exportBookmarks field.
+func (r *queryResolver) ExportBookmarks(ctx context.Context, format model.ExportFormat) (*model.ExportLink, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
 		return nil, errors.New("user not authenticated")
 	}
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
+	}
 
-	// Find user
-	var user models.User
-	if err := r.DB.First(&user, userID).Error; err != nil {
-		return nil, errors.New("user not found")
+	formats := map[model.ExportFormat]services.ExportFormat{
+		model.ExportFormatNetscapeHTML: services.ExportFormatHTML,
+		model.ExportFormatJSON:         services.ExportFormatJSON,
+		model.ExportFormatCSV:          services.ExportFormatCSV,
+	}
+	exportFormat, ok := formats[format]
+	if !ok {
+		return nil, errors.New("unsupported export format")
 	}
 
-	return &model.User{
-		ID:        strconv.FormatUint(uint64(user.ID), 10),
-		Email:     user.Email,
-		Username:  user.Username,
-		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	url, expiresAt, err := r.ExportService.DownloadURL(ctx, userID, exportFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ExportLink{
+		URL:       url,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
 	}, nil
 }
 
-// Collections is the resolver for the collections field.
-func (r *queryResolver) Collections(ctx context.Context) ([]*model.Collection, error) {
+// APITokens is the resolver for the apiTokens field.
+func (r *queryResolver) APITokens(ctx context.Context) ([]*model.APIToken, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
 		return nil, errors.New("user not authenticated")
 	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
 
-	// Find collections
-	var collections []models.Collection
-	if err := r.DB.Where("user_id = ?", userID).Find(&collections).Error; err != nil {
+	tokens, err := r.APITokenService.List(ctx, userID)
+	if err != nil {
 		return nil, err
 	}
 
-	// Convert to GraphQL models
-	var result []*model.Collection
-	for _, collection := range collections {
-		result = append(result, &model.Collection{
-			ID:          strconv.FormatUint(uint64(collection.ID), 10),
-			Name:        collection.Name,
-			Description: collection.Description,
-			Color:       collection.Color,
-			UserID:      strconv.FormatUint(uint64(collection.UserID), 10),
-			CreatedAt:   collection.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt:   collection.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+	result := make([]*model.APIToken, 0, len(tokens))
+	for i := range tokens {
+		result = append(result, toGraphQLAPIToken(&tokens[i]))
 	}
 
 	return result, nil
 }
 
-// Collection is the resolver for the collection field.
-func (r *queryResolver) Collection(ctx context.Context, id string) (*model.Collection, error) {
+// MySessions is the resolver for the mySessions field.
+func (r *queryResolver) MySessions(ctx context.Context) ([]*model.Session, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
 		return nil, errors.New("user not authenticated")
 	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
 
-	// Parse collection ID
-	collectionID, err := strconv.ParseUint(id, 10, 64)
+	sessions, err := r.RefreshTokenService.ListSessions(ctx, userID)
 	if err != nil {
-		return nil, errors.New("invalid collection ID")
+		return nil, err
 	}
 
-	// Find collection
-	var collection models.Collection
-	if err := r.DB.Where("id = ? AND user_id = ?", collectionID, userID).First(&collection).Error; err != nil {
-		return nil, errors.New("collection not found")
+	var currentSessionID string
+	if claims, ok := middleware.GetTokenClaimsFromContext(ctx); ok {
+		currentSessionID = claims.SessionID
 	}
 
-	return &model.Collection{
-		ID:          strconv.FormatUint(uint64(collection.ID), 10),
-		Name:        collection.Name,
-		Description: collection.Description,
-		Color:       collection.Color,
-		UserID:      strconv.FormatUint(uint64(collection.UserID), 10),
-		CreatedAt:   collection.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   collection.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	result := make([]*model.Session, 0, len(sessions))
+	for i := range sessions {
+		result = append(result, toGraphQLSession(&sessions[i], currentSessionID))
+	}
+
+	return result, nil
 }
 
-// Bookmarks is the resolver for the bookmarks field.
-func (r *queryResolver) Bookmarks(ctx context.Context, filter *model.BookmarkFilter, limit *int, offset *int) ([]*model.Bookmark, error) {
+// ExportMyData is the resolver for the exportMyData field.
+func (r *queryResolver) ExportMyData(ctx context.Context) (*model.ExportLink, error) {
 	// Get user from context
 	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
 	if !ok {
 		return nil, errors.New("user not authenticated")
 	}
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
 
-	// Build query
-	query := r.DB.Where("user_id = ?", userID)
-
-	// Apply filters
-	if filter != nil {
-		if filter.Search != nil {
-			searchTerm := "%" + *filter.Search + "%"
-			query = query.Where("title LIKE ? OR description LIKE ? OR notes LIKE ?", searchTerm, searchTerm, searchTerm)
-		}
-		if filter.CollectionID != nil {
-			collectionID, err := strconv.ParseUint(*filter.CollectionID, 10, 64)
-			if err != nil {
-				return nil, errors.New("invalid collection ID")
-			}
-			query = query.Where("collection_id = ?", collectionID)
-		}
-		if filter.Tags != nil && len(filter.Tags) > 0 {
-			// Search for bookmarks that contain any of the specified tags
-			for _, tag := range filter.Tags {
-				query = query.Where("JSON_CONTAINS(tags, ?)", fmt.Sprintf("\"%s\"", tag))
-			}
-		}
+	url, expiresAt, err := r.ExportService.DownloadURL(ctx, userID, services.ExportFormatArchive)
+	if err != nil {
+		return nil, err
 	}
+	return &model.ExportLink{
+		URL:       url,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// User is the resolver for the user field.
+func (r *smartCollectionResolver) User(ctx context.Context, obj *model.SmartCollection) (*model.User, error) {
+	return r.loadUser(ctx, obj.UserID)
+}
 
-	// Apply pagination
-	if limit != nil {
-		query = query.Limit(*limit)
+// Bookmarks is the resolver for the bookmarks field.
+func (r *smartCollectionResolver) Bookmarks(ctx context.Context, obj *model.SmartCollection, limit *int, offset *int) ([]*model.Bookmark, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
 	}
-	if offset != nil {
-		query = query.Offset(*offset)
+
+	userID, err := parseID(obj.UserID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
 	}
 
-	// Find bookmarks
-	var bookmarks []models.Bookmark
-	if err := query.Find(&bookmarks).Error; err != nil {
-		return nil, err
+	// Evaluated exactly as Query.bookmarks evaluates a filter
+	return listBookmarks(r.DB, userID, smartCollectionFilter(obj.Filter), limit, offset)
+}
+
+// TotpEnabled is the resolver for the totpEnabled field.
+func (r *userResolver) TotpEnabled(ctx context.Context, obj *model.User) (bool, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return false, err
 	}
 
-	// Convert to GraphQL models
-	var result []*model.Bookmark
-	for _, bookmark := range bookmarks {
-		result = append(result, &model.Bookmark{
-			ID:           strconv.FormatUint(uint64(bookmark.ID), 10),
-			Title:        bookmark.Title,
-			URL:          bookmark.URL,
-			Description:  bookmark.Description,
-			Notes:        bookmark.Notes,
-			Favicon:      bookmark.Favicon,
-			Screenshot:   bookmark.Screenshot,
-			Tags:         bookmark.Tags,
-			CollectionID: strconv.FormatUint(uint64(bookmark.CollectionID), 10),
-			UserID:       strconv.FormatUint(uint64(bookmark.UserID), 10),
-			CreatedAt:    bookmark.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt:    bookmark.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+	userID, err := parseID(obj.ID)
+	if err != nil {
+		return false, errors.New("invalid user ID")
 	}
 
-	return result, nil
+	return r.TOTPService.Enabled(ctx, userID)
 }
 
-// Bookmark is the resolver for the bookmark field.
-func (r *queryResolver) Bookmark(ctx context.Context, id string) (*model.Bookmark, error) {
-	// Get user from context
-	userID, ok := ctx.Value(middleware.UserIDKey).(uint)
-	if !ok {
-		return nil, errors.New("user not authenticated")
+// Collections is the resolver for the collections field.
+func (r *userResolver) Collections(ctx context.Context, obj *model.User) ([]*model.Collection, error) {
+	if err := requireScope(ctx, services.ScopeBookmarksRead); err != nil {
+		return nil, err
 	}
 
-	// Parse bookmark ID
-	bookmarkID, err := strconv.ParseUint(id, 10, 64)
+	l, err := r.requestLoaders(ctx)
 	if err != nil {
-		return nil, errors.New("invalid bookmark ID")
+		return nil, err
 	}
 
-	// Find bookmark
-	var bookmark models.Bookmark
-	if err := r.DB.Where("id = ? AND user_id = ?", bookmarkID, userID).First(&bookmark).Error; err != nil {
-		return nil, errors.New("bookmark not found")
+	userID, err := parseID(obj.ID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
 	}
 
-	return &model.Bookmark{
-		ID:           strconv.FormatUint(uint64(bookmark.ID), 10),
-		Title:        bookmark.Title,
-		URL:          bookmark.URL,
-		Description:  bookmark.Description,
-		Notes:        bookmark.Notes,
-		Favicon:      bookmark.Favicon,
-		Screenshot:   bookmark.Screenshot,
-		Tags:         bookmark.Tags,
-		CollectionID: strconv.FormatUint(uint64(bookmark.CollectionID), 10),
-		UserID:       strconv.FormatUint(uint64(bookmark.UserID), 10),
-		CreatedAt:    bookmark.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:    bookmark.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	collections, err := l.CollectionsByUserID.Load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Collection, 0, len(collections))
+	for i := range collections {
+		result = append(result, toGraphQLCollection(&collections[i]))
+	}
+
+	return result, nil
 }
 
+// Bookmark returns BookmarkResolver implementation.
+func (r *Resolver) Bookmark() BookmarkResolver { return &bookmarkResolver{r} }
+
+// Collection returns CollectionResolver implementation.
+func (r *Resolver) Collection() CollectionResolver { return &collectionResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// SmartCollection returns SmartCollectionResolver implementation.
+func (r *Resolver) SmartCollection() SmartCollectionResolver { return &smartCollectionResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type bookmarkResolver struct{ *Resolver }
+type collectionResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type smartCollectionResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
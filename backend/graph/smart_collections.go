@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/graph/model"
+	"markly-backend/internal/models"
+	"markly-backend/internal/search"
+	"markly-backend/internal/utils"
+)
+
+// setSmartCollectionFilter validates filter and stores it in collection,
+// replacing the previous filter as a whole
+func setSmartCollectionFilter(db *gorm.DB, userID uint, collection *models.SmartCollection, filter *model.BookmarkFilter) error {
+	collection.Search = nil
+	collection.Tags = nil
+	collection.CollectionID = nil
+	collection.IncludeDescendants = false
+	collection.Domain = nil
+	collection.CreatedAfter = nil
+	collection.CreatedBefore = nil
+
+	if filter.Search != nil {
+		if query := strings.TrimSpace(*filter.Search); query != "" {
+			if err := utils.ValidateSearch(query); err != nil {
+				return err
+			}
+			// Catch what would otherwise fail every time the collection is read
+			if _, err := search.Parse(query); err != nil {
+				return err
+			}
+			collection.Search = &query
+		}
+	}
+
+	if len(filter.Tags) > 0 {
+		if err := utils.ValidateTags(filter.Tags); err != nil {
+			return err
+		}
+		collection.Tags = utils.SanitizeTags(filter.Tags)
+	}
+
+	if filter.CollectionID != nil {
+		collectionID, err := parseID(*filter.CollectionID)
+		if err != nil {
+			return errors.New("invalid collection ID")
+		}
+		var count int64
+		if err := db.Model(&models.Collection{}).Where("id = ? AND user_id = ?", collectionID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("collection not found")
+		}
+		collection.CollectionID = &collectionID
+		collection.IncludeDescendants = filter.IncludeDescendants != nil && *filter.IncludeDescendants
+	}
+
+	if filter.Domain != nil {
+		if host := search.SiteHost(*filter.Domain); host != "" {
+			if len(host) > 255 {
+				return errors.New("domain is too long")
+			}
+			collection.Domain = &host
+		}
+	}
+
+	if filter.CreatedAfter != nil {
+		after, err := time.Parse(time.RFC3339, *filter.CreatedAfter)
+		if err != nil {
+			return errors.New("invalid createdAfter timestamp")
+		}
+		collection.CreatedAfter = &after
+	}
+	if filter.CreatedBefore != nil {
+		before, err := time.Parse(time.RFC3339, *filter.CreatedBefore)
+		if err != nil {
+			return errors.New("invalid createdBefore timestamp")
+		}
+		collection.CreatedBefore = &before
+	}
+
+	return nil
+}
+
+// smartCollectionFilter returns the stored filter of a smart collection in
+// the form BookmarkFilter takes it
+func smartCollectionFilter(filter *model.SmartCollectionFilter) *model.BookmarkFilter {
+	if filter == nil {
+		return nil
+	}
+	return &model.BookmarkFilter{
+		Search:             filter.Search,
+		Tags:               filter.Tags,
+		CollectionID:       filter.CollectionID,
+		IncludeDescendants: &filter.IncludeDescendants,
+		CreatedAfter:       filter.CreatedAfter,
+		CreatedBefore:      filter.CreatedBefore,
+		Domain:             filter.Domain,
+	}
+}
+
+// toGraphQLSmartCollection converts a database smart collection into its
+// GraphQL representation
+func toGraphQLSmartCollection(collection *models.SmartCollection) *model.SmartCollection {
+	filter := &model.SmartCollectionFilter{
+		Search:             collection.Search,
+		Tags:               collection.Tags,
+		CollectionID:       formatOptionalID(collection.CollectionID),
+		IncludeDescendants: collection.IncludeDescendants,
+		Domain:             collection.Domain,
+	}
+	if collection.CreatedAfter != nil {
+		after := collection.CreatedAfter.Format(time.RFC3339Nano)
+		filter.CreatedAfter = &after
+	}
+	if collection.CreatedBefore != nil {
+		before := collection.CreatedBefore.Format(time.RFC3339Nano)
+		filter.CreatedBefore = &before
+	}
+
+	return &model.SmartCollection{
+		ID:          strconv.FormatUint(uint64(collection.ID), 10),
+		Name:        collection.Name,
+		Description: collection.Description,
+		Color:       collection.Color,
+		Filter:      filter,
+		UserID:      strconv.FormatUint(uint64(collection.UserID), 10),
+		CreatedAt:   collection.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   collection.UpdatedAt.Format(time.RFC3339),
+	}
+}
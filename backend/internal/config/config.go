@@ -1,76 +1,229 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"strconv"
+	"strings"
 )
 
+// DefaultJWTSecret is the placeholder secret used when JWT_SECRET is unset.
+// It is public, so the server refuses to use it in production.
+const DefaultJWTSecret = "your-super-secret-jwt-key-change-in-production"
+
+// placeholderJWTSecrets are the sample secrets shipped in the example env files
+var placeholderJWTSecrets = map[string]bool{
+	DefaultJWTSecret: true,
+	"your-super-secret-jwt-key-change-this-in-production":               true,
+	"change-this-to-a-strong-random-string-at-least-32-characters-long": true,
+}
+
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	JWT      JWTConfig
-	Security SecurityConfig
+	Environment string
+	Database    DatabaseConfig
+	Server      ServerConfig
+	JWT         JWTConfig
+	Security    SecurityConfig
+	Mail        MailConfig
+	OIDC        OIDCConfig
 }
 
 type DatabaseConfig struct {
+	// Driver is "mysql", "postgres" or "sqlite"
+	Driver string
+	// Path is the SQLite database file, or ":memory:" for a database that
+	// lives as long as the process
+	Path     string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Name     string
+	// SSLMode is passed to Postgres as sslmode
+	SSLMode string
+	// MigrateOnStart applies pending schema migrations when the server
+	// starts; without it the server refuses to start until they are applied
+	MigrateOnStart bool
+	// MigrationLockTimeout bounds how long to wait for another instance
+	// that is already migrating
+	MigrationLockTimeout string
 }
 
 type ServerConfig struct {
-	Port string
+	Port      string
+	PublicURL string
+	// AppURL is where the frontend is served; links in emails point there
+	AppURL string
 }
 
 type JWTConfig struct {
-	Secret string
-	Expiry string
+	Secret        string
+	KeyID         string
+	Expiry        string
+	RefreshExpiry string
+	Issuer        string
+	Audience      string
+	// VerificationKeys maps key IDs to secrets that are still accepted for
+	// verification, typically the previous signing key during a rotation
+	VerificationKeys map[string]string
 }
 
 type SecurityConfig struct {
-	BcryptCost           int
-	MaxLoginAttempts     int
-	LoginAttemptWindow   string
-	PasswordMinLength    int
-	JWTExpiryHours       int
-	RateLimitPerMinute   int
-	MaxRequestSizeBytes  int64
-	RequestTimeoutSec    int
-	CSRFTokenLength      int
-	SessionTimeoutMin    int
+	BcryptCost          int
+	MaxLoginAttempts    int
+	LoginAttemptWindow  string
+	PasswordMinLength   int
+	JWTExpiryHours      int
+	RateLimitPerMinute  int
+	MaxRequestSizeBytes int64
+	RequestTimeoutSec   int
+	CSRFTokenLength     int
+	SessionTimeoutMin   int
+	PasswordResetExpiry string
+	// RequireEmailVerification keeps unverified accounts from importing
+	// bookmarks or creating personal access tokens until they confirm
+	// their address
+	RequireEmailVerification bool
+	EmailVerificationExpiry  string
+	// AccountDeletionGracePeriod delays purging a deleted account so it can
+	// be restored by signing in again; zero purges it immediately
+	AccountDeletionGracePeriod string
+	// TrashRetention is how long deleted bookmarks and collections stay in
+	// the trash before they are purged; zero keeps them until it is emptied
+	TrashRetention string
+	// TrustedProxies lists the addresses and CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers identify the client
+	TrustedProxies []string
+}
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider.
+// It is disabled while IssuerURL is empty.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is this server's callback, registered with the provider
+	RedirectURL string
+	Scopes      []string
+}
+
+// Enabled reports whether an identity provider is configured
+func (c *OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
+// MailConfig selects how outgoing mail is delivered. Without an SMTP host,
+// messages are written to Dir, or to the log when Dir is empty too.
+type MailConfig struct {
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
 }
 
 func Load() *Config {
 	return &Config{
+		Environment: getEnv("ENVIRONMENT", "development"),
 		Database: DatabaseConfig{
+			Driver:   getEnv("DB_DRIVER", "mysql"),
+			Path:     getEnv("DB_PATH", "markly.db"),
 			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "3306"),
+			Port:     getEnv("DB_PORT", defaultDBPort(getEnv("DB_DRIVER", "mysql"))),
 			User:     getEnv("DB_USER", "markly"),
 			Password: getEnv("DB_PASSWORD", "marklypassword"),
 			Name:     getEnv("DB_NAME", "markly"),
+			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			MigrateOnStart:       getEnvAsBool("MIGRATE_ON_START", true),
+			MigrationLockTimeout: getEnv("MIGRATION_LOCK_TIMEOUT", "1m"),
 		},
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
+			Port:      getEnv("SERVER_PORT", "8080"),
+			PublicURL: getEnv("PUBLIC_URL", "http://localhost:"+getEnv("SERVER_PORT", "8080")),
+			AppURL:    getEnv("APP_URL", "http://localhost:3000"),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
-			Expiry: getEnv("JWT_EXPIRY", "24h"),
+			Secret:           getEnv("JWT_SECRET", DefaultJWTSecret),
+			KeyID:            getEnv("JWT_KEY_ID", "primary"),
+			Expiry:           getEnv("JWT_EXPIRY", "15m"),
+			RefreshExpiry:    getEnv("JWT_REFRESH_EXPIRY", "720h"),
+			Issuer:           getEnv("JWT_ISSUER", "markly"),
+			Audience:         getEnv("JWT_AUDIENCE", "markly-frontend"),
+			VerificationKeys: getEnvAsMap("JWT_VERIFICATION_KEYS"),
 		},
 		Security: SecurityConfig{
-			BcryptCost:          getEnvAsInt("BCRYPT_COST", 12),
-			MaxLoginAttempts:    getEnvAsInt("MAX_LOGIN_ATTEMPTS", 5),
-			LoginAttemptWindow:  getEnv("LOGIN_ATTEMPT_WINDOW", "15m"),
-			PasswordMinLength:   getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
-			JWTExpiryHours:      getEnvAsInt("JWT_EXPIRY_HOURS", 24),
-			RateLimitPerMinute:  getEnvAsInt("RATE_LIMIT_PER_MINUTE", 100),
-			MaxRequestSizeBytes: int64(getEnvAsInt("MAX_REQUEST_SIZE_MB", 10)) << 20,
-			RequestTimeoutSec:   getEnvAsInt("REQUEST_TIMEOUT_SEC", 30),
-			CSRFTokenLength:     getEnvAsInt("CSRF_TOKEN_LENGTH", 32),
-			SessionTimeoutMin:   getEnvAsInt("SESSION_TIMEOUT_MIN", 30),
+			BcryptCost:                 getEnvAsInt("BCRYPT_COST", 12),
+			MaxLoginAttempts:           getEnvAsInt("MAX_LOGIN_ATTEMPTS", 5),
+			LoginAttemptWindow:         getEnv("LOGIN_ATTEMPT_WINDOW", "15m"),
+			PasswordMinLength:          getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+			JWTExpiryHours:             getEnvAsInt("JWT_EXPIRY_HOURS", 24),
+			RateLimitPerMinute:         getEnvAsInt("RATE_LIMIT_PER_MINUTE", 100),
+			MaxRequestSizeBytes:        int64(getEnvAsInt("MAX_REQUEST_SIZE_MB", 10)) << 20,
+			RequestTimeoutSec:          getEnvAsInt("REQUEST_TIMEOUT_SEC", 30),
+			CSRFTokenLength:            getEnvAsInt("CSRF_TOKEN_LENGTH", 32),
+			SessionTimeoutMin:          getEnvAsInt("SESSION_TIMEOUT_MIN", 30),
+			PasswordResetExpiry:        getEnv("PASSWORD_RESET_EXPIRY", "1h"),
+			RequireEmailVerification:   getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+			EmailVerificationExpiry:    getEnv("EMAIL_VERIFICATION_EXPIRY", "48h"),
+			AccountDeletionGracePeriod: getEnv("ACCOUNT_DELETION_GRACE_PERIOD", "0s"),
+			TrashRetention:             getEnv("TRASH_RETENTION", "720h"),
+			TrustedProxies:             getEnvAsList("TRUSTED_PROXIES"),
 		},
+		OIDC: OIDCConfig{
+			IssuerURL:    getEnv("OIDC_ISSUER_URL", ""),
+			ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", getEnv("PUBLIC_URL", "http://localhost:"+getEnv("SERVER_PORT", "8080"))+"/auth/oidc/callback"),
+			Scopes:       strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+		},
+		Mail: MailConfig{
+			From:         getEnv("FROM_EMAIL", "noreply@markly.app"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USER", ""),
+			SMTPPassword: getEnv("SMTP_PASS", ""),
+			Dir:          getEnv("MAIL_DIR", ""),
+		},
+	}
+}
+
+// Validate rejects configurations that are unsafe to run with
+func (c *Config) Validate() error {
+	if c.Environment == "production" && c.UsesPlaceholderJWTSecret() {
+		return errors.New("JWT_SECRET must be set to a private value in production")
+	}
+	if len(c.JWT.Secret) < 32 {
+		return errors.New("JWT_SECRET must be at least 32 characters long")
+	}
+	switch c.Database.Driver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		return errors.New("DB_DRIVER must be mysql, postgres or sqlite")
+	}
+	if c.OIDC.Enabled() && c.OIDC.ClientID == "" {
+		return errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+	}
+	for kid, secret := range c.JWT.VerificationKeys {
+		if len(secret) < 32 {
+			return errors.New("JWT verification key " + kid + " must be at least 32 characters long")
+		}
 	}
+	return nil
+}
+
+// UsesPlaceholderJWTSecret reports whether the JWT secret is a publicly known sample value
+func (c *Config) UsesPlaceholderJWTSecret() bool {
+	return placeholderJWTSecrets[c.JWT.Secret]
+}
+
+// defaultDBPort is the usual port of the database server for driver
+func defaultDBPort(driver string) string {
+	if driver == "postgres" {
+		return "5432"
+	}
+	return "3306"
 }
 
 func getEnv(key, defaultValue string) string {
@@ -87,4 +240,36 @@ func getEnvAsInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsList parses a comma-separated list
+func getEnvAsList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvAsMap parses a comma-separated list of key:value pairs
+func getEnvAsMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && k != "" && v != "" {
+			result[k] = v
+		}
+	}
+	return result
+}
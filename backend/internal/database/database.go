@@ -1,37 +1,39 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"time"
 
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
 	"markly-backend/internal/config"
-	"markly-backend/internal/models"
 )
 
+// Connect opens the database, retrying while it starts up. The schema is
+// managed separately by Migrator.
 func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.Name,
-	)
+	dialector, err := openDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Retry connection with exponential backoff
 	var db *gorm.DB
-	var err error
 	maxRetries := 10
 	baseDelay := 1 * time.Second
 
 	for i := 0; i < maxRetries; i++ {
 		log.Printf("Attempting database connection (attempt %d/%d)...", i+1, maxRetries)
 		
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
+		db, err = gorm.Open(dialector, &gorm.Config{
 			Logger: logger.Default.LogMode(logger.Info),
 		})
 		
@@ -61,20 +63,70 @@ func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", maxRetries, err)
 	}
 
-	// Auto migrate the schema
-	log.Println("Running database migrations...")
-	if err := db.AutoMigrate(
-		&models.User{},
-		&models.Collection{},
-		&models.Bookmark{},
-	); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	if cfg.Driver == "sqlite" && cfg.Path == ":memory:" {
+		// Every connection to :memory: opens a database of its own
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
+	if cfg.Driver == "sqlite" {
+		// Search needs FTS5, which the driver only includes when built with
+		// the sqlite_fts5 tag
+		var fts5 int
+		if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+			return nil, err
+		}
+		if fts5 == 0 {
+			return nil, ErrSQLiteWithoutFTS5
+		}
 	}
 
-	log.Println("Database connected and migrated successfully")
 	return db, nil
 }
 
+// openDialector picks the GORM driver for cfg.Driver
+func openDialector(cfg *config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case "mysql", "":
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			cfg.User,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.Name,
+		)
+		return mysql.Open(dsn), nil
+	case "postgres":
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, cfg.Password),
+			Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+			Path:     "/" + cfg.Name,
+			RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+		}
+		return postgres.Open(dsn.String()), nil
+	case "sqlite":
+		// Foreign keys are off by default in SQLite. WAL lets reads go on
+		// during a write, and taking the write lock when a transaction
+		// begins avoids deadlocks between two transactions upgrading theirs.
+		params := "_foreign_keys=on&_busy_timeout=5000"
+		if cfg.Path == ":memory:" {
+			return sqlite.Open("file::memory:?" + params), nil
+		}
+		return sqlite.Open("file:" + cfg.Path + "?" + params + "&_journal_mode=WAL&_txlock=immediate"), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+}
+
+// ErrSQLiteWithoutFTS5 is returned by Connect when the binary was built
+// without the sqlite_fts5 tag
+var ErrSQLiteWithoutFTS5 = errors.New("SQLite support was built without FTS5; build with -tags sqlite_fts5")
+
 var globalDB *gorm.DB
 
 func GetDB() *gorm.DB {
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dialect builds the query conditions whose SQL differs between drivers
+type Dialect interface {
+	// JSONArrayContains matches rows whose JSON array column holds value
+	JSONArrayContains(column, value string) clause.Expression
+	// LikeAny matches rows whose column is LIKE any of patterns, ignoring
+	// case. Backslash escapes wildcards in the patterns.
+	LikeAny(column string, patterns []string) clause.Expression
+	// FullTextMatch matches bookmarks whose SearchColumns hold every word of
+	// q, as the start of a word, and every phrase of q
+	FullTextMatch(q TextQuery) clause.Expression
+	// FullTextRank scores how well a bookmark matches q, higher scores being
+	// better matches. Scores are only comparable within one query.
+	FullTextRank(q TextQuery) clause.Expression
+}
+
+// SearchColumns are the bookmark columns covered by the full-text index
+var SearchColumns = []string{"title", "description", "notes", "url"}
+
+// TextQuery is the full-text part of a search. Words and the words of
+// phrases are runs of letters and digits.
+type TextQuery struct {
+	Words   []string
+	Phrases [][]string
+}
+
+// Empty reports whether q has nothing to match
+func (q TextQuery) Empty() bool {
+	return len(q.Words) == 0 && len(q.Phrases) == 0
+}
+
+// DialectOf returns the Dialect for the driver behind db
+func DialectOf(db *gorm.DB) Dialect {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return postgresDialect{}
+	case "sqlite":
+		return sqliteDialect{}
+	default:
+		return mysqlDialect{}
+	}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) JSONArrayContains(column, value string) clause.Expression {
+	encoded, _ := json.Marshal(value)
+	return clause.Expr{SQL: "JSON_CONTAINS(" + column + ", ?)", Vars: []interface{}{string(encoded)}}
+}
+
+// LikeAny relies on the case-insensitive collation of the columns.
+// Backslash is MySQL's default LIKE escape character.
+func (mysqlDialect) LikeAny(column string, patterns []string) clause.Expression {
+	return likeAny([]string{column}, " LIKE ?", patterns)
+}
+
+// mysqlMinTokenSize is the default innodb_ft_min_token_size. Shorter words
+// are not in the full-text index.
+const mysqlMinTokenSize = 3
+
+// FullTextMatch uses the FULLTEXT index in boolean mode. Words and phrases
+// with words too short to be indexed are matched with LIKE instead.
+func (d mysqlDialect) FullTextMatch(q TextQuery) clause.Expression {
+	var conditions []clause.Expression
+	if against := mysqlAgainst(q); against != "" {
+		conditions = append(conditions, mysqlMatch(against))
+	}
+	for _, word := range q.Words {
+		if !mysqlIndexed(word) {
+			conditions = append(conditions, likeAny(SearchColumns, " LIKE ?", []string{"%" + EscapeLike(word) + "%"}))
+		}
+	}
+	for _, phrase := range q.Phrases {
+		if !mysqlIndexed(phrase...) {
+			conditions = append(conditions, likeAny(SearchColumns, " LIKE ?", []string{"%" + EscapeLike(strings.Join(phrase, " ")) + "%"}))
+		}
+	}
+	return clause.And(conditions...)
+}
+
+// FullTextRank is the relevance MATCH computes, which leaves out whatever
+// FullTextMatch matches with LIKE
+func (mysqlDialect) FullTextRank(q TextQuery) clause.Expression {
+	if against := mysqlAgainst(q); against != "" {
+		return mysqlMatch(against)
+	}
+	return clause.Expr{SQL: "0"}
+}
+
+func mysqlMatch(against string) clause.Expression {
+	return clause.Expr{
+		SQL:  "MATCH(" + strings.Join(SearchColumns, ", ") + ") AGAINST (? IN BOOLEAN MODE)",
+		Vars: []interface{}{against},
+	}
+}
+
+// mysqlAgainst builds the boolean mode search string for the parts of q the
+// FULLTEXT index can match
+func mysqlAgainst(q TextQuery) string {
+	var terms []string
+	for _, word := range q.Words {
+		if mysqlIndexed(word) {
+			terms = append(terms, "+"+word+"*")
+		}
+	}
+	for _, phrase := range q.Phrases {
+		if mysqlIndexed(phrase...) {
+			terms = append(terms, `+"`+strings.Join(phrase, " ")+`"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+func mysqlIndexed(words ...string) bool {
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < mysqlMinTokenSize {
+			return false
+		}
+	}
+	return true
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) JSONArrayContains(column, value string) clause.Expression {
+	return clause.Expr{
+		SQL:  "EXISTS (SELECT 1 FROM json_each(" + column + ") WHERE json_each.value = ?)",
+		Vars: []interface{}{value},
+	}
+}
+
+// LikeAny uses LIKE, which SQLite compares case-insensitively for ASCII
+func (sqliteDialect) LikeAny(column string, patterns []string) clause.Expression {
+	return likeAny([]string{column}, ` LIKE ? ESCAPE '\'`, patterns)
+}
+
+// FullTextMatch looks bookmarks up in the bookmarks_fts FTS5 table
+func (sqliteDialect) FullTextMatch(q TextQuery) clause.Expression {
+	return clause.Expr{
+		SQL:  "bookmarks.id IN (SELECT rowid FROM bookmarks_fts WHERE bookmarks_fts MATCH ?)",
+		Vars: []interface{}{sqliteMatch(q)},
+	}
+}
+
+// FullTextRank is FTS5's bm25, negated as bm25 gives better matches lower
+// scores
+func (sqliteDialect) FullTextRank(q TextQuery) clause.Expression {
+	if q.Empty() {
+		return clause.Expr{SQL: "0"}
+	}
+	return clause.Expr{
+		SQL:  "(SELECT -bm25(bookmarks_fts) FROM bookmarks_fts WHERE bookmarks_fts MATCH ? AND rowid = bookmarks.id)",
+		Vars: []interface{}{sqliteMatch(q)},
+	}
+}
+
+// sqliteMatch builds the FTS5 query string for q. Words and phrases only
+// hold letters and digits, so quoting them is enough.
+func sqliteMatch(q TextQuery) string {
+	terms := make([]string, 0, len(q.Words)+len(q.Phrases))
+	for _, word := range q.Words {
+		terms = append(terms, `"`+word+`"*`)
+	}
+	for _, phrase := range q.Phrases {
+		terms = append(terms, `"`+strings.Join(phrase, " ")+`"`)
+	}
+	return strings.Join(terms, " AND ")
+}
+
+type postgresDialect struct{}
+
+// JSONArrayContains uses jsonb containment, which the GIN index on tags serves
+func (postgresDialect) JSONArrayContains(column, value string) clause.Expression {
+	encoded, _ := json.Marshal([]string{value})
+	return clause.Expr{SQL: column + " @> ?::jsonb", Vars: []interface{}{string(encoded)}}
+}
+
+// LikeAny uses ILIKE, as LIKE is case-sensitive in Postgres
+func (postgresDialect) LikeAny(column string, patterns []string) clause.Expression {
+	return likeAny([]string{column}, " ILIKE ?", patterns)
+}
+
+// FullTextMatch uses the full-text index. The tsvector expression has to stay
+// in step with the index in the migrations to be able to use it.
+func (postgresDialect) FullTextMatch(q TextQuery) clause.Expression {
+	return clause.Expr{
+		SQL:  postgresDocument() + " @@ to_tsquery('simple', ?)",
+		Vars: []interface{}{postgresQuery(q)},
+	}
+}
+
+func (postgresDialect) FullTextRank(q TextQuery) clause.Expression {
+	if q.Empty() {
+		return clause.Expr{SQL: "0"}
+	}
+	return clause.Expr{
+		SQL:  "ts_rank(" + postgresDocument() + ", to_tsquery('simple', ?))",
+		Vars: []interface{}{postgresQuery(q)},
+	}
+}
+
+func postgresDocument() string {
+	documents := make([]string, len(SearchColumns))
+	for i, column := range SearchColumns {
+		documents[i] = "coalesce(" + column + ", '')"
+	}
+	return "to_tsvector('simple', " + strings.Join(documents, " || ' ' || ") + ")"
+}
+
+// postgresQuery builds the tsquery for q, with every word matching as a
+// prefix. Words and phrases only hold letters and digits, which tsquery
+// takes literally.
+func postgresQuery(q TextQuery) string {
+	terms := make([]string, 0, len(q.Words)+len(q.Phrases))
+	for _, word := range q.Words {
+		terms = append(terms, word+":*")
+	}
+	for _, phrase := range q.Phrases {
+		terms = append(terms, "("+strings.Join(phrase, " <-> ")+")")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// likeAny ORs together every column followed by match for every pattern.
+// NULL columns count as empty so that the condition can be negated.
+func likeAny(columns []string, match string, patterns []string) clause.Expression {
+	var conditions []string
+	var vars []interface{}
+	for _, column := range columns {
+		for _, pattern := range patterns {
+			conditions = append(conditions, "COALESCE("+column+", '')"+match)
+			vars = append(vars, pattern)
+		}
+	}
+	return clause.Expr{SQL: "(" + strings.Join(conditions, " OR ") + ")", Vars: vars}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike makes LIKE wildcards in s match literally
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
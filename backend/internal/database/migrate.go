@@ -0,0 +1,478 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationLockName is the advisory lock held while migrating, so that
+// several instances starting at once apply each migration only once
+const migrationLockName = "markly_schema_migrations"
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change read from migrations/<dialect>/.
+// NNNN_name.up.sql applies it and NNNN_name.down.sql reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied. Dirty means
+// it failed partway and the schema has to be repaired by hand.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Dirty     bool
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int64
+	Name      string
+	Dirty     bool
+	AppliedAt *time.Time
+}
+
+// Migrator applies and reverts the embedded migrations for the dialect of db
+type Migrator struct {
+	db          *gorm.DB
+	dialect     string
+	migrations  []Migration
+	lockTimeout time.Duration
+}
+
+func NewMigrator(db *gorm.DB, lockTimeout time.Duration) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:          db,
+		dialect:     dialect,
+		migrations:  migrations,
+		lockTimeout: lockTimeout,
+	}, nil
+}
+
+// loadMigrations reads and pairs up the migration files for dialect
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database dialect %q", dialect)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files named both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.up = string(contents)
+		} else {
+			migration.down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies every pending migration in order and returns those it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		done, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			log.Printf("Applying migration %04d_%s", migration.Version, migration.Name)
+			if err := m.run(conn, migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations and returns those it reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		done, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, version := range versions {
+			migration, ok := m.find(version)
+			if !ok {
+				return fmt.Errorf("migration %d is applied but this build has no files for it", version)
+			}
+			log.Printf("Reverting migration %04d_%s", migration.Version, migration.Name)
+			if err := m.run(conn, migration, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration, plus any applied ones this build has no
+// files for, in version order
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var rows []schemaMigration
+	db := m.db.WithContext(ctx)
+	if db.Migrator().HasTable("schema_migrations") {
+		if err := db.Table("schema_migrations").Order("version").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	byVersion := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		byVersion[row.Version] = row
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := byVersion[migration.Version]; ok {
+			status.Applied = !row.Dirty
+			status.AppliedAt = row.AppliedAt
+			status.Dirty = row.Dirty
+			delete(byVersion, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range byVersion {
+		statuses = append(statuses, MigrationStatus{
+			Version:   row.Version,
+			Name:      row.Name,
+			Applied:   !row.Dirty,
+			AppliedAt: row.AppliedAt,
+			Dirty:     row.Dirty,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Pending counts the migrations that still have to be applied
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// appliedVersions reads schema_migrations, refusing to go on while a
+// migration is dirty
+func (m *Migrator) appliedVersions(conn *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := conn.Table("schema_migrations").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		if row.Dirty {
+			return nil, fmt.Errorf("migration %04d_%s failed partway; repair the schema by hand, then delete its schema_migrations row to retry it or clear its dirty flag to keep it", row.Version, row.Name)
+		}
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// run applies or reverts migration. Where DDL is transactional the statements
+// and the bookkeeping share a transaction. MySQL commits each DDL statement
+// on its own, so there the row stays dirty if a statement fails.
+func (m *Migrator) run(conn *gorm.DB, migration Migration, up bool) error {
+	script := migration.down
+	if up {
+		script = migration.up
+	}
+
+	steps := func(tx *gorm.DB) error {
+		var err error
+		if up {
+			err = tx.Exec("INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)",
+				migration.Version, migration.Name, true, time.Now()).Error
+		} else {
+			err = tx.Exec("UPDATE schema_migrations SET dirty = ? WHERE version = ?", true, migration.Version).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, statement := range splitStatements(script) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		if up {
+			return tx.Exec("UPDATE schema_migrations SET dirty = ?, applied_at = ? WHERE version = ?",
+				false, time.Now(), migration.Version).Error
+		}
+		return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+	}
+
+	if m.dialect == "mysql" {
+		return steps(conn)
+	}
+	return conn.Transaction(steps)
+}
+
+// withLock runs fn on a single connection that holds the migration lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := m.lock(conn); err != nil {
+			return err
+		}
+		defer m.unlock(conn)
+
+		if err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			dirty BOOLEAN NOT NULL DEFAULT FALSE,
+			applied_at TIMESTAMP NULL
+		)`).Error; err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+// lock takes the advisory lock on conn, waiting up to lockTimeout. SQLite
+// has no advisory locks, but only ever has a single writer anyway.
+func (m *Migrator) lock(conn *gorm.DB) error {
+	switch m.dialect {
+	case "mysql":
+		var acquired sql.NullInt64
+		seconds := int(m.lockTimeout.Seconds())
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", migrationLockName, seconds).Scan(&acquired).Error; err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		if !acquired.Valid || acquired.Int64 != 1 {
+			return errors.New("timed out waiting for another process to finish migrating")
+		}
+	case "postgres":
+		// pg_advisory_lock cannot time out, so poll the non-blocking form
+		deadline := time.Now().Add(m.lockTimeout)
+		for {
+			var acquired bool
+			if err := conn.Raw("SELECT pg_try_advisory_lock(hashtext(?))", migrationLockName).Scan(&acquired).Error; err != nil {
+				return fmt.Errorf("failed to take the migration lock: %w", err)
+			}
+			if acquired {
+				break
+			}
+			if time.Now().After(deadline) {
+				return errors.New("timed out waiting for another process to finish migrating")
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) unlock(conn *gorm.DB) {
+	switch m.dialect {
+	case "mysql":
+		var released sql.NullInt64
+		if err := conn.Raw("SELECT RELEASE_LOCK(?)", migrationLockName).Scan(&released).Error; err != nil {
+			log.Printf("Failed to release the migration lock: %v", err)
+		}
+	case "postgres":
+		var released bool
+		if err := conn.Raw("SELECT pg_advisory_unlock(hashtext(?))", migrationLockName).Scan(&released).Error; err != nil {
+			log.Printf("Failed to release the migration lock: %v", err)
+		}
+	}
+}
+
+// splitStatements splits a script on semicolons outside of quotes, comments,
+// dollar-quoted bodies and BEGIN ... END trigger bodies, dropping comments and
+// empty statements
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(script) {
+				if script[end] == '\\' && c != '`' {
+					end += 2
+					continue
+				}
+				if script[end] == c {
+					// A doubled quote is an escaped one
+					if end+1 < len(script) && script[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			end = min(end, len(script)-1)
+			current.WriteString(script[i : end+1])
+			i = end
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			if newline := strings.IndexByte(script[i:], '\n'); newline >= 0 {
+				i += newline
+				current.WriteByte('\n')
+			} else {
+				i = len(script)
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+				current.WriteByte(' ')
+			} else {
+				i = len(script)
+			}
+		case c == '$':
+			tag := dollarQuoteTag(script[i:])
+			if tag == "" {
+				current.WriteByte(c)
+				continue
+			}
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				current.WriteString(script[i:])
+				i = len(script)
+				continue
+			}
+			current.WriteString(script[i : i+len(tag)+end+len(tag)])
+			i += len(tag) + end + len(tag) - 1
+		case c == ';' && inTriggerBody(current.String()):
+			current.WriteByte(c)
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+var (
+	triggerBody = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?TRIGGER\b.*\bBEGIN\b`)
+	triggerEnd  = regexp.MustCompile(`(?i)\bEND\s*$`)
+)
+
+// inTriggerBody reports whether statement is a trigger whose BEGIN ... END
+// body is still open. A CASE ... END right before a semicolon in the body
+// would end it early.
+func inTriggerBody(statement string) bool {
+	return triggerBody.MatchString(statement) && !triggerEnd.MatchString(statement)
+}
+
+// dollarQuoteTag returns the $tag$ that s starts with, if any
+func dollarQuoteTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 1 || c < '0' || c > '9') {
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,338 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"markly-backend/internal/config"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "plain statements",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "last statement without semicolon",
+			script: "DROP TABLE a;\nDROP TABLE b",
+			want:   []string{"DROP TABLE a", "DROP TABLE b"},
+		},
+		{
+			name:   "empty statements",
+			script: ";;\n  ;\nDROP TABLE a;;",
+			want:   []string{"DROP TABLE a"},
+		},
+		{
+			name:   "semicolons in quotes",
+			script: `INSERT INTO a VALUES ('x;y', "p;q", ` + "`r;s`" + `);DROP TABLE a;`,
+			want:   []string{`INSERT INTO a VALUES ('x;y', "p;q", ` + "`r;s`" + `)`, "DROP TABLE a"},
+		},
+		{
+			name:   "escaped quotes",
+			script: `INSERT INTO a VALUES ('it''s;', 'back\';slash');DROP TABLE a;`,
+			want:   []string{`INSERT INTO a VALUES ('it''s;', 'back\';slash')`, "DROP TABLE a"},
+		},
+		{
+			name:   "comments",
+			script: "-- drop; everything\nDROP TABLE a; /* not; this */ DROP TABLE b; -- trailing;",
+			want:   []string{"DROP TABLE a", "DROP TABLE b"},
+		},
+		{
+			name: "trigger body",
+			script: `CREATE TRIGGER t AFTER INSERT ON a BEGIN
+  INSERT INTO b VALUES (new.id);
+  UPDATE c SET n = n + 1;
+END;
+DROP TABLE d;`,
+			want: []string{
+				"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  INSERT INTO b VALUES (new.id);\n  UPDATE c SET n = n + 1;\nEND",
+				"DROP TABLE d",
+			},
+		},
+		{
+			name:   "temporary trigger in lower case",
+			script: "create temp trigger t after delete on a begin delete from b; end;select 1;",
+			want:   []string{"create temp trigger t after delete on a begin delete from b; end", "select 1"},
+		},
+		{
+			name: "dollar quoted function",
+			script: `CREATE FUNCTION f() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at = now();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DROP TABLE a;`,
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.updated_at = now();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql",
+				"DROP TABLE a",
+			},
+		},
+		{
+			name:   "tagged dollar quotes",
+			script: "DO $body$ BEGIN PERFORM 1; RAISE NOTICE '$$;'; END $body$;SELECT 1;",
+			want:   []string{"DO $body$ BEGIN PERFORM 1; RAISE NOTICE '$$;'; END $body$", "SELECT 1"},
+		},
+		{
+			name:   "positional parameters are not dollar quotes",
+			script: "PREPARE p AS SELECT $1, $2;EXECUTE p(1, 2);",
+			want:   []string{"PREPARE p AS SELECT $1, $2", "EXECUTE p(1, 2)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsMatchAcrossDialects(t *testing.T) {
+	sqlite, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatalf("load sqlite migrations: %v", err)
+	}
+	for _, dialect := range []string{"mysql", "postgres"} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatalf("load %s migrations: %v", dialect, err)
+		}
+		if len(migrations) != len(sqlite) {
+			t.Fatalf("%s has %d migrations, sqlite has %d", dialect, len(migrations), len(sqlite))
+		}
+		for i := range migrations {
+			if migrations[i].Version != sqlite[i].Version || migrations[i].Name != sqlite[i].Name {
+				t.Errorf("%s migration %d is %04d_%s, sqlite has %04d_%s", dialect, i,
+					migrations[i].Version, migrations[i].Name, sqlite[i].Version, sqlite[i].Name)
+			}
+		}
+	}
+
+	if _, err := loadMigrations("oracle"); err == nil {
+		t.Error("expected an error for a dialect without migrations")
+	}
+}
+
+// openTestDB returns an empty in-memory SQLite database and its migrator
+func openTestDB(t *testing.T) (*gorm.DB, *Migrator) {
+	t.Helper()
+
+	db, err := Connect(&config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if errors.Is(err, ErrSQLiteWithoutFTS5) {
+		t.Skip("SQLite was built without FTS5; run the tests with make test or -tags sqlite_fts5")
+	}
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	migrator, err := NewMigrator(db, time.Second)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	return db, migrator
+}
+
+// schema describes every table, index and trigger the migrations created
+func schema(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+
+	var objects []string
+	if err := db.Raw(`SELECT type || ' ' || name || ': ' || COALESCE(sql, '') FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%' AND name != 'schema_migrations' ORDER BY type, name`).Scan(&objects).Error; err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	return objects
+}
+
+func versions(migrations []Migration) []int64 {
+	result := make([]int64, len(migrations))
+	for i, migration := range migrations {
+		result[i] = migration.Version
+	}
+	return result
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	db, migrator := openTestDB(t)
+	ctx := context.Background()
+	all := versions(migrator.migrations)
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, all) {
+		t.Fatalf("applied %v, want %v", got, all)
+	}
+	migrated := schema(t, db)
+
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second up applied %v, %v", versions(applied), err)
+	}
+
+	reverted, err := migrator.Down(ctx, len(all)+1)
+	if err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	var reversed []int64
+	for i := len(all) - 1; i >= 0; i-- {
+		reversed = append(reversed, all[i])
+	}
+	if got := versions(reverted); !reflect.DeepEqual(got, reversed) {
+		t.Fatalf("reverted %v, want %v", got, reversed)
+	}
+	if left := schema(t, db); len(left) != 0 {
+		t.Fatalf("down left %q behind", left)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != len(all) {
+		t.Fatalf("pending = %d, %v; want %d", pending, err, len(all))
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up again: %v", err)
+	}
+	if got := schema(t, db); !reflect.DeepEqual(got, migrated) {
+		t.Errorf("schema after up, down and up differs:\ngot  %q\nwant %q", got, migrated)
+	}
+}
+
+func TestMigrateDownSteps(t *testing.T) {
+	_, migrator := openTestDB(t)
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	all := versions(migrator.migrations)
+
+	reverted, err := migrator.Down(ctx, 2)
+	if err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if got, want := versions(reverted), []int64{all[len(all)-1], all[len(all)-2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reverted %v, want %v", got, want)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if got, want := versions(applied), all[len(all)-2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("reapplied %v, want %v", got, want)
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	db, migrator := openTestDB(t)
+	ctx := context.Background()
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("status before migrating: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied || status.Dirty || status.AppliedAt != nil {
+			t.Errorf("%04d_%s reported as %+v before migrating", status.Version, status.Name, status)
+		}
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	// A version this build has no files for, as after a downgrade
+	if err := db.Exec("INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)",
+		9999, "from_the_future", false, time.Now()).Error; err != nil {
+		t.Fatalf("insert row: %v", err)
+	}
+
+	statuses, err = migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(statuses) != len(migrator.migrations)+1 {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(migrator.migrations)+1)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.Dirty || status.AppliedAt == nil {
+			t.Errorf("%04d_%s reported as %+v after migrating", status.Version, status.Name, status)
+		}
+	}
+	if last := statuses[len(statuses)-1]; last.Version != 9999 || last.Name != "from_the_future" {
+		t.Errorf("unknown migration reported as %04d_%s", last.Version, last.Name)
+	}
+	if _, err := migrator.Down(ctx, 1); err == nil {
+		t.Error("expected down to refuse a migration it has no files for")
+	}
+}
+
+func TestMigrateRefusesDirtySchema(t *testing.T) {
+	db, migrator := openTestDB(t)
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	last := migrator.migrations[len(migrator.migrations)-1]
+	if err := db.Exec("UPDATE schema_migrations SET dirty = ? WHERE version = ?", true, last.Version).Error; err != nil {
+		t.Fatalf("mark dirty: %v", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status := statuses[len(statuses)-1]; !status.Dirty || status.Applied {
+		t.Errorf("dirty migration reported as %+v", status)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != 1 {
+		t.Errorf("pending = %d, %v; want 1", pending, err)
+	}
+	if _, err := migrator.Up(ctx); err == nil {
+		t.Error("expected up to refuse a dirty schema")
+	}
+	if _, err := migrator.Down(ctx, 1); err == nil {
+		t.Error("expected down to refuse a dirty schema")
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	db, migrator := openTestDB(t)
+	ctx := context.Background()
+	migrator.migrations = []Migration{
+		{Version: 1, Name: "good", up: "CREATE TABLE good (id INTEGER);", down: "DROP TABLE good;"},
+		{Version: 2, Name: "bad", up: "CREATE TABLE half (id INTEGER);\nNOT SQL;", down: "DROP TABLE half;"},
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err == nil {
+		t.Fatal("expected the bad migration to fail")
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("applied %v, want [1]", got)
+	}
+	// SQLite DDL is transactional, so nothing of the bad migration is left
+	if got, want := schema(t, db), []string{"table good: CREATE TABLE good (id INTEGER)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("schema %q, want %q", got, want)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != 1 {
+		t.Errorf("pending = %d, %v; want 1", pending, err)
+	}
+}
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS `sessions`;
+DROP TABLE IF EXISTS `user_identities`;
+DROP TABLE IF EXISTS `login_challenges`;
+DROP TABLE IF EXISTS `recovery_codes`;
+DROP TABLE IF EXISTS `totp_credentials`;
+DROP TABLE IF EXISTS `api_tokens`;
+DROP TABLE IF EXISTS `email_verification_tokens`;
+DROP TABLE IF EXISTS `password_reset_tokens`;
+DROP TABLE IF EXISTS `login_throttles`;
+DROP TABLE IF EXISTS `revoked_tokens`;
+DROP TABLE IF EXISTS `refresh_tokens`;
+DROP TABLE IF EXISTS `bookmarks`;
+DROP TABLE IF EXISTS `collections`;
+DROP TABLE IF EXISTS `users`;
@@ -0,0 +1,179 @@
+-- Baseline: the schema as created by GORM's AutoMigrate before versioned
+-- migrations. IF NOT EXISTS lets it run against databases created that way.
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `email` varchar(191) NOT NULL,
+  `username` varchar(191) NOT NULL,
+  `password` longtext NOT NULL,
+  `email_verified` boolean NOT NULL DEFAULT false,
+  `deletion_scheduled_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_users_deletion_scheduled_at` (`deletion_scheduled_at`),
+  CONSTRAINT `uni_users_username` UNIQUE (`username`),
+  CONSTRAINT `uni_users_email` UNIQUE (`email`)
+);
+
+CREATE TABLE IF NOT EXISTS `collections` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `name` longtext NOT NULL,
+  `description` longtext,
+  `color` longtext,
+  `user_id` bigint unsigned NOT NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_users_collections` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `bookmarks` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `title` longtext NOT NULL,
+  `url` longtext NOT NULL,
+  `description` longtext,
+  `notes` longtext,
+  `favicon` longtext,
+  `screenshot` longtext,
+  `tags` json,
+  `collection_id` bigint unsigned NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_collections_bookmarks` FOREIGN KEY (`collection_id`) REFERENCES `collections` (`id`),
+  CONSTRAINT `fk_users_bookmarks` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `family_id` varchar(64) NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `revoked_at` datetime(3) NULL,
+  `replaced_by_id` bigint unsigned,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_refresh_tokens_user_id` (`user_id`),
+  INDEX `idx_refresh_tokens_family_id` (`family_id`),
+  UNIQUE INDEX `idx_refresh_tokens_token_hash` (`token_hash`)
+);
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `jti` varchar(64) NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`jti`),
+  INDEX `idx_revoked_tokens_expires_at` (`expires_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `login_throttles` (
+  `identifier` varchar(320) NOT NULL,
+  `failures` bigint NOT NULL DEFAULT 0,
+  `lockouts` bigint NOT NULL DEFAULT 0,
+  `window_start` datetime(3) NULL,
+  `locked_until` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`identifier`),
+  INDEX `idx_login_throttles_updated_at` (`updated_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `password_reset_tokens` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_password_reset_tokens_user_id` (`user_id`),
+  UNIQUE INDEX `idx_password_reset_tokens_token_hash` (`token_hash`)
+);
+
+CREATE TABLE IF NOT EXISTS `email_verification_tokens` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `email` longtext NOT NULL,
+  `email_change` boolean NOT NULL DEFAULT false,
+  `token_hash` varchar(64) NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_email_verification_tokens_user_id` (`user_id`),
+  UNIQUE INDEX `idx_email_verification_tokens_token_hash` (`token_hash`)
+);
+
+CREATE TABLE IF NOT EXISTS `api_tokens` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `scopes` json,
+  `expires_at` datetime(3) NULL,
+  `last_used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_api_tokens_user_id` (`user_id`),
+  UNIQUE INDEX `idx_api_tokens_token_hash` (`token_hash`)
+);
+
+CREATE TABLE IF NOT EXISTS `totp_credentials` (
+  `user_id` bigint unsigned NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `confirmed_at` datetime(3) NULL,
+  `last_used_step` bigint NOT NULL DEFAULT 0,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `used_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_recovery_codes_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `login_challenges` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `attempts` bigint NOT NULL DEFAULT 0,
+  `expires_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_login_challenges_user_id` (`user_id`),
+  UNIQUE INDEX `idx_login_challenges_token_hash` (`token_hash`)
+);
+
+CREATE TABLE IF NOT EXISTS `user_identities` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `issuer` varchar(255) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `email` longtext,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_user_identities_user_id` (`user_id`),
+  UNIQUE INDEX `idx_user_identities_subject` (`issuer`, `subject`)
+);
+
+CREATE TABLE IF NOT EXISTS `sessions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `family_id` varchar(64) NOT NULL,
+  `jti` varchar(64),
+  `user_agent` varchar(512),
+  `ip_address` varchar(45),
+  `created_at` datetime(3) NULL,
+  `last_seen_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_sessions_user_id` (`user_id`),
+  UNIQUE INDEX `idx_sessions_family_id` (`family_id`)
+);
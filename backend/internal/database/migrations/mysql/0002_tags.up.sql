@@ -0,0 +1,33 @@
+-- Tags become rows of their own, linked to bookmarks through bookmark_tags.
+-- bookmarks.tags keeps a copy of each bookmark's tag names.
+
+CREATE TABLE `tags` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(191) NOT NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_tags_user_name` (`user_id`, `name`)
+);
+
+CREATE TABLE `bookmark_tags` (
+  `bookmark_id` bigint unsigned NOT NULL,
+  `tag_id` bigint unsigned NOT NULL,
+  PRIMARY KEY (`bookmark_id`, `tag_id`),
+  INDEX `idx_bookmark_tags_tag_id` (`tag_id`),
+  CONSTRAINT `fk_bookmark_tags_bookmark` FOREIGN KEY (`bookmark_id`) REFERENCES `bookmarks` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_bookmark_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags` (`id`) ON DELETE CASCADE
+);
+
+INSERT IGNORE INTO `tags` (`user_id`, `name`, `created_at`)
+SELECT DISTINCT b.`user_id`, jt.`name`, NOW(3)
+FROM `bookmarks` b,
+  JSON_TABLE(b.`tags`, '$[*]' COLUMNS (`name` varchar(191) PATH '$')) jt
+WHERE JSON_TYPE(b.`tags`) = 'ARRAY' AND jt.`name` IS NOT NULL AND jt.`name` <> '';
+
+INSERT IGNORE INTO `bookmark_tags` (`bookmark_id`, `tag_id`)
+SELECT DISTINCT b.`id`, t.`id`
+FROM `bookmarks` b,
+  JSON_TABLE(b.`tags`, '$[*]' COLUMNS (`name` varchar(191) PATH '$')) jt,
+  `tags` t
+WHERE JSON_TYPE(b.`tags`) = 'ARRAY' AND t.`user_id` = b.`user_id` AND t.`name` = jt.`name`;
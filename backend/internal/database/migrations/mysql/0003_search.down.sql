@@ -0,0 +1 @@
+ALTER TABLE `bookmarks` DROP INDEX `idx_bookmarks_fulltext`;
@@ -0,0 +1,10 @@
+-- Full-text index over the bookmark columns that search matches. Stopwords
+-- are turned off while it is built so that every word can be searched for;
+-- words shorter than innodb_ft_min_token_size are still left out and are
+-- matched with LIKE instead.
+
+SET SESSION innodb_ft_enable_stopword = OFF;
+
+ALTER TABLE `bookmarks` ADD FULLTEXT INDEX `idx_bookmarks_fulltext` (`title`, `description`, `notes`, `url`);
+
+SET SESSION innodb_ft_enable_stopword = ON;
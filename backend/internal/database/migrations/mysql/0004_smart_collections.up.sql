@@ -0,0 +1,21 @@
+-- Saved bookmark filters. collection_id has no foreign key: a filter on a
+-- deleted collection matches nothing until it is changed.
+
+CREATE TABLE `smart_collections` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `name` longtext NOT NULL,
+  `description` longtext,
+  `color` longtext,
+  `search` longtext,
+  `tags` json,
+  `collection_id` bigint unsigned NULL,
+  `domain` varchar(255) NULL,
+  `created_after` datetime(3) NULL,
+  `created_before` datetime(3) NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_smart_collections_user_id` (`user_id`),
+  CONSTRAINT `fk_users_smart_collections` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
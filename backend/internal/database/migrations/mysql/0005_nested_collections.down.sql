@@ -0,0 +1,4 @@
+ALTER TABLE `smart_collections` DROP COLUMN `include_descendants`;
+
+ALTER TABLE `collections` DROP FOREIGN KEY `fk_collections_children`;
+ALTER TABLE `collections` DROP INDEX `idx_collections_parent_id`, DROP COLUMN `parent_id`;
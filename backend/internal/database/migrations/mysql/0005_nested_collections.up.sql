@@ -0,0 +1,9 @@
+-- Collections nest in a parent collection of the same user
+
+ALTER TABLE `collections`
+  ADD COLUMN `parent_id` bigint unsigned NULL AFTER `color`,
+  ADD INDEX `idx_collections_parent_id` (`parent_id`),
+  ADD CONSTRAINT `fk_collections_children` FOREIGN KEY (`parent_id`) REFERENCES `collections` (`id`);
+
+ALTER TABLE `smart_collections`
+  ADD COLUMN `include_descendants` boolean NOT NULL DEFAULT false AFTER `collection_id`;
@@ -0,0 +1,2 @@
+ALTER TABLE `bookmarks` DROP INDEX `idx_bookmarks_deleted_at`, DROP COLUMN `deleted_at`;
+ALTER TABLE `collections` DROP INDEX `idx_collections_deleted_at`, DROP COLUMN `deleted_at`;
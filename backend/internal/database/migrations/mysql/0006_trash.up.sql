@@ -0,0 +1,10 @@
+-- Deleted bookmarks and collections stay in the trash until deleted_at is
+-- older than the retention period
+
+ALTER TABLE `collections`
+  ADD COLUMN `deleted_at` datetime(3) NULL AFTER `updated_at`,
+  ADD INDEX `idx_collections_deleted_at` (`deleted_at`);
+
+ALTER TABLE `bookmarks`
+  ADD COLUMN `deleted_at` datetime(3) NULL AFTER `updated_at`,
+  ADD INDEX `idx_bookmarks_deleted_at` (`deleted_at`);
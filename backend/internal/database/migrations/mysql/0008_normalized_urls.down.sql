@@ -0,0 +1,4 @@
+ALTER TABLE `bookmarks`
+  DROP INDEX `idx_bookmarks_user_url_key`,
+  DROP COLUMN `url_key`,
+  DROP COLUMN `normalized_url`;
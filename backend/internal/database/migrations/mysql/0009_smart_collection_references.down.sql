@@ -0,0 +1,2 @@
+ALTER TABLE `smart_collections` DROP FOREIGN KEY `fk_smart_collections_collection`;
+ALTER TABLE `smart_collections` DROP INDEX `idx_smart_collections_collection_id`;
@@ -0,0 +1,15 @@
+-- Single-use export download links. Only a hash of the token is stored, and
+-- the row goes as soon as the download starts, so a link that ends up in a
+-- log cannot be replayed.
+
+CREATE TABLE IF NOT EXISTS `export_tokens` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `format` varchar(16) NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_export_tokens_user_id` (`user_id`),
+  UNIQUE INDEX `idx_export_tokens_token_hash` (`token_hash`)
+);
@@ -0,0 +1,188 @@
+-- Baseline: the schema shared with the MySQL and SQLite baselines. Tags are
+-- JSONB with a GIN index for containment queries, and bookmarks carry a
+-- full-text index over the columns that search matches.
+
+CREATE TABLE IF NOT EXISTS "users" (
+  "id" bigserial,
+  "email" text NOT NULL,
+  "username" text NOT NULL,
+  "password" text NOT NULL,
+  "email_verified" boolean NOT NULL DEFAULT false,
+  "deletion_scheduled_at" timestamptz,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "uni_users_email" UNIQUE ("email"),
+  CONSTRAINT "uni_users_username" UNIQUE ("username")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deletion_scheduled_at" ON "users" ("deletion_scheduled_at");
+
+CREATE TABLE IF NOT EXISTS "collections" (
+  "id" bigserial,
+  "name" text NOT NULL,
+  "description" text,
+  "color" text,
+  "user_id" bigint NOT NULL,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_users_collections" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_collections_user_id" ON "collections" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "bookmarks" (
+  "id" bigserial,
+  "title" text NOT NULL,
+  "url" text NOT NULL,
+  "description" text,
+  "notes" text,
+  "favicon" text,
+  "screenshot" text,
+  "tags" jsonb,
+  "collection_id" bigint NOT NULL,
+  "user_id" bigint NOT NULL,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_collections_bookmarks" FOREIGN KEY ("collection_id") REFERENCES "collections" ("id"),
+  CONSTRAINT "fk_users_bookmarks" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_user_id" ON "bookmarks" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_collection_id" ON "bookmarks" ("collection_id");
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_tags" ON "bookmarks" USING GIN ("tags" jsonb_path_ops);
+-- Must match the expression built by the postgres Dialect's TextSearch
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_search" ON "bookmarks" USING GIN (
+  to_tsvector('simple', coalesce("title", '') || ' ' || coalesce("description", '') || ' ' || coalesce("notes", ''))
+);
+
+CREATE TABLE IF NOT EXISTS "refresh_tokens" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "family_id" varchar(64) NOT NULL,
+  "token_hash" varchar(64) NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "revoked_at" timestamptz,
+  "replaced_by_id" bigint,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_user_id" ON "refresh_tokens" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_family_id" ON "refresh_tokens" ("family_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_refresh_tokens_token_hash" ON "refresh_tokens" ("token_hash");
+
+CREATE TABLE IF NOT EXISTS "revoked_tokens" (
+  "jti" varchar(64) NOT NULL,
+  "user_id" bigint NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz,
+  PRIMARY KEY ("jti")
+);
+CREATE INDEX IF NOT EXISTS "idx_revoked_tokens_expires_at" ON "revoked_tokens" ("expires_at");
+
+CREATE TABLE IF NOT EXISTS "login_throttles" (
+  "identifier" varchar(320) NOT NULL,
+  "failures" bigint NOT NULL DEFAULT 0,
+  "lockouts" bigint NOT NULL DEFAULT 0,
+  "window_start" timestamptz,
+  "locked_until" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("identifier")
+);
+CREATE INDEX IF NOT EXISTS "idx_login_throttles_updated_at" ON "login_throttles" ("updated_at");
+
+CREATE TABLE IF NOT EXISTS "password_reset_tokens" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "token_hash" varchar(64) NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_password_reset_tokens_user_id" ON "password_reset_tokens" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_password_reset_tokens_token_hash" ON "password_reset_tokens" ("token_hash");
+
+CREATE TABLE IF NOT EXISTS "email_verification_tokens" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "email" text NOT NULL,
+  "email_change" boolean NOT NULL DEFAULT false,
+  "token_hash" varchar(64) NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_email_verification_tokens_user_id" ON "email_verification_tokens" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_email_verification_tokens_token_hash" ON "email_verification_tokens" ("token_hash");
+
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "name" varchar(100) NOT NULL,
+  "prefix" varchar(16) NOT NULL,
+  "token_hash" varchar(64) NOT NULL,
+  "scopes" jsonb,
+  "expires_at" timestamptz,
+  "last_used_at" timestamptz,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_user_id" ON "api_tokens" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_tokens_token_hash" ON "api_tokens" ("token_hash");
+
+CREATE TABLE IF NOT EXISTS "totp_credentials" (
+  "user_id" bigint NOT NULL,
+  "secret" varchar(64) NOT NULL,
+  "confirmed_at" timestamptz,
+  "last_used_step" bigint NOT NULL DEFAULT 0,
+  "created_at" timestamptz,
+  PRIMARY KEY ("user_id")
+);
+
+CREATE TABLE IF NOT EXISTS "recovery_codes" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "code_hash" varchar(64) NOT NULL,
+  "used_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "login_challenges" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "token_hash" varchar(64) NOT NULL,
+  "attempts" bigint NOT NULL DEFAULT 0,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_login_challenges_user_id" ON "login_challenges" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_login_challenges_token_hash" ON "login_challenges" ("token_hash");
+
+CREATE TABLE IF NOT EXISTS "user_identities" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "issuer" varchar(255) NOT NULL,
+  "subject" varchar(255) NOT NULL,
+  "email" text,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_identities_user_id" ON "user_identities" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_identities_subject" ON "user_identities" ("issuer", "subject");
+
+CREATE TABLE IF NOT EXISTS "sessions" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "family_id" varchar(64) NOT NULL,
+  "jti" varchar(64),
+  "user_agent" varchar(512),
+  "ip_address" varchar(45),
+  "created_at" timestamptz,
+  "last_seen_at" timestamptz,
+  "revoked_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sessions_user_id" ON "sessions" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sessions_family_id" ON "sessions" ("family_id");
@@ -0,0 +1,39 @@
+-- Tags become rows of their own, linked to bookmarks through bookmark_tags.
+-- bookmarks.tags keeps a copy of each bookmark's tag names.
+
+CREATE TABLE "tags" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "name" varchar(191) NOT NULL,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_tags_user_name" ON "tags" ("user_id", "name");
+
+CREATE TABLE "bookmark_tags" (
+  "bookmark_id" bigint NOT NULL,
+  "tag_id" bigint NOT NULL,
+  PRIMARY KEY ("bookmark_id", "tag_id"),
+  CONSTRAINT "fk_bookmark_tags_bookmark" FOREIGN KEY ("bookmark_id") REFERENCES "bookmarks" ("id") ON DELETE CASCADE,
+  CONSTRAINT "fk_bookmark_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags" ("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_bookmark_tags_tag_id" ON "bookmark_tags" ("tag_id");
+
+INSERT INTO "tags" ("user_id", "name", "created_at")
+SELECT DISTINCT b."user_id", elem.name, now()
+FROM "bookmarks" b
+-- "null" and other scalars would make jsonb_array_elements_text fail
+CROSS JOIN LATERAL jsonb_array_elements_text(
+  CASE WHEN jsonb_typeof(b."tags") = 'array' THEN b."tags" ELSE '[]'::jsonb END
+) AS elem(name)
+WHERE elem.name <> ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO "bookmark_tags" ("bookmark_id", "tag_id")
+SELECT DISTINCT b."id", t."id"
+FROM "bookmarks" b
+CROSS JOIN LATERAL jsonb_array_elements_text(
+  CASE WHEN jsonb_typeof(b."tags") = 'array' THEN b."tags" ELSE '[]'::jsonb END
+) AS elem(name)
+JOIN "tags" t ON t."user_id" = b."user_id" AND t."name" = elem.name
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "idx_bookmarks_search";
+
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_search" ON "bookmarks" USING GIN (
+  to_tsvector('simple', coalesce("title", '') || ' ' || coalesce("description", '') || ' ' || coalesce("notes", ''))
+);
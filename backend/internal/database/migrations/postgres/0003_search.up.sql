@@ -0,0 +1,7 @@
+-- Search matches URLs as well, so the full-text index covers them too
+DROP INDEX IF EXISTS "idx_bookmarks_search";
+
+-- Must match the expression built by the postgres Dialect's FullTextMatch
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_search" ON "bookmarks" USING GIN (
+  to_tsvector('simple', coalesce("title", '') || ' ' || coalesce("description", '') || ' ' || coalesce("notes", '') || ' ' || coalesce("url", ''))
+);
@@ -0,0 +1,21 @@
+-- Saved bookmark filters. collection_id has no foreign key: a filter on a
+-- deleted collection matches nothing until it is changed.
+
+CREATE TABLE "smart_collections" (
+  "id" bigserial,
+  "name" text NOT NULL,
+  "description" text,
+  "color" text,
+  "search" text,
+  "tags" jsonb,
+  "collection_id" bigint,
+  "domain" varchar(255),
+  "created_after" timestamptz,
+  "created_before" timestamptz,
+  "user_id" bigint NOT NULL,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_users_smart_collections" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+CREATE INDEX "idx_smart_collections_user_id" ON "smart_collections" ("user_id");
@@ -0,0 +1,3 @@
+ALTER TABLE "smart_collections" DROP COLUMN IF EXISTS "include_descendants";
+
+ALTER TABLE "collections" DROP COLUMN IF EXISTS "parent_id";
@@ -0,0 +1,7 @@
+-- Collections nest in a parent collection of the same user
+
+ALTER TABLE "collections" ADD COLUMN "parent_id" bigint
+  CONSTRAINT "fk_collections_children" REFERENCES "collections" ("id");
+CREATE INDEX "idx_collections_parent_id" ON "collections" ("parent_id");
+
+ALTER TABLE "smart_collections" ADD COLUMN "include_descendants" boolean NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+ALTER TABLE "bookmarks" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "collections" DROP COLUMN IF EXISTS "deleted_at";
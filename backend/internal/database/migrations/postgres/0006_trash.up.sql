@@ -0,0 +1,8 @@
+-- Deleted bookmarks and collections stay in the trash until deleted_at is
+-- older than the retention period
+
+ALTER TABLE "collections" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_collections_deleted_at" ON "collections" ("deleted_at");
+
+ALTER TABLE "bookmarks" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_bookmarks_deleted_at" ON "bookmarks" ("deleted_at");
@@ -0,0 +1,7 @@
+ALTER TABLE "collections" DROP CONSTRAINT "fk_collections_children";
+ALTER TABLE "collections" ADD CONSTRAINT "fk_collections_children"
+  FOREIGN KEY ("parent_id") REFERENCES "collections" ("id");
+
+ALTER TABLE "bookmarks" DROP CONSTRAINT "fk_collections_bookmarks";
+ALTER TABLE "bookmarks" ADD CONSTRAINT "fk_collections_bookmarks"
+  FOREIGN KEY ("collection_id") REFERENCES "collections" ("id");
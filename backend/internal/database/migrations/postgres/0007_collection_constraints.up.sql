@@ -0,0 +1,10 @@
+-- A collection cannot be deleted while bookmarks or other collections still
+-- point at it; deleteCollection moves or deletes them first
+
+ALTER TABLE "bookmarks" DROP CONSTRAINT "fk_collections_bookmarks";
+ALTER TABLE "bookmarks" ADD CONSTRAINT "fk_collections_bookmarks"
+  FOREIGN KEY ("collection_id") REFERENCES "collections" ("id") ON DELETE RESTRICT;
+
+ALTER TABLE "collections" DROP CONSTRAINT "fk_collections_children";
+ALTER TABLE "collections" ADD CONSTRAINT "fk_collections_children"
+  FOREIGN KEY ("parent_id") REFERENCES "collections" ("id") ON DELETE RESTRICT;
@@ -0,0 +1,8 @@
+-- normalized_url is the canonical form of url, filled in by the server on
+-- start for bookmarks saved before this migration. url_key is a SHA-256 of
+-- it, unique per user; it is NULL in the trash and on duplicates saved
+-- before URLs were normalized.
+
+ALTER TABLE "bookmarks" ADD COLUMN "normalized_url" text;
+ALTER TABLE "bookmarks" ADD COLUMN "url_key" char(64);
+CREATE UNIQUE INDEX "idx_bookmarks_user_url_key" ON "bookmarks" ("user_id", "url_key");
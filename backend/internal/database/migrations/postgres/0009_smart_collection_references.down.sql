@@ -0,0 +1,2 @@
+ALTER TABLE "smart_collections" DROP CONSTRAINT IF EXISTS "fk_smart_collections_collection";
+DROP INDEX IF EXISTS "idx_smart_collections_collection_id";
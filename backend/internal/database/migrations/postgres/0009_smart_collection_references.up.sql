@@ -0,0 +1,11 @@
+-- A smart collection filtered on a collection goes when that collection is
+-- purged from the trash. Filters left pointing at collections deleted before
+-- the trash existed match nothing and go now.
+
+DELETE FROM "smart_collections"
+WHERE "collection_id" IS NOT NULL
+  AND "collection_id" NOT IN (SELECT "id" FROM "collections");
+
+CREATE INDEX "idx_smart_collections_collection_id" ON "smart_collections" ("collection_id");
+ALTER TABLE "smart_collections" ADD CONSTRAINT "fk_smart_collections_collection"
+  FOREIGN KEY ("collection_id") REFERENCES "collections" ("id") ON DELETE CASCADE;
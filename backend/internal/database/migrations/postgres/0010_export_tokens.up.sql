@@ -0,0 +1,15 @@
+-- Single-use export download links. Only a hash of the token is stored, and
+-- the row goes as soon as the download starts, so a link that ends up in a
+-- log cannot be replayed.
+
+CREATE TABLE IF NOT EXISTS "export_tokens" (
+  "id" bigserial,
+  "user_id" bigint NOT NULL,
+  "token_hash" varchar(64) NOT NULL,
+  "format" varchar(16) NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_export_tokens_user_id" ON "export_tokens" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_export_tokens_token_hash" ON "export_tokens" ("token_hash");
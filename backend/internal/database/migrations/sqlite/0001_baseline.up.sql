@@ -0,0 +1,168 @@
+-- Baseline: the schema shared with the MySQL baseline. Emails and usernames
+-- compare case-insensitively, as they do under MySQL's default collation.
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `email` text NOT NULL COLLATE NOCASE,
+  `username` text NOT NULL COLLATE NOCASE,
+  `password` text NOT NULL,
+  `email_verified` numeric NOT NULL DEFAULT false,
+  `deletion_scheduled_at` datetime,
+  `created_at` datetime,
+  `updated_at` datetime,
+  CONSTRAINT `uni_users_email` UNIQUE (`email`),
+  CONSTRAINT `uni_users_username` UNIQUE (`username`)
+);
+CREATE INDEX IF NOT EXISTS `idx_users_deletion_scheduled_at` ON `users` (`deletion_scheduled_at`);
+
+CREATE TABLE IF NOT EXISTS `collections` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `name` text NOT NULL,
+  `description` text,
+  `color` text,
+  `user_id` integer NOT NULL,
+  `created_at` datetime,
+  `updated_at` datetime,
+  CONSTRAINT `fk_users_collections` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `bookmarks` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `title` text NOT NULL,
+  `url` text NOT NULL,
+  `description` text,
+  `notes` text,
+  `favicon` text,
+  `screenshot` text,
+  `tags` json,
+  `collection_id` integer NOT NULL,
+  `user_id` integer NOT NULL,
+  `created_at` datetime,
+  `updated_at` datetime,
+  CONSTRAINT `fk_collections_bookmarks` FOREIGN KEY (`collection_id`) REFERENCES `collections` (`id`),
+  CONSTRAINT `fk_users_bookmarks` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `family_id` text NOT NULL,
+  `token_hash` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `revoked_at` datetime,
+  `replaced_by_id` integer,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_refresh_tokens_user_id` ON `refresh_tokens` (`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_refresh_tokens_family_id` ON `refresh_tokens` (`family_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_refresh_tokens_token_hash` ON `refresh_tokens` (`token_hash`);
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `jti` text NOT NULL,
+  `user_id` integer NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime,
+  PRIMARY KEY (`jti`)
+);
+CREATE INDEX IF NOT EXISTS `idx_revoked_tokens_expires_at` ON `revoked_tokens` (`expires_at`);
+
+CREATE TABLE IF NOT EXISTS `login_throttles` (
+  `identifier` text NOT NULL,
+  `failures` integer NOT NULL DEFAULT 0,
+  `lockouts` integer NOT NULL DEFAULT 0,
+  `window_start` datetime,
+  `locked_until` datetime,
+  `updated_at` datetime,
+  PRIMARY KEY (`identifier`)
+);
+CREATE INDEX IF NOT EXISTS `idx_login_throttles_updated_at` ON `login_throttles` (`updated_at`);
+
+CREATE TABLE IF NOT EXISTS `password_reset_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token_hash` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used_at` datetime,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_password_reset_tokens_user_id` ON `password_reset_tokens` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_password_reset_tokens_token_hash` ON `password_reset_tokens` (`token_hash`);
+
+CREATE TABLE IF NOT EXISTS `email_verification_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `email` text NOT NULL,
+  `email_change` numeric NOT NULL DEFAULT false,
+  `token_hash` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_email_verification_tokens_user_id` ON `email_verification_tokens` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_email_verification_tokens_token_hash` ON `email_verification_tokens` (`token_hash`);
+
+CREATE TABLE IF NOT EXISTS `api_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `name` text NOT NULL,
+  `prefix` text NOT NULL,
+  `token_hash` text NOT NULL,
+  `scopes` json,
+  `expires_at` datetime,
+  `last_used_at` datetime,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_api_tokens_user_id` ON `api_tokens` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_tokens_token_hash` ON `api_tokens` (`token_hash`);
+
+CREATE TABLE IF NOT EXISTS `totp_credentials` (
+  `user_id` integer NOT NULL,
+  `secret` text NOT NULL,
+  `confirmed_at` datetime,
+  `last_used_step` integer NOT NULL DEFAULT 0,
+  `created_at` datetime,
+  PRIMARY KEY (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `code_hash` text NOT NULL,
+  `used_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_user_id` ON `recovery_codes` (`user_id`);
+
+CREATE TABLE IF NOT EXISTS `login_challenges` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token_hash` text NOT NULL,
+  `attempts` integer NOT NULL DEFAULT 0,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_login_challenges_user_id` ON `login_challenges` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_login_challenges_token_hash` ON `login_challenges` (`token_hash`);
+
+CREATE TABLE IF NOT EXISTS `user_identities` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `issuer` text NOT NULL,
+  `subject` text NOT NULL,
+  `email` text,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_user_identities_user_id` ON `user_identities` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_user_identities_subject` ON `user_identities` (`issuer`, `subject`);
+
+CREATE TABLE IF NOT EXISTS `sessions` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `family_id` text NOT NULL,
+  `jti` text,
+  `user_agent` text,
+  `ip_address` text,
+  `created_at` datetime,
+  `last_seen_at` datetime,
+  `revoked_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_sessions_user_id` ON `sessions` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_sessions_family_id` ON `sessions` (`family_id`);
@@ -0,0 +1,30 @@
+-- Tags become rows of their own, linked to bookmarks through bookmark_tags.
+-- bookmarks.tags keeps a copy of each bookmark's tag names.
+
+CREATE TABLE `tags` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `name` text NOT NULL,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_tags_user_name` ON `tags` (`user_id`, `name`);
+
+CREATE TABLE `bookmark_tags` (
+  `bookmark_id` integer NOT NULL,
+  `tag_id` integer NOT NULL,
+  PRIMARY KEY (`bookmark_id`, `tag_id`),
+  CONSTRAINT `fk_bookmark_tags_bookmark` FOREIGN KEY (`bookmark_id`) REFERENCES `bookmarks` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_bookmark_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags` (`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_bookmark_tags_tag_id` ON `bookmark_tags` (`tag_id`);
+
+INSERT OR IGNORE INTO `tags` (`user_id`, `name`, `created_at`)
+SELECT DISTINCT b.`user_id`, je.value, CURRENT_TIMESTAMP
+FROM `bookmarks` b, json_each(b.`tags`) je
+WHERE json_type(b.`tags`) = 'array' AND je.type = 'text' AND je.value <> '';
+
+INSERT OR IGNORE INTO `bookmark_tags` (`bookmark_id`, `tag_id`)
+SELECT DISTINCT b.`id`, t.`id`
+FROM `bookmarks` b, json_each(b.`tags`) je
+JOIN `tags` t ON t.`user_id` = b.`user_id` AND t.`name` = je.value
+WHERE json_type(b.`tags`) = 'array';
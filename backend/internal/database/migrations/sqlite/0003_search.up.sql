@@ -0,0 +1,29 @@
+-- Full-text index over the bookmark columns that search matches, kept in
+-- step with bookmarks by triggers. Needs the driver built with the
+-- sqlite_fts5 tag.
+
+CREATE VIRTUAL TABLE `bookmarks_fts` USING fts5(
+  title, description, notes, url,
+  content = 'bookmarks',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER `bookmarks_fts_insert` AFTER INSERT ON `bookmarks` BEGIN
+  INSERT INTO `bookmarks_fts` (rowid, title, description, notes, url)
+  VALUES (new.`id`, new.`title`, new.`description`, new.`notes`, new.`url`);
+END;
+
+CREATE TRIGGER `bookmarks_fts_delete` AFTER DELETE ON `bookmarks` BEGIN
+  INSERT INTO `bookmarks_fts` (`bookmarks_fts`, rowid, title, description, notes, url)
+  VALUES ('delete', old.`id`, old.`title`, old.`description`, old.`notes`, old.`url`);
+END;
+
+CREATE TRIGGER `bookmarks_fts_update` AFTER UPDATE OF `title`, `description`, `notes`, `url` ON `bookmarks` BEGIN
+  INSERT INTO `bookmarks_fts` (`bookmarks_fts`, rowid, title, description, notes, url)
+  VALUES ('delete', old.`id`, old.`title`, old.`description`, old.`notes`, old.`url`);
+  INSERT INTO `bookmarks_fts` (rowid, title, description, notes, url)
+  VALUES (new.`id`, new.`title`, new.`description`, new.`notes`, new.`url`);
+END;
+
+INSERT INTO `bookmarks_fts` (`bookmarks_fts`) VALUES ('rebuild');
@@ -0,0 +1,20 @@
+-- Saved bookmark filters. collection_id has no foreign key: a filter on a
+-- deleted collection matches nothing until it is changed.
+
+CREATE TABLE `smart_collections` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `name` text NOT NULL,
+  `description` text,
+  `color` text,
+  `search` text,
+  `tags` json,
+  `collection_id` integer,
+  `domain` text,
+  `created_after` datetime,
+  `created_before` datetime,
+  `user_id` integer NOT NULL,
+  `created_at` datetime,
+  `updated_at` datetime,
+  CONSTRAINT `fk_users_smart_collections` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+CREATE INDEX `idx_smart_collections_user_id` ON `smart_collections` (`user_id`);
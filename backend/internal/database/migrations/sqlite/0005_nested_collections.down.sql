@@ -0,0 +1,4 @@
+ALTER TABLE `smart_collections` DROP COLUMN `include_descendants`;
+
+DROP INDEX IF EXISTS `idx_collections_parent_id`;
+ALTER TABLE `collections` DROP COLUMN `parent_id`;
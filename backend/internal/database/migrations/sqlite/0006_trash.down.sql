@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS `idx_bookmarks_deleted_at`;
+ALTER TABLE `bookmarks` DROP COLUMN `deleted_at`;
+DROP INDEX IF EXISTS `idx_collections_deleted_at`;
+ALTER TABLE `collections` DROP COLUMN `deleted_at`;
@@ -0,0 +1 @@
+-- Nothing to revert; see 0007_collection_constraints.up.sql
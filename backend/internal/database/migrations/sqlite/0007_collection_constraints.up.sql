@@ -0,0 +1,5 @@
+-- SQLite cannot change the action of an existing foreign key without
+-- rebuilding the table, and rebuilding bookmarks would cascade to
+-- bookmark_tags. Its NO ACTION keys already refuse to delete a collection
+-- that bookmarks or other collections point at, as foreign keys are enforced
+-- on every connection, so there is nothing to change here.
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS `idx_bookmarks_user_url_key`;
+ALTER TABLE `bookmarks` DROP COLUMN `url_key`;
+ALTER TABLE `bookmarks` DROP COLUMN `normalized_url`;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS `collections_smart_collections_delete`;
+DROP INDEX IF EXISTS `idx_smart_collections_collection_id`;
@@ -0,0 +1,16 @@
+-- A smart collection filtered on a collection goes when that collection is
+-- purged from the trash. Filters left pointing at collections deleted before
+-- the trash existed match nothing and go now.
+--
+-- SQLite cannot add a foreign key to an existing table without rebuilding
+-- it, so a trigger stands in for ON DELETE CASCADE.
+
+DELETE FROM `smart_collections`
+WHERE `collection_id` IS NOT NULL
+  AND `collection_id` NOT IN (SELECT `id` FROM `collections`);
+
+CREATE INDEX `idx_smart_collections_collection_id` ON `smart_collections` (`collection_id`);
+
+CREATE TRIGGER `collections_smart_collections_delete` AFTER DELETE ON `collections` BEGIN
+  DELETE FROM `smart_collections` WHERE `collection_id` = old.`id`;
+END;
@@ -0,0 +1,14 @@
+-- Single-use export download links. Only a hash of the token is stored, and
+-- the row goes as soon as the download starts, so a link that ends up in a
+-- log cannot be replayed.
+
+CREATE TABLE IF NOT EXISTS `export_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token_hash` text NOT NULL,
+  `format` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_export_tokens_user_id` ON `export_tokens` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_export_tokens_token_hash` ON `export_tokens` (`token_hash`);
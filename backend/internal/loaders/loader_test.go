@@ -0,0 +1,175 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingFetch returns a batch function mapping each key to ten times its
+// value, leaving out keys above missingFrom, and records every batch it gets
+func recordingFetch(missingFrom int) (BatchFunc[int, int], func() [][]int) {
+	var mu sync.Mutex
+	var batches [][]int
+	fetch := func(ctx context.Context, keys []int) (map[int]int, error) {
+		mu.Lock()
+		batches = append(batches, append([]int(nil), keys...))
+		mu.Unlock()
+
+		values := make(map[int]int, len(keys))
+		for _, key := range keys {
+			if key < missingFrom {
+				values[key] = key * 10
+			}
+		}
+		return values, nil
+	}
+	return fetch, func() [][]int {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+// loadAll loads every key at once, returning the values in the order of keys
+func loadAll[K comparable, V any](t *testing.T, loader *Loader[K, V], keys []K) []V {
+	t.Helper()
+
+	values := make([]V, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], errs[i] = loader.Load(context.Background(), key)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("load %v: %v", keys[i], err)
+		}
+	}
+	return values
+}
+
+func TestLoaderBatchesKeysIntoOneFetch(t *testing.T) {
+	fetch, batches := recordingFetch(100)
+	loader := NewLoader(fetch, 50*time.Millisecond, 0)
+
+	keys := []int{5, 3, 9, 1, 7}
+	values := loadAll(t, loader, keys)
+
+	for i, key := range keys {
+		if values[i] != key*10 {
+			t.Errorf("Load(%d) = %d, want %d", key, values[i], key*10)
+		}
+	}
+	if got := batches(); len(got) != 1 || len(got[0]) != len(keys) {
+		t.Errorf("fetched in batches %v, want one batch of %d keys", got, len(keys))
+	}
+}
+
+func TestLoaderMissingKeysResolveToZero(t *testing.T) {
+	fetch, _ := recordingFetch(3)
+	loader := NewLoader(fetch, time.Hour, 4)
+
+	values := loadAll(t, loader, []int{1, 2, 3, 4})
+	if want := []int{10, 20, 0, 0}; !equalInts(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+}
+
+func TestLoaderCachesKeys(t *testing.T) {
+	fetch, batches := recordingFetch(100)
+	loader := NewLoader(fetch, time.Millisecond, 0)
+
+	for i := 0; i < 3; i++ {
+		if value, err := loader.Load(context.Background(), 4); err != nil || value != 40 {
+			t.Fatalf("Load(4) = %d, %v", value, err)
+		}
+	}
+	if got := batches(); len(got) != 1 {
+		t.Errorf("fetched %d times, want once", len(got))
+	}
+}
+
+func TestLoaderSplitsAtMaxBatch(t *testing.T) {
+	fetch, batches := recordingFetch(10000)
+	// A full batch is fetched at once, so the long wait is never reached
+	loader := NewLoader(fetch, time.Hour, maxBatchSize)
+
+	keys := make([]int, 2*maxBatchSize)
+	for i := range keys {
+		keys[i] = i
+	}
+	values := loadAll(t, loader, keys)
+
+	for i, key := range keys {
+		if values[i] != key*10 {
+			t.Fatalf("Load(%d) = %d, want %d", key, values[i], key*10)
+		}
+	}
+	got := batches()
+	if len(got) != 2 {
+		t.Fatalf("fetched in %d batches, want 2", len(got))
+	}
+	var fetched []int
+	for _, batch := range got {
+		if len(batch) != maxBatchSize {
+			t.Errorf("batch of %d keys, want %d", len(batch), maxBatchSize)
+		}
+		fetched = append(fetched, batch...)
+	}
+	sort.Ints(fetched)
+	if !equalInts(fetched, keys) {
+		t.Error("every key should be fetched exactly once")
+	}
+}
+
+func TestLoaderReportsFetchErrorsToEveryKey(t *testing.T) {
+	failure := errors.New("database is down")
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		return nil, failure
+	}, time.Hour, 2)
+
+	var wg sync.WaitGroup
+	for _, key := range []int{1, 2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := loader.Load(context.Background(), key); !errors.Is(err, failure) {
+				t.Errorf("Load(%d) error = %v, want %v", key, err, failure)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLoaderStopsWaitingWhenContextEnds(t *testing.T) {
+	fetch, _ := recordingFetch(100)
+	loader := NewLoader(fetch, time.Hour, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := loader.Load(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func equalInts(got, want []int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
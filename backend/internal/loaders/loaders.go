@@ -0,0 +1,120 @@
+package loaders
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/middleware"
+	"markly-backend/internal/models"
+)
+
+type contextKey string
+
+const loadersKey contextKey = "loaders"
+
+const (
+	batchWait    = 2 * time.Millisecond
+	maxBatchSize = 500
+)
+
+// Loaders holds the per-request batch loaders used by the nested field
+// resolvers. Every lookup is scoped to the authenticated user.
+type Loaders struct {
+	UserByID                *Loader[uint, *models.User]
+	CollectionByID          *Loader[uint, *models.Collection]
+	CollectionsByUserID     *Loader[uint, []models.Collection]
+	BookmarksByCollectionID *Loader[uint, []models.Bookmark]
+}
+
+// NewLoaders creates a fresh set of loaders for one request made by userID
+func NewLoaders(db *gorm.DB, userID uint) *Loaders {
+	return &Loaders{
+		UserByID:                NewLoader(usersByID(db, userID), batchWait, maxBatchSize),
+		CollectionByID:          NewLoader(collectionsByID(db, userID), batchWait, maxBatchSize),
+		CollectionsByUserID:     NewLoader(collectionsByUserID(db, userID), batchWait, maxBatchSize),
+		BookmarksByCollectionID: NewLoader(bookmarksByCollectionID(db, userID), batchWait, maxBatchSize),
+	}
+}
+
+// Middleware attaches a new set of loaders to each request. It must run after
+// AuthMiddleware so the authenticated user is known.
+func Middleware(db *gorm.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value(middleware.UserIDKey).(uint)
+			ctx := context.WithValue(r.Context(), loadersKey, NewLoaders(db, userID))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// For returns the loaders attached to the request context
+func For(ctx context.Context) (*Loaders, bool) {
+	l, ok := ctx.Value(loadersKey).(*Loaders)
+	return l, ok && l != nil
+}
+
+func usersByID(db *gorm.DB, userID uint) BatchFunc[uint, *models.User] {
+	return func(ctx context.Context, ids []uint) (map[uint]*models.User, error) {
+		var users []models.User
+		if err := db.WithContext(ctx).Where("id IN ? AND id = ?", ids, userID).Find(&users).Error; err != nil {
+			return nil, err
+		}
+
+		result := make(map[uint]*models.User, len(users))
+		for i := range users {
+			result[users[i].ID] = &users[i]
+		}
+		return result, nil
+	}
+}
+
+// collectionsByID also finds collections in the trash, which bookmarks and
+// collections in the trash may still refer to
+func collectionsByID(db *gorm.DB, userID uint) BatchFunc[uint, *models.Collection] {
+	return func(ctx context.Context, ids []uint) (map[uint]*models.Collection, error) {
+		var collections []models.Collection
+		if err := db.WithContext(ctx).Unscoped().Where("id IN ? AND user_id = ?", ids, userID).Find(&collections).Error; err != nil {
+			return nil, err
+		}
+
+		result := make(map[uint]*models.Collection, len(collections))
+		for i := range collections {
+			result[collections[i].ID] = &collections[i]
+		}
+		return result, nil
+	}
+}
+
+func collectionsByUserID(db *gorm.DB, userID uint) BatchFunc[uint, []models.Collection] {
+	return func(ctx context.Context, ids []uint) (map[uint][]models.Collection, error) {
+		var collections []models.Collection
+		if err := db.WithContext(ctx).Where("user_id IN ? AND user_id = ?", ids, userID).Order("id").Find(&collections).Error; err != nil {
+			return nil, err
+		}
+
+		result := make(map[uint][]models.Collection, len(ids))
+		for _, collection := range collections {
+			result[collection.UserID] = append(result[collection.UserID], collection)
+		}
+		return result, nil
+	}
+}
+
+func bookmarksByCollectionID(db *gorm.DB, userID uint) BatchFunc[uint, []models.Bookmark] {
+	return func(ctx context.Context, ids []uint) (map[uint][]models.Bookmark, error) {
+		var bookmarks []models.Bookmark
+		if err := db.WithContext(ctx).Where("collection_id IN ? AND user_id = ?", ids, userID).Order("id").Find(&bookmarks).Error; err != nil {
+			return nil, err
+		}
+
+		result := make(map[uint][]models.Bookmark, len(ids))
+		for _, bookmark := range bookmarks {
+			result[bookmark.CollectionID] = append(result[bookmark.CollectionID], bookmark)
+		}
+		return result, nil
+	}
+}
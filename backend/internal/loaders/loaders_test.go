@@ -0,0 +1,170 @@
+package loaders
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+// countQueries returns a counter of the queries run on db from now on
+func countQueries(t *testing.T, db *gorm.DB) *atomic.Int32 {
+	t.Helper()
+
+	var queries atomic.Int32
+	if err := db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries.Add(1)
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	return &queries
+}
+
+// batchLoader wraps fetch in a loader whose only batch is the given keys, so
+// it is fetched as soon as every key has been requested
+func batchLoader[K comparable, V any](fetch BatchFunc[K, V], keys []K) *Loader[K, V] {
+	return NewLoader(fetch, time.Hour, len(keys))
+}
+
+func TestNewLoadersBatchSettings(t *testing.T) {
+	l := NewLoaders(nil, 1)
+	if l.UserByID.wait != batchWait || l.CollectionByID.wait != batchWait ||
+		l.CollectionsByUserID.wait != batchWait || l.BookmarksByCollectionID.wait != batchWait {
+		t.Errorf("loaders should wait %v for more keys", batchWait)
+	}
+	if l.UserByID.maxBatch != maxBatchSize || l.CollectionByID.maxBatch != maxBatchSize ||
+		l.CollectionsByUserID.maxBatch != maxBatchSize || l.BookmarksByCollectionID.maxBatch != maxBatchSize {
+		t.Errorf("loaders should fetch at most %d keys at once", maxBatchSize)
+	}
+}
+
+func TestCollectionByIDBatchesAndScopesToUser(t *testing.T) {
+	db := testdb.Open(t)
+	alice := testdb.CreateUser(t, db, "alice")
+	bob := testdb.CreateUser(t, db, "bob")
+	reading := testdb.CreateCollection(t, db, alice.ID, "Reading", 0)
+	work := testdb.CreateCollection(t, db, alice.ID, "Work", 0)
+	trashed := testdb.CreateCollection(t, db, alice.ID, "Old", 0)
+	if err := db.Delete(trashed).Error; err != nil {
+		t.Fatalf("trash collection: %v", err)
+	}
+	private := testdb.CreateCollection(t, db, bob.ID, "Private", 0)
+	queries := countQueries(t, db)
+
+	keys := []uint{work.ID, private.ID, 9999, reading.ID, trashed.ID}
+	collections := loadAll(t, batchLoader(collectionsByID(db, alice.ID), keys), keys)
+
+	if n := queries.Load(); n != 1 {
+		t.Errorf("ran %d queries, want 1", n)
+	}
+	wantNames := []string{"Work", "", "", "Reading", "Old"}
+	for i, collection := range collections {
+		name := ""
+		if collection != nil {
+			name = collection.Name
+		}
+		if name != wantNames[i] {
+			t.Errorf("Load(%d) = %q, want %q", keys[i], name, wantNames[i])
+		}
+	}
+}
+
+func TestUserByIDOnlyFindsTheCurrentUser(t *testing.T) {
+	db := testdb.Open(t)
+	alice := testdb.CreateUser(t, db, "alice")
+	bob := testdb.CreateUser(t, db, "bob")
+
+	keys := []uint{bob.ID, alice.ID}
+	users := loadAll(t, batchLoader(usersByID(db, alice.ID), keys), keys)
+
+	if users[0] != nil {
+		t.Errorf("alice's loader returned bob")
+	}
+	if users[1] == nil || users[1].Username != "alice" {
+		t.Errorf("Load(alice) = %+v", users[1])
+	}
+}
+
+func TestBookmarksByCollectionIDOrderAndScope(t *testing.T) {
+	db := testdb.Open(t)
+	alice := testdb.CreateUser(t, db, "alice")
+	bob := testdb.CreateUser(t, db, "bob")
+	reading := testdb.CreateCollection(t, db, alice.ID, "Reading", 0)
+	work := testdb.CreateCollection(t, db, alice.ID, "Work", 0)
+	empty := testdb.CreateCollection(t, db, alice.ID, "Empty", 0)
+	private := testdb.CreateCollection(t, db, bob.ID, "Private", 0)
+
+	var wantReading, wantWork []uint
+	for _, url := range []string{"https://example.com/1", "https://example.com/2", "https://example.com/3"} {
+		wantReading = append(wantReading, testdb.CreateBookmark(t, db, alice.ID, reading.ID, url).ID)
+		wantWork = append(wantWork, testdb.CreateBookmark(t, db, alice.ID, work.ID, url).ID)
+	}
+	testdb.CreateBookmark(t, db, bob.ID, private.ID, "https://example.com/bob")
+	queries := countQueries(t, db)
+
+	keys := []uint{work.ID, private.ID, empty.ID, reading.ID}
+	results := loadAll(t, batchLoader(bookmarksByCollectionID(db, alice.ID), keys), keys)
+
+	if n := queries.Load(); n != 1 {
+		t.Errorf("ran %d queries, want 1", n)
+	}
+	if got := bookmarkIDs(results[0]); !equalIDs(got, wantWork) {
+		t.Errorf("work: got %v, want %v", got, wantWork)
+	}
+	if len(results[1]) != 0 {
+		t.Errorf("alice's loader returned %d of bob's bookmarks", len(results[1]))
+	}
+	if len(results[2]) != 0 {
+		t.Errorf("empty collection: got %d bookmarks", len(results[2]))
+	}
+	if got := bookmarkIDs(results[3]); !equalIDs(got, wantReading) {
+		t.Errorf("reading: got %v, want %v", got, wantReading)
+	}
+}
+
+func TestCollectionsByUserIDOnlyFindsTheCurrentUser(t *testing.T) {
+	db := testdb.Open(t)
+	alice := testdb.CreateUser(t, db, "alice")
+	bob := testdb.CreateUser(t, db, "bob")
+	first := testdb.CreateCollection(t, db, alice.ID, "Reading", 0)
+	second := testdb.CreateCollection(t, db, alice.ID, "Work", first.ID)
+	testdb.CreateCollection(t, db, bob.ID, "Private", 0)
+
+	keys := []uint{alice.ID, bob.ID}
+	results := loadAll(t, batchLoader(collectionsByUserID(db, alice.ID), keys), keys)
+
+	var got []uint
+	for _, collection := range results[0] {
+		got = append(got, collection.ID)
+	}
+	if want := []uint{first.ID, second.ID}; !equalIDs(got, want) {
+		t.Errorf("alice: got %v, want %v", got, want)
+	}
+	if len(results[1]) != 0 {
+		t.Errorf("alice's loader returned %d of bob's collections", len(results[1]))
+	}
+}
+
+func bookmarkIDs(bookmarks []models.Bookmark) []uint {
+	ids := make([]uint, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		ids[i] = bookmark.ID
+	}
+	return ids
+}
+
+func equalIDs(got, want []uint) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,13 +2,11 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 
-	"markly-backend/internal/config"
 	"markly-backend/internal/models"
 )
 
@@ -16,15 +14,42 @@ type contextKey string
 
 const UserContextKey contextKey = "user"
 const UserIDKey contextKey = "user_id"
+const TokenClaimsKey contextKey = "token_claims"
+const APITokenKey contextKey = "api_token"
+
+// APITokenPrefix marks personal access tokens, which are opaque strings
+// rather than JWTs
+const APITokenPrefix = "mkp_"
 
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func AuthMiddleware(cfg *config.JWTConfig) func(http.Handler) http.Handler {
+// TokenVerifier checks an access token and returns its claims
+type TokenVerifier interface {
+	ParseAccessToken(token string) (*JWTClaims, error)
+}
+
+// RevocationChecker reports whether an access token has been revoked before
+// its expiry, for example by logging out
+type RevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, jti string) bool
+}
+
+// SessionChecker reports whether the login session an access token belongs to
+// is still active, and may record that it was used
+type SessionChecker interface {
+	TouchSession(ctx context.Context, sessionID, jti string) bool
+}
+
+// APITokenVerifier looks up an active personal access token
+type APITokenVerifier interface {
+	VerifyAPIToken(ctx context.Context, token string) (*models.APIToken, error)
+}
+
+func AuthMiddleware(tokens TokenVerifier, revocations RevocationChecker, sessions SessionChecker, apiTokens APITokenVerifier) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := extractToken(r)
@@ -33,27 +58,43 @@ func AuthMiddleware(cfg *config.JWTConfig) func(http.Handler) http.Handler {
 				return
 			}
 
-			claims := &JWTClaims{}
-			parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			if strings.HasPrefix(token, APITokenPrefix) {
+				if apiTokens == nil {
+					next.ServeHTTP(w, r)
+					return
 				}
-				return []byte(cfg.Secret), nil
-			})
+				apiToken, err := apiTokens.VerifyAPIToken(r.Context(), token)
+				if err != nil {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserContextKey, &models.User{ID: apiToken.UserID})
+				ctx = context.WithValue(ctx, UserIDKey, apiToken.UserID)
+				ctx = context.WithValue(ctx, APITokenKey, apiToken)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			claims, err := tokens.ParseAccessToken(token)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			if err != nil || !parsedToken.Valid {
+			if revocations != nil && revocations.IsTokenRevoked(r.Context(), claims.ID) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			user := &models.User{
-				ID:       claims.UserID,
-				Username: claims.Username,
-				Email:    claims.Email,
+			if sessions != nil && !sessions.TouchSession(r.Context(), claims.SessionID, claims.ID) {
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			ctx := context.WithValue(r.Context(), UserContextKey, &models.User{ID: claims.UserID})
 			ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, TokenClaimsKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -70,11 +111,43 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
+// GetUserFromContext returns the authenticated user. Only its ID is set;
+// tokens carry nothing else, so load the user for its other fields.
 func GetUserFromContext(ctx context.Context) (*models.User, bool) {
 	user, ok := ctx.Value(UserContextKey).(*models.User)
 	return user, ok
 }
 
+// GetTokenClaimsFromContext returns the claims of the access token that
+// authenticated the request
+func GetTokenClaimsFromContext(ctx context.Context) (*JWTClaims, bool) {
+	claims, ok := ctx.Value(TokenClaimsKey).(*JWTClaims)
+	return claims, ok
+}
+
+// GetAPITokenFromContext returns the personal access token that
+// authenticated the request, if any
+func GetAPITokenFromContext(ctx context.Context) (*models.APIToken, bool) {
+	apiToken, ok := ctx.Value(APITokenKey).(*models.APIToken)
+	return apiToken, ok
+}
+
+// HasScope reports whether the request may use scope. Requests authenticated
+// with a login session have every scope; personal access tokens only have
+// the scopes they were created with.
+func HasScope(ctx context.Context, scope string) bool {
+	apiToken, ok := GetAPITokenFromContext(ctx)
+	if !ok {
+		return true
+	}
+	for _, granted := range apiToken.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
 func RequireAuth() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1,10 +1,17 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 	"golang.org/x/time/rate"
 )
 
@@ -64,24 +71,67 @@ func RateLimiter(requestsPerMinute int) func(http.Handler) http.Handler {
 	}
 }
 
+// IPLimiter keeps a separate token bucket for each client IP. Buckets idle
+// long enough to have refilled are dropped, so the map only holds clients
+// seen in the last minute or so.
+type IPLimiter struct {
+	mu                sync.Mutex
+	limiters          map[string]*ipBucket
+	requestsPerMinute int
+	lastSweep         time.Time
+}
+
+type ipBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiterIdle is how long a bucket takes to refill completely; one that has
+// been idle this long is no different from a new one
+const ipLimiterIdle = time.Minute
+
+// NewIPLimiter creates a limiter allowing requestsPerMinute per client IP
+func NewIPLimiter(requestsPerMinute int) *IPLimiter {
+	return &IPLimiter{
+		limiters:          make(map[string]*ipBucket),
+		requestsPerMinute: requestsPerMinute,
+		lastSweep:         time.Now(),
+	}
+}
+
+// Allow reports whether a request from ip may proceed
+func (l *IPLimiter) Allow(ip string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) >= ipLimiterIdle {
+		for key, bucket := range l.limiters {
+			if now.Sub(bucket.lastSeen) >= ipLimiterIdle {
+				delete(l.limiters, key)
+			}
+		}
+		l.lastSweep = now
+	}
+	bucket, exists := l.limiters[ip]
+	if !exists {
+		bucket = &ipBucket{
+			limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.requestsPerMinute)), l.requestsPerMinute),
+		}
+		l.limiters[ip] = bucket
+	}
+	bucket.lastSeen = now
+	l.mu.Unlock()
+
+	return bucket.limiter.Allow()
+}
+
 // IPRateLimiter creates a per-IP rate limiting middleware
 func IPRateLimiter(requestsPerMinute int) func(http.Handler) http.Handler {
-	limiters := make(map[string]*rate.Limiter)
+	limiter := NewIPLimiter(requestsPerMinute)
 	
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := middleware.GetReqID(r.Context())
-			if ip == "" {
-				ip = r.RemoteAddr
-			}
-			
-			limiter, exists := limiters[ip]
-			if !exists {
-				limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(requestsPerMinute)), requestsPerMinute)
-				limiters[ip] = limiter
-			}
-			
-			if !limiter.Allow() {
+			if !limiter.Allow(clientIP(r)) {
 				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 				return
 			}
@@ -96,9 +146,29 @@ func GraphQLRateLimiter() func(http.Handler) http.Handler {
 	return IPRateLimiter(100) // 100 requests per minute per IP for GraphQL
 }
 
-// AuthRateLimiter creates a stricter rate limiter for authentication endpoints
-func AuthRateLimiter() func(http.Handler) http.Handler {
-	return IPRateLimiter(10) // 10 requests per minute per IP for auth operations
+// AuthRateLimiter creates a stricter rate limiter for authentication
+// operations. Login and registration are mutations on the shared /graphql
+// endpoint, so it runs as a GraphQL field middleware and only counts the
+// named Mutation fields.
+func AuthRateLimiter(fields ...string) graphql.FieldMiddleware {
+	limiter := NewIPLimiter(10) // 10 requests per minute per IP for auth operations
+	limited := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		limited[field] = true
+	}
+
+	return func(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+		fc := graphql.GetFieldContext(ctx)
+		if fc != nil && fc.Object == "Mutation" && limited[fc.Field.Name] {
+			if !limiter.Allow(ClientIPFromContext(ctx)) {
+				return nil, &gqlerror.Error{
+					Message:    "Rate limit exceeded",
+					Extensions: map[string]interface{}{"code": "RATE_LIMITED"},
+				}
+			}
+		}
+		return next(ctx)
+	}
 }
 
 // RequestTimeout adds a timeout to requests
@@ -114,4 +184,114 @@ func RequestSizeLimit(maxBytes int64) func(http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 		})
 	}
-}
\ No newline at end of file
+}
+
+// ClientIPKey holds the caller's IP address in the request context
+const ClientIPKey contextKey = "client_ip"
+
+// UserAgentKey holds the caller's User-Agent header in the request context
+const UserAgentKey contextKey = "user_agent"
+
+// ParseTrustedProxies parses the addresses and CIDR ranges of the reverse
+// proxies whose forwarding headers ClientIP believes
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", value)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// ClientIP works out the caller's IP address and stores it, with the user
+// agent, in the request context so GraphQL resolvers can see them. It also
+// replaces the request's RemoteAddr, which the logger and rate limiters read.
+// X-Forwarded-For and X-Real-IP are only believed when the request comes
+// from one of trustedProxies; anyone else could put any address in them.
+func ClientIP(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedClientIP(r, trustedProxies)
+			r.RemoteAddr = ip
+			ctx := context.WithValue(r.Context(), ClientIPKey, ip)
+			ctx = context.WithValue(ctx, UserAgentKey, r.UserAgent())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedClientIP returns the address of the first hop not in
+// trustedProxies, walking X-Forwarded-For back from the peer
+func forwardedClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	ip := clientIP(r)
+	if !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !isTrustedProxy(hop, trustedProxies) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+func isTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIPFromContext returns the IP stored by ClientIP
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ClientIPKey).(string)
+	return ip
+}
+
+// UserAgentFromContext returns the user agent stored by ClientIP
+func UserAgentFromContext(ctx context.Context) string {
+	userAgent, _ := ctx.Value(UserAgentKey).(string)
+	return userAgent
+}
+
+// clientIP returns the request's remote address without the port
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:1234", "", "", "203.0.113.7"},
+		{"spoofed by a client", "203.0.113.7:1234", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"from a trusted proxy", "10.1.2.3:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"single trusted address", "192.0.2.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"client prepends a fake hop", "10.1.2.3:1234", "198.51.100.9, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:1234", "198.51.100.1, 10.4.5.6", "", "198.51.100.1"},
+		{"X-Real-IP from a trusted proxy", "10.1.2.3:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"garbage from a trusted proxy", "10.1.2.3:1234", "", "not-an-ip", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+			ClientIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIPFromContext(r.Context())
+				if r.RemoteAddr != got {
+					t.Errorf("RemoteAddr = %q, want %q", r.RemoteAddr, got)
+				}
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"proxy.internal", "10.0.0.0/33", ""} {
+		if _, err := ParseTrustedProxies([]string{value}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", value)
+		}
+	}
+}
+
+func TestIPLimiterEvictsIdleClients(t *testing.T) {
+	l := NewIPLimiter(2)
+	l.Allow("198.51.100.1")
+	l.Allow("198.51.100.2")
+
+	// Pretend the first client has been idle long enough to refill
+	l.limiters["198.51.100.1"].lastSeen = time.Now().Add(-2 * ipLimiterIdle)
+	l.lastSweep = time.Now().Add(-2 * ipLimiterIdle)
+	l.Allow("198.51.100.2")
+
+	if _, ok := l.limiters["198.51.100.1"]; ok {
+		t.Error("idle client was not evicted")
+	}
+	if _, ok := l.limiters["198.51.100.2"]; !ok {
+		t.Error("active client was evicted")
+	}
+	// The active client has used up its two requests and stays limited
+	if l.Allow("198.51.100.2") {
+		t.Error("sweeping reset an active client's bucket")
+	}
+}
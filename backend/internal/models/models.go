@@ -10,6 +10,9 @@ type User struct {
 	Email       string    `json:"email" gorm:"unique;not null"`
 	Username    string    `json:"username" gorm:"unique;not null"`
 	Password    string    `json:"-" gorm:"not null"`
+	EmailVerified bool    `json:"emailVerified" gorm:"not null;default:false"`
+	// DeletionScheduledAt is set while a deleted account waits to be purged
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt" gorm:"index"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 	Collections []Collection `json:"collections" gorm:"foreignKey:UserID"`
@@ -21,28 +24,218 @@ type Collection struct {
 	Name        string    `json:"name" gorm:"not null"`
 	Description *string   `json:"description"`
 	Color       *string   `json:"color"`
+	// ParentID is the collection this one is nested in, nil at the top level
+	ParentID    *uint     `json:"parentId" gorm:"index"`
 	UserID      uint      `json:"userId" gorm:"not null"`
 	User        User      `json:"user" gorm:"foreignKey:UserID"`
-	Bookmarks   []Bookmark `json:"bookmarks" gorm:"foreignKey:CollectionID"`
+	Bookmarks   []Bookmark `json:"bookmarks" gorm:"foreignKey:CollectionID;constraint:OnDelete:RESTRICT"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+	// DeletedAt is set while the collection is in the trash
+	DeletedAt   gorm.DeletedAt `json:"deletedAt" gorm:"index"`
 }
 
 type Bookmark struct {
 	ID           uint       `json:"id" gorm:"primaryKey"`
 	Title        string     `json:"title" gorm:"not null"`
 	URL          string     `json:"url" gorm:"not null"`
+	// NormalizedURL is URL in the canonical form used to find duplicates
+	NormalizedURL *string   `json:"normalizedUrl"`
+	// URLKey is a hash of NormalizedURL, unique per user. It is nil in the
+	// trash and on duplicates saved before URLs were normalized.
+	URLKey       *string    `json:"-" gorm:"size:64;uniqueIndex:idx_bookmarks_user_url_key"`
 	Description  *string    `json:"description"`
 	Notes        *string    `json:"notes"`
 	Favicon      *string    `json:"favicon"`
 	Screenshot   *string    `json:"screenshot"`
-	Tags         []string   `json:"tags" gorm:"type:json"`
+	// Tags copies the names of the bookmark's BookmarkTag links so bookmarks
+	// can be read and filtered without a join
+	Tags         []string   `json:"tags" gorm:"type:json;serializer:json"`
 	CollectionID uint       `json:"collectionId" gorm:"not null"`
 	Collection   Collection `json:"collection" gorm:"foreignKey:CollectionID"`
-	UserID       uint       `json:"userId" gorm:"not null"`
+	UserID       uint       `json:"userId" gorm:"not null;uniqueIndex:idx_bookmarks_user_url_key"`
 	User         User       `json:"user" gorm:"foreignKey:UserID"`
 	CreatedAt    time.Time  `json:"createdAt"`
 	UpdatedAt    time.Time  `json:"updatedAt"`
+	// DeletedAt is set while the bookmark is in the trash
+	DeletedAt    gorm.DeletedAt `json:"deletedAt" gorm:"index"`
+}
+
+// Tag is a label a user has put on their bookmarks. Names are unique per user.
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"userId" gorm:"not null;uniqueIndex:idx_tags_user_name"`
+	Name      string    `json:"name" gorm:"size:191;not null;uniqueIndex:idx_tags_user_name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BookmarkTag links a bookmark to one of its tags
+type BookmarkTag struct {
+	BookmarkID uint `json:"bookmarkId" gorm:"primaryKey"`
+	TagID      uint `json:"tagId" gorm:"primaryKey;index"`
+}
+
+// SmartCollection is a saved bookmark filter. Its bookmarks are whichever
+// currently match the filter; unset fields do not narrow it.
+type SmartCollection struct {
+	ID           uint     `json:"id" gorm:"primaryKey"`
+	Name         string   `json:"name" gorm:"not null"`
+	Description  *string  `json:"description"`
+	Color        *string  `json:"color"`
+	Search       *string  `json:"search"`
+	Tags         []string `json:"tags" gorm:"serializer:json"`
+	// CollectionID narrows the filter to a collection. The smart collection
+	// is deleted when that collection is purged from the trash.
+	CollectionID *uint    `json:"collectionId"`
+	// IncludeDescendants extends CollectionID to its nested collections
+	IncludeDescendants bool       `json:"includeDescendants"`
+	Domain             *string    `json:"domain" gorm:"size:255"`
+	CreatedAfter       *time.Time `json:"createdAfter"`
+	CreatedBefore      *time.Time `json:"createdBefore"`
+	UserID             uint       `json:"userId" gorm:"not null;index"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+}
+
+// RefreshToken is one link in a rotation chain. Every token issued from the
+// same login shares a FamilyID; only the hash of the token is stored.
+type RefreshToken struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"userId" gorm:"not null;index"`
+	FamilyID     string     `json:"familyId" gorm:"size:64;not null;index"`
+	TokenHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt    time.Time  `json:"expiresAt" gorm:"not null"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	ReplacedByID *uint      `json:"replacedById"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// Session is a login on one device. It lives as long as its refresh token
+// family, and access tokens name it in their sid claim.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"userId" gorm:"not null;index"`
+	FamilyID   string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	JTI        string     `json:"-" gorm:"column:jti;size:64"`
+	UserAgent  string     `json:"userAgent" gorm:"size:512"`
+	IPAddress  string     `json:"ipAddress" gorm:"size:45"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// RevokedToken records an access token that was revoked before it expired.
+// Rows can be deleted once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey;size:64"`
+	UserID    uint      `json:"userId" gorm:"not null"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PasswordResetToken is a single-use token emailed to a user who forgot
+// their password. Only the hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"userId" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expiresAt" gorm:"not null"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// EmailVerificationToken is emailed at registration to confirm that the
+// user owns Email. With EmailChange set, it confirms a new address that
+// replaces the current one once verified. Only the hash of the token is stored.
+type EmailVerificationToken struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"userId" gorm:"not null;index"`
+	Email       string    `json:"email" gorm:"not null"`
+	EmailChange bool      `json:"emailChange" gorm:"not null;default:false"`
+	TokenHash   string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt   time.Time `json:"expiresAt" gorm:"not null"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// APIToken is a personal access token for scripts and browser extensions.
+// Only the hash of the token is stored; Prefix keeps its first characters so
+// users can tell their tokens apart.
+type APIToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"userId" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	Prefix     string     `json:"prefix" gorm:"size:16;not null"`
+	TokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Scopes     []string   `json:"scopes" gorm:"type:json;serializer:json"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// TOTPCredential holds a user's authenticator app secret. It is pending
+// until ConfirmedAt is set by entering a first code. LastUsedStep stops a
+// code from being used twice.
+type TOTPCredential struct {
+	UserID       uint       `json:"userId" gorm:"primaryKey"`
+	Secret       string     `json:"-" gorm:"size:64;not null"`
+	ConfirmedAt  *time.Time `json:"confirmedAt"`
+	LastUsedStep int64      `json:"-" gorm:"not null;default:0"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// RecoveryCode is a single-use code for signing in without the
+// authenticator app. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID       uint       `json:"id" gorm:"primaryKey"`
+	UserID   uint       `json:"userId" gorm:"not null;index"`
+	CodeHash string     `json:"-" gorm:"size:64;not null"`
+	UsedAt   *time.Time `json:"usedAt"`
+}
+
+// LoginChallenge is issued by login when the account has two-factor
+// authentication enabled and is completed by a TOTP or recovery code
+type LoginChallenge struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"userId" gorm:"not null;index"`
+	TokenHash string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportToken authorizes one download of an export from a link, which a
+// browser can follow without an auth header. Only the hash of the token is
+// stored, and the row is deleted when the download starts.
+type ExportToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"userId" gorm:"not null;index"`
+	TokenHash string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Format    string    `json:"format" gorm:"size:16;not null"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserIdentity links a user to their account at an OpenID Connect provider,
+// identified by the provider's issuer URL and subject
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"userId" gorm:"not null;index"`
+	Issuer    string    `json:"issuer" gorm:"size:255;not null;uniqueIndex:idx_user_identities_subject"`
+	Subject   string    `json:"subject" gorm:"size:255;not null;uniqueIndex:idx_user_identities_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// LoginThrottle counts failed logins for one account or client IP, keyed by
+// "account:<email>" or "ip:<address>". Lockouts drives the exponential
+// backoff and is cleared by a successful login.
+type LoginThrottle struct {
+	Identifier  string     `json:"identifier" gorm:"primaryKey;size:320"`
+	Failures    int        `json:"failures" gorm:"not null;default:0"`
+	Lockouts    int        `json:"lockouts" gorm:"not null;default:0"`
+	WindowStart time.Time  `json:"windowStart"`
+	LockedUntil *time.Time `json:"lockedUntil"`
+	UpdatedAt   time.Time  `json:"updatedAt" gorm:"index"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,183 @@
+// Package netscape reads and writes the Netscape bookmark file format that
+// every major browser uses for bookmark import and export.
+package netscape
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Bookmark is a single link read from a bookmark file
+type Bookmark struct {
+	Title        string
+	URL          string
+	Description  string
+	Tags         []string
+	AddDate      time.Time
+	LastModified time.Time
+	// Folders is the folder path from the top of the file, outermost first
+	Folders []string
+}
+
+// Parse reads every bookmark from a Netscape bookmark file. Folders are
+// flattened into each bookmark's Folders path.
+func Parse(r io.Reader) ([]Bookmark, error) {
+	z := html.NewTokenizer(r)
+
+	var (
+		bookmarks     []Bookmark
+		folders       []string
+		pendingFolder *string
+		seenDocument  bool
+		// lastBookmark is set while a <DD> description may still follow an <A>
+		lastBookmark = -1
+		// description collects the text of a <DD>, which has no closing tag
+		// and ends at the next element
+		description *strings.Builder
+	)
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if description != nil {
+				bookmarks[lastBookmark].Description = strings.TrimSpace(description.String())
+			}
+			if errors.Is(z.Err(), io.EOF) {
+				if !seenDocument {
+					return nil, errors.New("not a Netscape bookmark file")
+				}
+				return bookmarks, nil
+			}
+			return nil, z.Err()
+
+		case html.TextToken:
+			if description != nil {
+				description.Write(z.Text())
+			}
+			continue
+		}
+
+		if description != nil {
+			bookmarks[lastBookmark].Description = strings.TrimSpace(description.String())
+			description = nil
+			lastBookmark = -1
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "dl":
+				seenDocument = true
+				lastBookmark = -1
+				if pendingFolder != nil {
+					folders = append(folders, *pendingFolder)
+					pendingFolder = nil
+				} else {
+					folders = append(folders, "")
+				}
+
+			case "h3":
+				seenDocument = true
+				lastBookmark = -1
+				title := readText(z, "h3")
+				pendingFolder = &title
+
+			case "a":
+				seenDocument = true
+				pendingFolder = nil
+				bookmark := Bookmark{Folders: folderPath(folders)}
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					switch string(key) {
+					case "href":
+						bookmark.URL = strings.TrimSpace(string(val))
+					case "add_date":
+						bookmark.AddDate = parseTimestamp(string(val))
+					case "last_modified":
+						bookmark.LastModified = parseTimestamp(string(val))
+					case "tags":
+						bookmark.Tags = parseTags(string(val))
+					}
+				}
+				bookmark.Title = readText(z, "a")
+				bookmarks = append(bookmarks, bookmark)
+				lastBookmark = len(bookmarks) - 1
+
+			case "dd":
+				if lastBookmark >= 0 {
+					description = &strings.Builder{}
+				}
+
+			case "dt":
+				lastBookmark = -1
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if string(name) == "dl" && len(folders) > 0 {
+				folders = folders[:len(folders)-1]
+				lastBookmark = -1
+			}
+		}
+	}
+}
+
+// readText collects the text up to the closing tag of the element just opened
+func readText(z *html.Tokenizer, tag string) string {
+	var b strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(b.String())
+		case html.TextToken:
+			b.Write(z.Text())
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == tag {
+				return strings.TrimSpace(b.String())
+			}
+		}
+	}
+}
+
+func folderPath(stack []string) []string {
+	var path []string
+	for _, name := range stack {
+		if name != "" {
+			path = append(path, name)
+		}
+	}
+	return path
+}
+
+func parseTimestamp(value string) time.Time {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	// Some exporters write milliseconds or microseconds rather than seconds
+	switch {
+	case seconds > 1e14:
+		return time.UnixMicro(seconds)
+	case seconds > 1e11:
+		return time.UnixMilli(seconds)
+	}
+	return time.Unix(seconds, 0)
+}
+
+func parseTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
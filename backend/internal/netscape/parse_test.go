@@ -0,0 +1,150 @@
+package netscape
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const header = "<!DOCTYPE NETSCAPE-Bookmark-file-1>\n<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Bookmark
+	}{
+		{
+			name: "top-level bookmark",
+			in: `<DL><p>
+<DT><A HREF="https://example.com/">Example</A>
+</DL><p>`,
+			want: []Bookmark{{Title: "Example", URL: "https://example.com/"}},
+		},
+		{
+			name: "nested folders",
+			in: `<DL><p>
+<DT><H3>Work</H3>
+<DL><p>
+    <DT><H3>Reading</H3>
+    <DL><p>
+        <DT><A HREF="https://go.dev/">Go</A>
+    </DL><p>
+    <DT><A HREF="https://example.com/work">Work link</A>
+</DL><p>
+<DT><A HREF="https://example.com/top">Top</A>
+</DL><p>`,
+			want: []Bookmark{
+				{Title: "Go", URL: "https://go.dev/", Folders: []string{"Work", "Reading"}},
+				{Title: "Work link", URL: "https://example.com/work", Folders: []string{"Work"}},
+				{Title: "Top", URL: "https://example.com/top"},
+			},
+		},
+		{
+			name: "empty folder",
+			in: `<DL><p>
+<DT><H3>Empty</H3>
+<DL><p>
+</DL><p>
+<DT><A HREF="https://example.com/">After</A>
+</DL><p>`,
+			want: []Bookmark{{Title: "After", URL: "https://example.com/"}},
+		},
+		{
+			name: "missing href",
+			in: `<DL><p>
+<DT><A>No link</A>
+<DT><A HREF="  ">Blank link</A>
+</DL><p>`,
+			want: []Bookmark{{Title: "No link"}, {Title: "Blank link"}},
+		},
+		{
+			name: "entities",
+			in: `<DL><p>
+<DT><H3>R&amp;D</H3>
+<DL><p>
+    <DT><A HREF="https://example.com/?a=1&amp;b=2" TAGS="q&amp;a">Tom &amp; Jerry&#39;s &quot;best&quot; &lt;bits&gt;</A>
+    <DD>Cats &amp; mice
+</DL><p>
+</DL><p>`,
+			want: []Bookmark{{
+				Title:       `Tom & Jerry's "best" <bits>`,
+				URL:         "https://example.com/?a=1&b=2",
+				Description: "Cats & mice",
+				Tags:        []string{"q&a"},
+				Folders:     []string{"R&D"},
+			}},
+		},
+		{
+			name: "add date and last modified",
+			in: `<DL><p>
+<DT><A HREF="https://example.com/s" ADD_DATE="1700000000" LAST_MODIFIED="1700000100">Seconds</A>
+<DT><A HREF="https://example.com/ms" ADD_DATE="1700000000123">Milliseconds</A>
+<DT><A HREF="https://example.com/us" ADD_DATE="1700000000123456">Microseconds</A>
+<DT><A HREF="https://example.com/bad" ADD_DATE="yesterday" LAST_MODIFIED="-5">Invalid</A>
+</DL><p>`,
+			want: []Bookmark{
+				{Title: "Seconds", URL: "https://example.com/s", AddDate: time.Unix(1700000000, 0), LastModified: time.Unix(1700000100, 0)},
+				{Title: "Milliseconds", URL: "https://example.com/ms", AddDate: time.UnixMilli(1700000000123)},
+				{Title: "Microseconds", URL: "https://example.com/us", AddDate: time.UnixMicro(1700000000123456)},
+				{Title: "Invalid", URL: "https://example.com/bad"},
+			},
+		},
+		{
+			name: "tags and description",
+			in: `<DL><p>
+<DT><A HREF="https://example.com/" TAGS="go, ,web ">Example</A>
+<DD>A site
+for examples
+<DT><A HREF="https://example.com/2">Second</A>
+</DL><p>`,
+			want: []Bookmark{
+				{Title: "Example", URL: "https://example.com/", Tags: []string{"go", "web"}, Description: "A site\nfor examples"},
+				{Title: "Second", URL: "https://example.com/2"},
+			},
+		},
+		{
+			name: "description at end of file",
+			in: `<DL><p>
+<DT><A HREF="https://example.com/">Example</A>
+<DD>Last words`,
+			want: []Bookmark{{Title: "Example", URL: "https://example.com/", Description: "Last words"}},
+		},
+		{
+			name: "lowercase tags",
+			in: `<dl><p>
+<dt><h3>Folder</h3>
+<dl><p>
+<dt><a href="https://example.com/">Example</a>
+</dl><p>
+</dl><p>`,
+			want: []Bookmark{{Title: "Example", URL: "https://example.com/", Folders: []string{"Folder"}}},
+		},
+		{
+			name: "no bookmarks",
+			in:   "<DL><p>\n</DL><p>",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(header + tt.in))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsOtherFiles(t *testing.T) {
+	for _, in := range []string{"", "just some text", "<html><body><p>Hello</p></body></html>"} {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("Parse(%q): expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package netscape
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+const fileHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`
+
+// Writer streams a Netscape bookmark file. Folders and bookmarks are written
+// in document order, so callers can emit rows as they read them; output is
+// buffered in small chunks rather than held until Close.
+type Writer struct {
+	w       *bufio.Writer
+	depth   int
+	started bool
+}
+
+// NewWriter returns a Writer that writes to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Folder describes a folder opened with StartFolder
+type Folder struct {
+	Name         string
+	Description  string
+	AddDate      time.Time
+	LastModified time.Time
+}
+
+// StartFolder opens a folder; bookmarks written until EndFolder belong to it
+func (w *Writer) StartFolder(folder Folder) error {
+	w.start()
+	indent := w.indent()
+	fmt.Fprintf(w.w, "%s<DT><H3%s%s>%s</H3>\n",
+		indent,
+		timestampAttr("ADD_DATE", folder.AddDate),
+		timestampAttr("LAST_MODIFIED", folder.LastModified),
+		html.EscapeString(folder.Name),
+	)
+	if folder.Description != "" {
+		fmt.Fprintf(w.w, "%s<DD>%s\n", indent, html.EscapeString(folder.Description))
+	}
+	fmt.Fprintf(w.w, "%s<DL><p>\n", indent)
+	w.depth++
+	return w.err()
+}
+
+// EndFolder closes the innermost open folder
+func (w *Writer) EndFolder() error {
+	if w.depth == 0 {
+		return fmt.Errorf("netscape: EndFolder without matching StartFolder")
+	}
+	w.depth--
+	fmt.Fprintf(w.w, "%s</DL><p>\n", w.indent())
+	return w.err()
+}
+
+// WriteBookmark writes a bookmark into the innermost open folder. Its
+// Folders field is ignored.
+func (w *Writer) WriteBookmark(b Bookmark) error {
+	w.start()
+	indent := w.indent()
+	tags := ""
+	if len(b.Tags) > 0 {
+		tags = fmt.Sprintf(` TAGS="%s"`, html.EscapeString(strings.Join(b.Tags, ",")))
+	}
+	fmt.Fprintf(w.w, "%s<DT><A HREF=\"%s\"%s%s%s>%s</A>\n",
+		indent,
+		html.EscapeString(b.URL),
+		timestampAttr("ADD_DATE", b.AddDate),
+		timestampAttr("LAST_MODIFIED", b.LastModified),
+		tags,
+		html.EscapeString(b.Title),
+	)
+	if b.Description != "" {
+		fmt.Fprintf(w.w, "%s<DD>%s\n", indent, html.EscapeString(b.Description))
+	}
+	return w.err()
+}
+
+// Close closes any open folders, ends the document and flushes buffered output
+func (w *Writer) Close() error {
+	w.start()
+	for w.depth > 0 {
+		if err := w.EndFolder(); err != nil {
+			return err
+		}
+	}
+	w.w.WriteString("</DL><p>\n")
+	return w.w.Flush()
+}
+
+func (w *Writer) start() {
+	if !w.started {
+		w.w.WriteString(fileHeader)
+		w.started = true
+	}
+}
+
+// err reports the first write error, which bufio keeps until flushed
+func (w *Writer) err() error {
+	_, err := w.w.Write(nil)
+	return err
+}
+
+func (w *Writer) indent() string {
+	return strings.Repeat("    ", w.depth+1)
+}
+
+func timestampAttr(name string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(` %s="%d"`, name, t.Unix())
+}
@@ -0,0 +1,163 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"markly-backend/internal/models"
+)
+
+const (
+	// snippetLength is roughly how many characters of a field a snippet shows
+	snippetLength = 160
+	// snippetLead is how much of the text before the first match it shows
+	snippetLead = 40
+)
+
+// Highlight is an excerpt of one of a bookmark's fields around the words a
+// query matched in it
+type Highlight struct {
+	Field   string
+	Snippet string
+}
+
+// Highlights returns an excerpt of each searchable field of bookmark in which
+// the words or phrases of q appear. Snippets are HTML: the text is escaped and
+// the matches are wrapped in <mark>.
+func (q *Query) Highlights(bookmark *models.Bookmark) []Highlight {
+	if q.Text.Empty() {
+		return nil
+	}
+
+	fields := []struct {
+		name string
+		text *string
+	}{
+		{"title", &bookmark.Title},
+		{"description", bookmark.Description},
+		{"notes", bookmark.Notes},
+		{"url", &bookmark.URL},
+	}
+	var highlights []Highlight
+	for _, field := range fields {
+		if field.text == nil {
+			continue
+		}
+		if snippet, ok := q.snippet(*field.text); ok {
+			highlights = append(highlights, Highlight{Field: field.name, Snippet: snippet})
+		}
+	}
+	return highlights
+}
+
+// snippet cuts text down to the part around its first match and marks the
+// matches in it. It reports false when nothing in text matches.
+func (q *Query) snippet(text string) (string, bool) {
+	spans := word.FindAllStringIndex(text, -1)
+	marked := q.matches(text, spans)
+
+	first := -1
+	for i := range spans {
+		if marked[i] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	// Start a little before the first match and stop at about snippetLength,
+	// without cutting words in half where there is a space to cut at instead
+	matchStart := spans[first][0]
+	start := backRunes(text, matchStart, snippetLead)
+	if start > 0 {
+		if space := strings.IndexFunc(text[start:matchStart], unicode.IsSpace); space >= 0 {
+			start += space + 1
+		}
+	}
+	end := forwardRunes(text, start, snippetLength)
+	if end < len(text) {
+		if space := strings.LastIndexFunc(text[matchStart:end], unicode.IsSpace); space > 0 {
+			end = matchStart + space
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for i, span := range spans {
+		if !marked[i] || span[0] < start || span[1] > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:span[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[span[0]:span[1]]))
+		b.WriteString("</mark>")
+		pos = span[1]
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// matches reports for each word of text, given by spans, whether it is part
+// of a match for q: a word starting with one of the query's words, or a run of
+// words spelling out one of its phrases
+func (q *Query) matches(text string, spans [][]int) []bool {
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = strings.ToLower(text[span[0]:span[1]])
+	}
+
+	marked := make([]bool, len(spans))
+	for i, w := range words {
+		for _, prefix := range q.Text.Words {
+			if strings.HasPrefix(w, prefix) {
+				marked[i] = true
+				break
+			}
+		}
+		for _, phrase := range q.Text.Phrases {
+			if i+len(phrase) <= len(words) && equalWords(words[i:i+len(phrase)], phrase) {
+				for j := range phrase {
+					marked[i+j] = true
+				}
+			}
+		}
+	}
+	return marked
+}
+
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// backRunes returns the byte offset n runes before offset i in s
+func backRunes(s string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return i
+}
+
+// forwardRunes returns the byte offset n runes after offset i in s
+func forwardRunes(s string, i, n int) int {
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,278 @@
+// Package search parses bookmark search queries and turns them into
+// database conditions.
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"markly-backend/internal/database"
+)
+
+// Query is a parsed search query
+type Query struct {
+	// Text holds the words and phrases that must all appear
+	Text database.TextQuery
+	// Excluded holds the words and phrases none of which may appear
+	Excluded database.TextQuery
+
+	Tags         []string
+	ExcludedTags []string
+	// Sites are host names; bookmarks on any of them or their subdomains match
+	Sites         []string
+	ExcludedSites []string
+	// Collections are lowercased collection names; bookmarks in any of them match
+	Collections         []string
+	ExcludedCollections []string
+
+	// After and Before bound the creation time, After inclusive
+	After  *time.Time
+	Before *time.Time
+}
+
+// word matches the runs of letters and digits that search works with; the
+// full-text indexes split text the same way
+var word = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+const dateLayout = "2006-01-02"
+
+var operators = map[string]bool{"tag": true, "site": true, "in": true, "before": true, "after": true}
+
+// Parse reads a search query. Plain words must all appear in a bookmark, as
+// the start of a word, and "quoted phrases" as written. Operators narrow the
+// results down further:
+//
+//	tag:go             carries the tag go
+//	site:github.com    is on github.com or one of its subdomains
+//	in:"Reading list"  is in the collection with that name
+//	after:2024-01-31   was created on or after that day (UTC)
+//	before:2024-01-31  was created before that day
+//
+// A leading - excludes what a word, phrase or operator matches. Every tag:
+// has to match, but only one of several site: or in: operators.
+func Parse(input string) (*Query, error) {
+	q := &Query{}
+	for _, t := range tokenize(input) {
+		switch t.operator {
+		case "":
+			words := lowerWords(t.value)
+			text := &q.Text
+			if t.negated {
+				text = &q.Excluded
+			}
+			switch {
+			case len(words) == 0:
+			case len(words) == 1 && !t.quoted:
+				text.Words = append(text.Words, words[0])
+			default:
+				// Words joined by punctuation, as in foo-bar, are a phrase too
+				text.Phrases = append(text.Phrases, words)
+			}
+		case "tag":
+			tag := strings.ToLower(strings.TrimSpace(t.value))
+			if tag == "" {
+				continue
+			}
+			if t.negated {
+				q.ExcludedTags = append(q.ExcludedTags, tag)
+			} else {
+				q.Tags = append(q.Tags, tag)
+			}
+		case "site":
+			host := SiteHost(t.value)
+			if host == "" {
+				continue
+			}
+			if t.negated {
+				q.ExcludedSites = append(q.ExcludedSites, host)
+			} else {
+				q.Sites = append(q.Sites, host)
+			}
+		case "in":
+			name := strings.ToLower(strings.TrimSpace(t.value))
+			if name == "" {
+				continue
+			}
+			if t.negated {
+				q.ExcludedCollections = append(q.ExcludedCollections, name)
+			} else {
+				q.Collections = append(q.Collections, name)
+			}
+		case "before", "after":
+			day, err := time.ParseInLocation(dateLayout, t.value, time.UTC)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date %q for %s:, expected YYYY-MM-DD", t.value, t.operator)
+			}
+			// Excluding what comes after a day leaves what comes before it
+			if (t.operator == "after") != t.negated {
+				if q.After == nil || day.After(*q.After) {
+					q.After = &day
+				}
+			} else if q.Before == nil || day.Before(*q.Before) {
+				q.Before = &day
+			}
+		}
+	}
+	return q, nil
+}
+
+// Apply narrows a bookmark query to the bookmarks matching q
+func (q *Query) Apply(db *gorm.DB) *gorm.DB {
+	dialect := database.DialectOf(db)
+
+	if !q.Text.Empty() {
+		db = db.Where(dialect.FullTextMatch(q.Text))
+	}
+	// Each excluded word or phrase is ruled out on its own
+	for _, w := range q.Excluded.Words {
+		db = db.Where(not(dialect.FullTextMatch(database.TextQuery{Words: []string{w}})))
+	}
+	for _, phrase := range q.Excluded.Phrases {
+		db = db.Where(not(dialect.FullTextMatch(database.TextQuery{Phrases: [][]string{phrase}})))
+	}
+
+	for _, tag := range q.Tags {
+		db = db.Where(hasTag, tag)
+	}
+	for _, tag := range q.ExcludedTags {
+		db = db.Where("NOT "+hasTag, tag)
+	}
+
+	if len(q.Sites) > 0 {
+		db = db.Where(dialect.LikeAny("bookmarks.url", sitePatterns(q.Sites)))
+	}
+	if len(q.ExcludedSites) > 0 {
+		db = db.Where(not(dialect.LikeAny("bookmarks.url", sitePatterns(q.ExcludedSites))))
+	}
+
+	if len(q.Collections) > 0 {
+		db = db.Where(inCollection, q.Collections)
+	}
+	if len(q.ExcludedCollections) > 0 {
+		db = db.Where("NOT "+inCollection, q.ExcludedCollections)
+	}
+
+	if q.After != nil {
+		db = db.Where("bookmarks.created_at >= ?", *q.After)
+	}
+	if q.Before != nil {
+		db = db.Where("bookmarks.created_at < ?", *q.Before)
+	}
+	return db
+}
+
+// Rank returns the expression scoring how well a bookmark matches the words
+// and phrases of q
+func (q *Query) Rank(db *gorm.DB) clause.Expression {
+	return database.DialectOf(db).FullTextRank(q.Text)
+}
+
+const (
+	hasTag = "EXISTS (SELECT 1 FROM bookmark_tags bt JOIN tags t ON t.id = bt.tag_id " +
+		"WHERE bt.bookmark_id = bookmarks.id AND LOWER(t.name) = ?)"
+	inCollection = "EXISTS (SELECT 1 FROM collections c " +
+		"WHERE c.id = bookmarks.collection_id AND LOWER(c.name) IN ?)"
+)
+
+func not(expr clause.Expression) clause.Expression {
+	return clause.Expr{SQL: "NOT (?)", Vars: []interface{}{expr}}
+}
+
+// sitePatterns returns LIKE patterns matching URLs on hosts or their
+// subdomains. The host ends at the first /, :, ? or #.
+func sitePatterns(hosts []string) []string {
+	var patterns []string
+	for _, host := range hosts {
+		host = database.EscapeLike(host)
+		for _, prefix := range []string{"%://", "%://%."} {
+			patterns = append(patterns, prefix+host)
+			for _, end := range []string{"/", ":", "?", "#"} {
+				patterns = append(patterns, prefix+host+end+"%")
+			}
+		}
+	}
+	return patterns
+}
+
+// SiteHost reduces the value of site: to a host name, so that a full URL
+// works as well
+func SiteHost(value string) string {
+	host := strings.ToLower(strings.TrimSpace(value))
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, "/:?#"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.Trim(host, ".")
+}
+
+func lowerWords(s string) []string {
+	words := word.FindAllString(s, -1)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return words
+}
+
+type token struct {
+	negated  bool
+	operator string
+	value    string
+	quoted   bool
+}
+
+// tokenize splits a query on whitespace, keeping quoted values together. An
+// unterminated quote runs to the end of the query.
+func tokenize(input string) []token {
+	runes := []rune(input)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var t token
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			t.negated = true
+			i++
+		}
+
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != ':' && runes[i] != '"' {
+			i++
+		}
+		if name := strings.ToLower(string(runes[start:i])); i < len(runes) && runes[i] == ':' && operators[name] {
+			t.operator = name
+			i++
+		} else {
+			i = start
+		}
+
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			t.value = string(runes[i+1 : end])
+			t.quoted = true
+			i = min(end+1, len(runes))
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			t.value = string(runes[i:end])
+			i = end
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
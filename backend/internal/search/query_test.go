@@ -0,0 +1,141 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"markly-backend/internal/database"
+)
+
+func day(s string) *time.Time {
+	t, err := time.ParseInLocation(dateLayout, s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Query
+	}{
+		{
+			name:  "empty",
+			input: "   ",
+			want:  Query{},
+		},
+		{
+			name:  "words are lowercased",
+			input: "Go Generics",
+			want:  Query{Text: database.TextQuery{Words: []string{"go", "generics"}}},
+		},
+		{
+			name:  "quoted phrase",
+			input: `"error handling" go`,
+			want: Query{Text: database.TextQuery{
+				Words:   []string{"go"},
+				Phrases: [][]string{{"error", "handling"}},
+			}},
+		},
+		{
+			name:  "punctuated words are a phrase",
+			input: "foo-bar",
+			want:  Query{Text: database.TextQuery{Phrases: [][]string{{"foo", "bar"}}}},
+		},
+		{
+			name:  "excluded word and phrase",
+			input: `-draft -"work in progress"`,
+			want: Query{Excluded: database.TextQuery{
+				Words:   []string{"draft"},
+				Phrases: [][]string{{"work", "in", "progress"}},
+			}},
+		},
+		{
+			name:  "tags",
+			input: "tag:Go -tag:old",
+			want:  Query{Tags: []string{"go"}, ExcludedTags: []string{"old"}},
+		},
+		{
+			name:  "sites from hosts and URLs",
+			input: "site:GitHub.com -site:https://gist.github.com/x",
+			want:  Query{Sites: []string{"github.com"}, ExcludedSites: []string{"gist.github.com"}},
+		},
+		{
+			name:  "quoted collection",
+			input: `in:"Reading List" -in:archive`,
+			want:  Query{Collections: []string{"reading list"}, ExcludedCollections: []string{"archive"}},
+		},
+		{
+			name:  "dates keep the narrowest bounds",
+			input: "after:2024-01-01 after:2024-02-01 before:2024-06-01 before:2024-05-01",
+			want:  Query{After: day("2024-02-01"), Before: day("2024-05-01")},
+		},
+		{
+			name:  "excluded dates flip",
+			input: "-after:2024-06-01 -before:2024-01-01",
+			want:  Query{After: day("2024-01-01"), Before: day("2024-06-01")},
+		},
+		{
+			name:  "operator names are case-insensitive",
+			input: "TAG:go",
+			want:  Query{Tags: []string{"go"}},
+		},
+		{
+			name:  "unknown operators are words",
+			input: "note:this",
+			want:  Query{Text: database.TextQuery{Phrases: [][]string{{"note", "this"}}}},
+		},
+		{
+			name:  "empty operator values are ignored",
+			input: `tag: site: in:""`,
+			want:  Query{},
+		},
+		{
+			name:  "unterminated quote runs to the end",
+			input: `"open ended`,
+			want:  Query{Text: database.TextQuery{Phrases: [][]string{{"open", "ended"}}}},
+		},
+		{
+			name:  "lone dash is not a negation",
+			input: "a - b",
+			want:  Query{Text: database.TextQuery{Words: []string{"a", "b"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalidDate(t *testing.T) {
+	for _, input := range []string{"after:yesterday", "before:2024-13-01", "after:"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) returned no error", input)
+		}
+	}
+}
+
+func TestSiteHost(t *testing.T) {
+	tests := map[string]string{
+		"example.com":                   "example.com",
+		"  Example.COM ":                "example.com",
+		"https://www.example.com/a?b=c": "www.example.com",
+		"example.com:8080":              "example.com",
+		".example.com.":                 "example.com",
+	}
+	for in, want := range tests {
+		if got := SiteHost(in); got != want {
+			t.Errorf("SiteHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
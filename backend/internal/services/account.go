@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/models"
+)
+
+var ErrIncorrectPassword = errors.New("incorrect password")
+
+// AccountService deletes accounts along with everything stored for them. With
+// a grace period, deleted accounts are signed out and kept until the purger
+// removes them; signing in again before then restores the account.
+type AccountService struct {
+	db          *gorm.DB
+	images      *ImageCaptureService
+	gracePeriod time.Duration
+}
+
+func NewAccountService(db *gorm.DB, images *ImageCaptureService, gracePeriod time.Duration) *AccountService {
+	return &AccountService{
+		db:          db,
+		images:      images,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// userOwnedTables lists every model keyed by user_id, deleted with the account
+var userOwnedTables = []interface{}{
+	&models.Bookmark{},
+	&models.Tag{},
+	&models.SmartCollection{},
+	&models.Collection{},
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.Session{},
+	&models.PasswordResetToken{},
+	&models.EmailVerificationToken{},
+	&models.APIToken{},
+	&models.TOTPCredential{},
+	&models.RecoveryCode{},
+	&models.LoginChallenge{},
+	&models.ExportToken{},
+	&models.UserIdentity{},
+}
+
+// Delete deletes userID's account, whose password the caller has checked. It
+// returns when the account will be purged, or nil if it was purged right away.
+func (s *AccountService) Delete(ctx context.Context, userID uint) (*time.Time, error) {
+	if s.gracePeriod <= 0 {
+		return nil, s.Purge(ctx, userID)
+	}
+
+	purgeAt := time.Now().Add(s.gracePeriod)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", purgeAt).Error; err != nil {
+			return err
+		}
+		// API tokens are not restored with the account
+		return tx.Where("user_id = ?", userID).Delete(&models.APIToken{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &purgeAt, nil
+}
+
+// Restore cancels a pending deletion of userID's account
+func (s *AccountService) Restore(ctx context.Context, userID uint) error {
+	result := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).
+		Update("deletion_scheduled_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Deletion of user %d cancelled by signing in", userID)
+	}
+	return nil
+}
+
+// Purge permanently deletes userID's account, its data and its images
+func (s *AccountService) Purge(ctx context.Context, userID uint) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	var imageURLs []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var bookmarks []models.Bookmark
+		if err := tx.Unscoped().Select("favicon", "screenshot").Where("user_id = ?", userID).Find(&bookmarks).Error; err != nil {
+			return err
+		}
+		for i := range bookmarks {
+			imageURLs = appendImageURLs(imageURLs, &bookmarks[i])
+		}
+
+		// Links are keyed by tag rather than user
+		userTags := tx.Model(&models.Tag{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("tag_id IN (?)", userTags).Delete(&models.BookmarkTag{}).Error; err != nil {
+			return err
+		}
+		// Collections are deleted one row at a time on MySQL, so the links
+		// between them have to go first
+		if err := tx.Model(&models.Collection{}).Unscoped().Where("user_id = ?", userID).
+			UpdateColumn("parent_id", nil).Error; err != nil {
+			return err
+		}
+		// Unscoped, so that bookmarks and collections in the trash go too
+		for _, table := range userOwnedTables {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("identifier = ?", "account:"+user.Email).Delete(&models.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, userID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files cannot be part of the transaction, so they go once the rows are gone
+	removeUnusedImages(ctx, s.db, s.images, imageURLs)
+	log.Printf("Purged account %d", userID)
+	return nil
+}
+
+// PurgeDue purges every account whose grace period has ended
+func (s *AccountService) PurgeDue(ctx context.Context) (int, error) {
+	var userIDs []uint
+	if err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		Pluck("id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		if err := s.Purge(ctx, userID); err != nil {
+			log.Printf("Failed to purge account %d: %v", userID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// RunPurger calls PurgeDue every interval until ctx is cancelled
+func (s *AccountService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.PurgeDue(ctx); err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// appendImageURLs appends the captured images of bookmark to imageURLs
+func appendImageURLs(imageURLs []string, bookmark *models.Bookmark) []string {
+	for _, imageURL := range []*string{bookmark.Favicon, bookmark.Screenshot} {
+		if imageURL != nil && *imageURL != "" {
+			imageURLs = append(imageURLs, *imageURL)
+		}
+	}
+	return imageURLs
+}
+
+// removeUnusedImages deletes captured image files no remaining bookmark,
+// including those in the trash, refers to
+func removeUnusedImages(ctx context.Context, db *gorm.DB, images *ImageCaptureService, imageURLs []string) {
+	if images == nil {
+		return
+	}
+
+	for _, imageURL := range imageURLs {
+		localPath, ok := images.LocalPath(imageURL)
+		if !ok {
+			continue
+		}
+
+		var count int64
+		if err := db.WithContext(ctx).Unscoped().Model(&models.Bookmark{}).
+			Where("favicon = ? OR screenshot = ?", imageURL, imageURL).
+			Count(&count).Error; err != nil || count > 0 {
+			continue
+		}
+		if err := os.Remove(localPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove image %s: %v", localPath, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+func TestDeleteAccountImmediately(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	collection := testdb.CreateCollection(t, db, user.ID, "Root", 0)
+	testdb.CreateCollection(t, db, user.ID, "Child", collection.ID)
+	testdb.CreateBookmark(t, db, user.ID, collection.ID, "https://a.example")
+	sessions := NewRefreshTokenService(db, time.Hour)
+	issued, err := sessions.Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewAccountService(db, nil, 0)
+	purgeAt, err := s.Delete(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purgeAt != nil {
+		t.Errorf("Delete without a grace period scheduled a purge at %s", purgeAt)
+	}
+
+	for _, model := range []interface{}{&models.User{}, &models.Collection{}, &models.Bookmark{}, &models.Session{}, &models.RefreshToken{}} {
+		var count int64
+		db.Unscoped().Model(model).Count(&count)
+		if count != 0 {
+			t.Errorf("%d %T rows left after the purge", count, model)
+		}
+	}
+	if sessions.TouchSession(context.Background(), issued.FamilyID, "jti") {
+		t.Error("session of a purged account still accepted")
+	}
+}
+
+func TestDeleteAccountWithGracePeriod(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewAccountService(db, nil, time.Hour)
+	ctx := context.Background()
+
+	purgeAt, err := s.Delete(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purgeAt == nil {
+		t.Fatal("Delete with a grace period purged the account right away")
+	}
+
+	var scheduled models.User
+	if err := db.First(&scheduled, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if scheduled.DeletionScheduledAt == nil {
+		t.Fatal("deletion not scheduled")
+	}
+
+	if err := s.Restore(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	var restored models.User
+	if err := db.First(&restored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletionScheduledAt != nil {
+		t.Error("deletion still scheduled after Restore")
+	}
+}
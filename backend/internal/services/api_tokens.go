@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/middleware"
+	"markly-backend/internal/models"
+)
+
+// Scopes a personal access token can be granted
+const (
+	ScopeBookmarksRead  = "bookmarks:read"
+	ScopeBookmarksWrite = "bookmarks:write"
+)
+
+const (
+	maxAPITokensPerUser = 50
+	// lastUsedResolution limits how often a token's last-used time is written
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrInvalidAPIToken  = errors.New("invalid API token")
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+var validScopes = map[string]bool{
+	ScopeBookmarksRead:  true,
+	ScopeBookmarksWrite: true,
+}
+
+// APITokenService manages personal access tokens
+type APITokenService struct {
+	db *gorm.DB
+}
+
+func NewAPITokenService(db *gorm.DB) *APITokenService {
+	return &APITokenService{db: db}
+}
+
+// Create issues a token for userID. The returned token string is the only
+// copy; the database keeps its hash.
+func (s *APITokenService) Create(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", nil, errors.New("token name must be between 1 and 100 characters")
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("token expiry must be in the future")
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.APIToken{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return "", nil, err
+	}
+	if count >= maxAPITokensPerUser {
+		return "", nil, fmt.Errorf("too many API tokens (maximum %d)", maxAPITokensPerUser)
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token := middleware.APITokenPrefix + secret
+
+	record := &models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(middleware.APITokenPrefix)+8],
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// List returns userID's tokens, newest first
+func (s *APITokenService) List(ctx context.Context, userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke deletes one of userID's tokens
+func (s *APITokenService) Revoke(ctx context.Context, userID, id uint) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// VerifyAPIToken looks up an unexpired token and records that it was used.
+// It implements middleware.APITokenVerifier.
+func (s *APITokenService) VerifyAPIToken(ctx context.Context, token string) (*models.APIToken, error) {
+	var record models.APIToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", hashToken(token)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if record.ExpiresAt != nil && now.After(*record.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedResolution {
+		if err := s.db.WithContext(ctx).Model(&models.APIToken{}).
+			Where("id = ?", record.ID).
+			Update("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+		record.LastUsedAt = &now
+	}
+	return &record, nil
+}
+
+// normalizeScopes rejects unknown scopes and removes duplicates
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !validScopes[scope] {
+			return nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/urlcanon"
+)
+
+var ErrBookmarkNotFound = errors.New("bookmark not found")
+
+// DuplicateGroup is a set of bookmarks whose URLs have the same canonical form
+type DuplicateGroup struct {
+	NormalizedURL string
+	Bookmarks     []models.Bookmark
+}
+
+// DuplicateService keeps the canonical URL of each bookmark, which lets a
+// user bookmark a page only once, and finds and merges the duplicates saved
+// before URLs were normalized.
+type DuplicateService struct {
+	db   *gorm.DB
+	tags *TagService
+}
+
+func NewDuplicateService(db *gorm.DB, tags *TagService) *DuplicateService {
+	return &DuplicateService{db: db, tags: tags}
+}
+
+// Normalize sets bookmark's NormalizedURL and URLKey from its URL
+func (s *DuplicateService) Normalize(bookmark *models.Bookmark) error {
+	normalized, err := urlcanon.Canonicalize(bookmark.URL)
+	if err != nil {
+		return err
+	}
+	key := urlKey(normalized)
+	bookmark.NormalizedURL = &normalized
+	bookmark.URLKey = &key
+	return nil
+}
+
+// FindDuplicate returns the bookmark of userID outside the trash, other than
+// excludeID, whose URL has the canonical form normalizedURL, or nil if there
+// is none. The bookmark holding the URL key is looked up by its index; only
+// if there is none are the unkeyed duplicates saved before URLs were
+// normalized compared by canonical URL.
+func (s *DuplicateService) FindDuplicate(tx *gorm.DB, userID uint, normalizedURL string, excludeID uint) (*models.Bookmark, error) {
+	var bookmarks []models.Bookmark
+	if err := tx.Where("user_id = ? AND url_key = ? AND id <> ?", userID, urlKey(normalizedURL), excludeID).
+		Limit(1).Find(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+	if len(bookmarks) > 0 {
+		return &bookmarks[0], nil
+	}
+
+	// url_key IS NULL keeps this on the (user_id, url_key) index
+	if err := tx.Where("user_id = ? AND url_key IS NULL AND normalized_url = ? AND id <> ?", userID, normalizedURL, excludeID).
+		Order("id").Limit(1).Find(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+	if len(bookmarks) == 0 {
+		return nil, nil
+	}
+	return &bookmarks[0], nil
+}
+
+// Groups returns userID's bookmarks that share a canonical URL with another
+// one, grouped by it, oldest first within each group
+func (s *DuplicateService) Groups(ctx context.Context, userID uint) ([]DuplicateGroup, error) {
+	db := s.db.WithContext(ctx)
+
+	var urls []string
+	if err := db.Model(&models.Bookmark{}).
+		Where("user_id = ? AND normalized_url IS NOT NULL", userID).
+		Group("normalized_url").Having("COUNT(*) > 1").
+		Order("normalized_url").Pluck("normalized_url", &urls).Error; err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	var bookmarks []models.Bookmark
+	if err := db.Where("user_id = ? AND normalized_url IN ?", userID, urls).
+		Order("created_at, id").Find(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+
+	groups := make([]DuplicateGroup, len(urls))
+	index := make(map[string]int, len(urls))
+	for i, url := range urls {
+		groups[i].NormalizedURL = url
+		index[url] = i
+	}
+	for _, bookmark := range bookmarks {
+		i := index[*bookmark.NormalizedURL]
+		groups[i].Bookmarks = append(groups[i].Bookmarks, bookmark)
+	}
+	return groups, nil
+}
+
+// Merge folds sourceIDs into targetID, all bookmarks of userID. The target
+// gains the sources' tags and notes, fills its missing description and
+// images from them and keeps the earliest creation time. The sources are
+// moved to the trash.
+func (s *DuplicateService) Merge(ctx context.Context, userID, targetID uint, sourceIDs []uint) (*models.Bookmark, error) {
+	var target models.Bookmark
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", targetID, userID).First(&target).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBookmarkNotFound
+			}
+			return err
+		}
+
+		ids := make([]uint, 0, len(sourceIDs))
+		for _, id := range uniqueIDs(sourceIDs) {
+			if id != targetID {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		var sources []models.Bookmark
+		if err := tx.Where("id IN ? AND user_id = ?", ids, userID).Order("created_at, id").Find(&sources).Error; err != nil {
+			return err
+		}
+		if len(sources) != len(ids) {
+			return ErrBookmarkNotFound
+		}
+
+		for _, source := range sources {
+			mergeBookmark(&target, &source)
+		}
+
+		// The sources go first so that the target can take over their URL key
+		if err := tx.Model(&models.Bookmark{}).Where("id IN ?", ids).
+			UpdateColumns(trashedBookmarkColumns(trashTime())).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("tags", "notes", "description", "favicon", "screenshot", "created_at", "updated_at").
+			Save(&target).Error; err != nil {
+			return err
+		}
+		if err := s.tags.LinkTags(tx, &target); err != nil {
+			return err
+		}
+		if err := assignURLKeys(tx, []uint{target.ID}); err != nil {
+			return err
+		}
+		return tx.First(&target, target.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// NormalizeURLs fills in the canonical URL of bookmarks saved before URLs
+// were normalized. Where several of a user's bookmarks turn out to share one,
+// the first one saved gets the URL key and the others are left for the user
+// to merge.
+func (s *DuplicateService) NormalizeURLs(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+	var bookmarks []models.Bookmark
+	normalized := 0
+	result := db.Unscoped().Select("id", "url").
+		Where("normalized_url IS NULL").
+		FindInBatches(&bookmarks, 500, func(_ *gorm.DB, _ int) error {
+			ids := make([]uint, len(bookmarks))
+			for i, bookmark := range bookmarks {
+				ids[i] = bookmark.ID
+				url, err := urlcanon.Canonicalize(bookmark.URL)
+				if err != nil {
+					// Keep malformed URLs comparable with themselves
+					url = strings.TrimSpace(bookmark.URL)
+				}
+				if err := db.Unscoped().Model(&models.Bookmark{}).Where("id = ?", bookmark.ID).
+					UpdateColumn("normalized_url", url).Error; err != nil {
+					return err
+				}
+			}
+			normalized += len(ids)
+			return assignURLKeys(db, ids)
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if normalized > 0 {
+		log.Printf("Normalized the URLs of %d bookmarks", normalized)
+	}
+	return nil
+}
+
+// mergeBookmark adds what source holds and target lacks to target
+func mergeBookmark(target, source *models.Bookmark) {
+	for _, tag := range source.Tags {
+		if !containsFold(target.Tags, tag) {
+			target.Tags = append(target.Tags, tag)
+		}
+	}
+
+	if source.Notes != nil && strings.TrimSpace(*source.Notes) != "" {
+		notes := *source.Notes
+		if target.Notes != nil && strings.TrimSpace(*target.Notes) != "" {
+			notes = *target.Notes + "\n\n" + notes
+		}
+		target.Notes = &notes
+	}
+
+	for _, field := range []struct{ target, source **string }{
+		{&target.Description, &source.Description},
+		{&target.Favicon, &source.Favicon},
+		{&target.Screenshot, &source.Screenshot},
+	} {
+		if (*field.target == nil || **field.target == "") && *field.source != nil {
+			*field.target = *field.source
+		}
+	}
+
+	if source.CreatedAt.Before(target.CreatedAt) {
+		target.CreatedAt = source.CreatedAt
+	}
+}
+
+// assignURLKeys gives the bookmarks in ids outside the trash the URL key of
+// their canonical URL, unless another bookmark of the same user holds it
+// already; those remain duplicates of it
+func assignURLKeys(tx *gorm.DB, ids []uint) error {
+	var bookmarks []models.Bookmark
+	if err := tx.Select("id", "user_id", "normalized_url").
+		Where("id IN ? AND normalized_url IS NOT NULL AND url_key IS NULL", ids).
+		Order("id").Find(&bookmarks).Error; err != nil {
+		return err
+	}
+
+	for _, bookmark := range bookmarks {
+		key := urlKey(*bookmark.NormalizedURL)
+		var count int64
+		if err := tx.Model(&models.Bookmark{}).Where("user_id = ? AND url_key = ?", bookmark.UserID, key).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := tx.Model(&models.Bookmark{}).Where("id = ?", bookmark.ID).
+			UpdateColumn("url_key", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// urlKey hashes a canonical URL into a value short enough for a unique index
+func urlKey(normalizedURL string) string {
+	sum := sha256.Sum256([]byte(normalizedURL))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+	"markly-backend/internal/urlcanon"
+)
+
+func TestFindDuplicate(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewDuplicateService(db, NewTagService(db))
+	ctx := context.Background()
+	alice := testdb.CreateUser(t, db, "alice")
+	bob := testdb.CreateUser(t, db, "bob")
+	collection := testdb.CreateCollection(t, db, alice.ID, "Root", 0)
+	bobCollection := testdb.CreateCollection(t, db, bob.ID, "Root", 0)
+
+	// Saved before URLs were normalized: the first one gets the URL key and
+	// the second is left as an unkeyed duplicate
+	keyed := testdb.CreateBookmark(t, db, alice.ID, collection.ID, "https://example.com/page")
+	legacy := testdb.CreateBookmark(t, db, alice.ID, collection.ID, "HTTPS://EXAMPLE.COM/page")
+	testdb.CreateBookmark(t, db, bob.ID, bobCollection.ID, "https://example.com/other")
+	if err := s.NormalizeURLs(ctx); err != nil {
+		t.Fatalf("NormalizeURLs: %v", err)
+	}
+	var stored models.Bookmark
+	db.First(&stored, legacy.ID)
+	if stored.URLKey != nil {
+		t.Fatal("the second bookmark of a URL was given its key")
+	}
+
+	normalized, err := urlcanon.Canonicalize("https://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func(userID uint, url string, excludeID uint) uint {
+		t.Helper()
+		duplicate, err := s.FindDuplicate(db, userID, url, excludeID)
+		if err != nil {
+			t.Fatalf("FindDuplicate: %v", err)
+		}
+		if duplicate == nil {
+			return 0
+		}
+		return duplicate.ID
+	}
+
+	if got := find(alice.ID, normalized, 0); got != keyed.ID {
+		t.Errorf("FindDuplicate = %d, want the keyed bookmark %d", got, keyed.ID)
+	}
+	if got := find(alice.ID, normalized, keyed.ID); got != legacy.ID {
+		t.Errorf("FindDuplicate excluding the keyed bookmark = %d, want the unkeyed duplicate %d", got, legacy.ID)
+	}
+	if got := find(bob.ID, normalized, 0); got != 0 {
+		t.Errorf("FindDuplicate for another user = %d, want none", got)
+	}
+
+	other, err := urlcanon.Canonicalize("https://example.com/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := find(alice.ID, other, 0); got != 0 {
+		t.Errorf("FindDuplicate of a new URL = %d, want none", got)
+	}
+
+	// Trashing the keyed bookmark releases the key; the unkeyed duplicate
+	// still counts
+	trash := NewTrashService(db, nil, time.Hour)
+	if ok, err := trash.TrashBookmark(ctx, alice.ID, keyed.ID); err != nil || !ok {
+		t.Fatalf("TrashBookmark = %v, %v", ok, err)
+	}
+	if got := find(alice.ID, normalized, 0); got != legacy.ID {
+		t.Errorf("FindDuplicate after trashing the keyed bookmark = %d, want %d", got, legacy.ID)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/mail"
+	"markly-backend/internal/models"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailInUse               = errors.New("email address is already in use")
+)
+
+// EmailVerificationService emails verification links and marks addresses as
+// verified when a link is used
+type EmailVerificationService struct {
+	db     *gorm.DB
+	mailer mail.Mailer
+	appURL string
+	ttl    time.Duration
+}
+
+func NewEmailVerificationService(db *gorm.DB, mailer mail.Mailer, appURL string, ttl time.Duration) *EmailVerificationService {
+	return &EmailVerificationService{
+		db:     db,
+		mailer: mailer,
+		appURL: strings.TrimRight(appURL, "/"),
+		ttl:    ttl,
+	}
+}
+
+// Send emails a new verification link to user's current address, replacing
+// any such link sent earlier. Verified users are left alone.
+func (s *EmailVerificationService) Send(ctx context.Context, user *models.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND email_change = ?", user.ID, false).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerificationToken{
+			UserID:    user.ID,
+			Email:     user.Email,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(s.ttl),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/auth/verify-email?token=" + url.QueryEscape(token)
+	sendInBackground(ctx, s.mailer, user.ID, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm that this is the email address for your Markly account "+
+			"by opening this link within %s:\n\n%s\n\n"+
+			"If you didn't create a Markly account, you can ignore this email.\n",
+			user.Username, humanDuration(s.ttl), link),
+	})
+	return nil
+}
+
+// RequestChange emails a link to newEmail that switches user to that address
+// once opened, replacing any change requested earlier. The current address
+// keeps working until then and is told about the request.
+func (s *EmailVerificationService) RequestChange(ctx context.Context, user *models.User, newEmail string) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("email = ?", newEmail).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailInUse
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND email_change = ?", user.ID, true).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerificationToken{
+			UserID:      user.ID,
+			Email:       newEmail,
+			EmailChange: true,
+			TokenHash:   hashToken(token),
+			ExpiresAt:   time.Now().Add(s.ttl),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/auth/verify-email?token=" + url.QueryEscape(token)
+	sendInBackground(ctx, s.mailer, user.ID, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open this link within %s to use this address for your Markly account:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n",
+			user.Username, humanDuration(s.ttl), link),
+	})
+	sendInBackground(ctx, s.mailer, user.ID, mail.Message{
+		To:      user.Email,
+		Subject: "Your Markly email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone signed in to your Markly account asked to change its email address to %s. "+
+			"The change takes effect once the new address is confirmed.\n\n"+
+			"If this wasn't you, change your password now.\n",
+			user.Username, newEmail),
+	})
+	return nil
+}
+
+// Verify marks the address a token was sent to as verified and returns the
+// updated user. For an email change, the user's address is switched to the
+// new one. Tokens for the current address stop working once the user changes
+// their address.
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var verification models.EmailVerificationToken
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&verification).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidVerificationToken
+			}
+			return err
+		}
+		if time.Now().After(verification.ExpiresAt) {
+			return ErrInvalidVerificationToken
+		}
+
+		if err := tx.First(&user, verification.UserID).Error; err != nil {
+			return err
+		}
+
+		if verification.EmailChange {
+			var count int64
+			if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", verification.Email, user.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrEmailInUse
+			}
+			// Reset links went to the old address
+			if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+				return err
+			}
+			user.Email = verification.Email
+		} else if user.Email != verification.Email {
+			return ErrInvalidVerificationToken
+		}
+
+		user.EmailVerified = true
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"email":          user.Email,
+			"email_verified": true,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.EmailVerificationToken{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
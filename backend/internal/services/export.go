@@ -0,0 +1,793 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/middleware"
+	"markly-backend/internal/models"
+	"markly-backend/internal/netscape"
+)
+
+type ExportFormat string
+
+const (
+	ExportFormatHTML ExportFormat = "html"
+	ExportFormatJSON ExportFormat = "json"
+	ExportFormatCSV  ExportFormat = "csv"
+	// ExportFormatArchive is the full personal data takeout: account details,
+	// bookmarks and captured images in one zip file
+	ExportFormatArchive ExportFormat = "zip"
+)
+
+// exportLinkTTL is how long a download link stays valid
+const exportLinkTTL = 10 * time.Minute
+
+var errInvalidExportToken = errors.New("invalid or expired export token")
+
+var exportContentTypes = map[ExportFormat]string{
+	ExportFormatHTML:    "text/html; charset=utf-8",
+	ExportFormatJSON:    "application/json",
+	ExportFormatCSV:     "text/csv; charset=utf-8",
+	ExportFormatArchive: "application/zip",
+}
+
+// ExportService streams a user's collections and bookmarks in one of the
+// supported export formats. Bookmarks are read row by row, so memory use
+// does not grow with the size of the library.
+type ExportService struct {
+	db      *gorm.DB
+	baseURL string
+	images  *ImageCaptureService
+}
+
+func NewExportService(db *gorm.DB, baseURL string, images *ImageCaptureService) *ExportService {
+	return &ExportService{
+		db:      db,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		images:  images,
+	}
+}
+
+// ParseExportFormat validates a format name taken from a request
+func ParseExportFormat(value string) (ExportFormat, error) {
+	format := ExportFormat(strings.ToLower(value))
+	if _, ok := exportContentTypes[format]; !ok {
+		return "", fmt.Errorf("unsupported export format: %s", value)
+	}
+	return format, nil
+}
+
+// DownloadURL returns a short-lived link to the export endpoint, so the file
+// can be fetched by a plain browser download without an auth header. The
+// link works once: it sits in a query string, which proxies and servers log.
+func (s *ExportService) DownloadURL(ctx context.Context, userID uint, format ExportFormat) (string, time.Time, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	db := s.db.WithContext(ctx)
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.ExportToken{}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(exportLinkTTL).Truncate(time.Second)
+	if err := db.Create(&models.ExportToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		Format:    string(format),
+		ExpiresAt: expiresAt,
+	}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	query := url.Values{}
+	query.Set("format", string(format))
+	query.Set("token", token)
+	return fmt.Sprintf("%s/export?%s", s.baseURL, query.Encode()), expiresAt, nil
+}
+
+// ServeHTTP serves GET /export. The caller is identified either by a token
+// from DownloadURL or by the regular bearer token.
+func (s *ExportService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format, err := ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var userID uint
+	if token := r.URL.Query().Get("token"); token != "" {
+		userID, err = s.useExportToken(r.Context(), token, format)
+		if err != nil {
+			if !errors.Is(err, errInvalidExportToken) {
+				log.Printf("Failed to check export token: %v", err)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	} else {
+		var ok bool
+		if userID, ok = r.Context().Value(middleware.UserIDKey).(uint); !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !middleware.HasScope(r.Context(), ScopeBookmarksRead) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		// The archive holds account details no API token scope covers
+		if _, isAPIToken := middleware.GetAPITokenFromContext(r.Context()); isAPIToken && format == ExportFormatArchive {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("markly-bookmarks-%s.%s", time.Now().Format("2006-01-02"), format)
+	if format == ExportFormatArchive {
+		filename = fmt.Sprintf("markly-data-%s.zip", time.Now().Format("2006-01-02"))
+	}
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Headers are already sent once streaming starts, so failures can only be logged
+	if err := s.Export(r.Context(), w, userID, format); err != nil {
+		log.Printf("Export for user %d failed: %v", userID, err)
+	}
+}
+
+// Export writes every collection and bookmark owned by userID to w
+func (s *ExportService) Export(ctx context.Context, w io.Writer, userID uint, format ExportFormat) error {
+	switch format {
+	case ExportFormatHTML:
+		return s.exportHTML(ctx, w, userID)
+	case ExportFormatJSON:
+		return s.exportJSON(ctx, w, userID)
+	case ExportFormatCSV:
+		return s.exportCSV(ctx, w, userID)
+	case ExportFormatArchive:
+		return s.exportArchive(ctx, w, userID)
+	}
+	return fmt.Errorf("unsupported export format: %s", format)
+}
+
+func (s *ExportService) exportHTML(ctx context.Context, w io.Writer, userID uint) error {
+	nw := netscape.NewWriter(w)
+
+	// walk hands over plain text, which the writer escapes
+	err := s.walk(ctx, userID, exportVisitor{
+		startCollection: func(c *models.Collection) error {
+			folder := netscape.Folder{
+				Name:         c.Name,
+				AddDate:      c.CreatedAt,
+				LastModified: c.UpdatedAt,
+			}
+			if c.Description != nil {
+				folder.Description = *c.Description
+			}
+			return nw.StartFolder(folder)
+		},
+		bookmark: func(c *models.Collection, b *models.Bookmark) error {
+			bookmark := netscape.Bookmark{
+				Title:        b.Title,
+				URL:          b.URL,
+				Tags:         b.Tags,
+				AddDate:      b.CreatedAt,
+				LastModified: b.UpdatedAt,
+			}
+			if b.Description != nil {
+				bookmark.Description = *b.Description
+			}
+			return nw.WriteBookmark(bookmark)
+		},
+		leaveCollection: func(c *models.Collection) error {
+			return nw.EndFolder()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return nw.Close()
+}
+
+type exportUser struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type exportCollection struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	Color       *string   `json:"color"`
+	ParentID    *uint     `json:"parentId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type exportBookmark struct {
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description *string   `json:"description"`
+	Notes       *string   `json:"notes"`
+	Favicon     *string   `json:"favicon"`
+	Screenshot  *string   `json:"screenshot"`
+	Tags        []string  `json:"tags"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// exportJSON writes a lossless document of the form
+// {"version":1,"exportedAt":...,"user":{...},"collections":[{...,"bookmarks":[...]}]}
+func (s *ExportService) exportJSON(ctx context.Context, w io.Writer, userID uint) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	header, err := json.Marshal(struct {
+		Version    int        `json:"version"`
+		ExportedAt time.Time  `json:"exportedAt"`
+		User       exportUser `json:"user"`
+	}{
+		Version:    1,
+		ExportedAt: time.Now().UTC(),
+		User: exportUser{
+			ID:        user.ID,
+			Email:     user.Email,
+			Username:  html.UnescapeString(user.Username),
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// Reopen the header object so the collections array can be streamed into it
+	bw.Write(header[:len(header)-1])
+	bw.WriteString(`,"collections":[`)
+
+	firstCollection := true
+	firstBookmark := true
+	err = s.walk(ctx, userID, exportVisitor{
+		startCollection: func(c *models.Collection) error {
+			data, err := json.Marshal(exportCollection{
+				ID:          c.ID,
+				Name:        c.Name,
+				Description: c.Description,
+				Color:       c.Color,
+				ParentID:    c.ParentID,
+				CreatedAt:   c.CreatedAt,
+				UpdatedAt:   c.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+			if !firstCollection {
+				bw.WriteByte(',')
+			}
+			firstCollection = false
+			firstBookmark = true
+			bw.Write(data[:len(data)-1])
+			_, err = bw.WriteString(`,"bookmarks":[`)
+			return err
+		},
+		bookmark: func(c *models.Collection, b *models.Bookmark) error {
+			data, err := json.Marshal(exportBookmark{
+				ID:          b.ID,
+				Title:       b.Title,
+				URL:         b.URL,
+				Description: b.Description,
+				Notes:       b.Notes,
+				Favicon:     b.Favicon,
+				Screenshot:  b.Screenshot,
+				Tags:        b.Tags,
+				CreatedAt:   b.CreatedAt,
+				UpdatedAt:   b.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+			if !firstBookmark {
+				bw.WriteByte(',')
+			}
+			firstBookmark = false
+			_, err = bw.Write(data)
+			return err
+		},
+		endCollection: func(c *models.Collection) error {
+			_, err := bw.WriteString("]}")
+			return err
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	bw.WriteString("]}\n")
+	return bw.Flush()
+}
+
+func (s *ExportService) exportCSV(ctx context.Context, w io.Writer, userID uint) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "title", "url", "description", "notes", "tags", "collection", "favicon", "screenshot", "created_at", "updated_at"})
+
+	err := s.walk(ctx, userID, exportVisitor{
+		bookmark: func(c *models.Collection, b *models.Bookmark) error {
+			return cw.Write([]string{
+				strconv.FormatUint(uint64(b.ID), 10),
+				b.Title,
+				b.URL,
+				stringValue(b.Description),
+				stringValue(b.Notes),
+				strings.Join(b.Tags, ","),
+				c.Name,
+				stringValue(b.Favicon),
+				stringValue(b.Screenshot),
+				b.CreatedAt.UTC().Format(time.RFC3339),
+				b.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+type exportAccount struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	User       exportAccountUser `json:"user"`
+	Identities []exportIdentity  `json:"identities"`
+	Sessions   []exportSession   `json:"sessions"`
+	APITokens  []exportAPIToken  `json:"apiTokens"`
+
+	SmartCollections []exportSmartCollection `json:"smartCollections"`
+}
+
+type exportAccountUser struct {
+	exportUser
+	EmailVerified bool `json:"emailVerified"`
+	TOTPEnabled   bool `json:"totpEnabled"`
+}
+
+type exportIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type exportSession struct {
+	UserAgent  string     `json:"userAgent"`
+	IPAddress  string     `json:"ipAddress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+type exportAPIToken struct {
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type exportSmartCollection struct {
+	Name               string     `json:"name"`
+	Description        *string    `json:"description"`
+	Color              *string    `json:"color"`
+	Search             *string    `json:"search"`
+	Tags               []string   `json:"tags"`
+	CollectionID       *uint      `json:"collectionId"`
+	IncludeDescendants bool       `json:"includeDescendants"`
+	Domain             *string    `json:"domain"`
+	CreatedAfter       *time.Time `json:"createdAfter"`
+	CreatedBefore      *time.Time `json:"createdBefore"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+}
+
+// exportArchive writes a zip of everything stored about userID: account.json
+// with the account, linked identities, sessions, API tokens (secrets
+// excluded) and smart collections, bookmarks.json and bookmarks.html, and the captured favicons and
+// screenshots under images/
+func (s *ExportService) exportArchive(ctx context.Context, w io.Writer, userID uint) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("account.json")
+	if err != nil {
+		return err
+	}
+	if err := s.exportAccount(ctx, f, userID); err != nil {
+		return err
+	}
+
+	f, err = zw.Create("bookmarks.json")
+	if err != nil {
+		return err
+	}
+	if err := s.exportJSON(ctx, f, userID); err != nil {
+		return err
+	}
+
+	f, err = zw.Create("bookmarks.html")
+	if err != nil {
+		return err
+	}
+	if err := s.exportHTML(ctx, f, userID); err != nil {
+		return err
+	}
+
+	if err := s.exportImages(ctx, zw, userID); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (s *ExportService) exportAccount(ctx context.Context, w io.Writer, userID uint) error {
+	db := s.db.WithContext(ctx)
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	var totpCount int64
+	if err := db.Model(&models.TOTPCredential{}).Where("user_id = ? AND confirmed_at IS NOT NULL", userID).Count(&totpCount).Error; err != nil {
+		return err
+	}
+
+	account := exportAccount{
+		Version:    1,
+		ExportedAt: time.Now().UTC(),
+		User: exportAccountUser{
+			exportUser: exportUser{
+				ID:        user.ID,
+				Email:     user.Email,
+				Username:  html.UnescapeString(user.Username),
+				CreatedAt: user.CreatedAt,
+				UpdatedAt: user.UpdatedAt,
+			},
+			EmailVerified: user.EmailVerified,
+			TOTPEnabled:   totpCount > 0,
+		},
+		Identities: []exportIdentity{},
+		Sessions:   []exportSession{},
+		APITokens:  []exportAPIToken{},
+
+		SmartCollections: []exportSmartCollection{},
+	}
+
+	var identities []models.UserIdentity
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&identities).Error; err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		account.Identities = append(account.Identities, exportIdentity{
+			Issuer:    identity.Issuer,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	var sessions []models.Session
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&sessions).Error; err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		account.Sessions = append(account.Sessions, exportSession{
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			RevokedAt:  session.RevokedAt,
+		})
+	}
+
+	var tokens []models.APIToken
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&tokens).Error; err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		account.APITokens = append(account.APITokens, exportAPIToken{
+			Name:       html.UnescapeString(token.Name),
+			Prefix:     token.Prefix,
+			Scopes:     token.Scopes,
+			ExpiresAt:  token.ExpiresAt,
+			LastUsedAt: token.LastUsedAt,
+			CreatedAt:  token.CreatedAt,
+		})
+	}
+
+	var smartCollections []models.SmartCollection
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&smartCollections).Error; err != nil {
+		return err
+	}
+	for _, sc := range smartCollections {
+		account.SmartCollections = append(account.SmartCollections, exportSmartCollection{
+			Name:               html.UnescapeString(sc.Name),
+			Description:        unescapeStored(sc.Description),
+			Color:              sc.Color,
+			Search:             sc.Search,
+			Tags:               unescapeTags(sc.Tags),
+			CollectionID:       sc.CollectionID,
+			IncludeDescendants: sc.IncludeDescendants,
+			Domain:             sc.Domain,
+			CreatedAfter:       sc.CreatedAfter,
+			CreatedBefore:      sc.CreatedBefore,
+			CreatedAt:          sc.CreatedAt,
+			UpdatedAt:          sc.UpdatedAt,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(account)
+}
+
+// exportImages adds the image files referenced by userID's bookmarks. Files
+// that have since gone missing are skipped.
+func (s *ExportService) exportImages(ctx context.Context, zw *zip.Writer, userID uint) error {
+	if s.images == nil {
+		return nil
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	err := s.walk(ctx, userID, exportVisitor{
+		bookmark: func(c *models.Collection, b *models.Bookmark) error {
+			for _, imageURL := range []*string{b.Favicon, b.Screenshot} {
+				if imageURL == nil {
+					continue
+				}
+				if localPath, ok := s.images.LocalPath(*imageURL); ok && !seen[localPath] {
+					seen[localPath] = true
+					paths = append(paths, localPath)
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, localPath := range paths {
+		if err := addFileToZip(zw, localPath, "images/"+filepath.Base(localPath)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addFileToZip(zw *zip.Writer, localPath, name string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, file)
+	return err
+}
+
+// exportVisitor receives collections and their bookmarks in order. Nil
+// callbacks are skipped.
+type exportVisitor struct {
+	startCollection func(c *models.Collection) error
+	bookmark        func(c *models.Collection, b *models.Bookmark) error
+	endCollection   func(c *models.Collection) error
+	// leaveCollection follows the collections nested in c, so formats that
+	// nest folders close c there rather than in endCollection
+	leaveCollection func(c *models.Collection) error
+}
+
+// walk visits every collection of userID, including empty ones, parents
+// before the collections nested in them. Text that was HTML-escaped when it
+// was stored is unescaped, so every format exports what the user typed. Each collection's bookmarks come
+// between startCollection and endCollection, and its nested collections
+// between endCollection and leaveCollection. Collections are loaded up front
+// since there are few of them; the bookmarks of each are streamed.
+func (s *ExportService) walk(ctx context.Context, userID uint, v exportVisitor) error {
+	db := s.db.WithContext(ctx)
+
+	var collections []models.Collection
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&collections).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[uint]bool, len(collections))
+	for i := range collections {
+		unescapeCollection(&collections[i])
+		byID[collections[i].ID] = true
+	}
+	// Collections whose parent is gone are exported at the top level
+	var roots []*models.Collection
+	children := make(map[uint][]*models.Collection)
+	for i := range collections {
+		c := &collections[i]
+		if c.ParentID != nil && byID[*c.ParentID] {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	visited := make(map[uint]bool, len(collections))
+	var visit func(c *models.Collection) error
+	visit = func(c *models.Collection) error {
+		visited[c.ID] = true
+		if v.startCollection != nil {
+			if err := v.startCollection(c); err != nil {
+				return err
+			}
+		}
+		if err := s.walkBookmarks(db, c, v); err != nil {
+			return err
+		}
+		if v.endCollection != nil {
+			if err := v.endCollection(c); err != nil {
+				return err
+			}
+		}
+		for _, child := range children[c.ID] {
+			if visited[child.ID] {
+				continue
+			}
+			if err := visit(child); err != nil {
+				return err
+			}
+		}
+		if v.leaveCollection != nil {
+			return v.leaveCollection(c)
+		}
+		return nil
+	}
+
+	for _, c := range roots {
+		if err := visit(c); err != nil {
+			return err
+		}
+	}
+	// Collections caught in a parent cycle are unreachable from the roots
+	for i := range collections {
+		if !visited[collections[i].ID] {
+			if err := visit(&collections[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkBookmarks streams the bookmarks of c to v.bookmark
+func (s *ExportService) walkBookmarks(db *gorm.DB, c *models.Collection, v exportVisitor) error {
+	if v.bookmark == nil {
+		return nil
+	}
+
+	rows, err := db.Model(&models.Bookmark{}).Where("user_id = ? AND collection_id = ?", c.UserID, c.ID).Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookmark models.Bookmark
+		if err := db.ScanRows(rows, &bookmark); err != nil {
+			return err
+		}
+		unescapeBookmark(&bookmark)
+		if err := v.bookmark(c, &bookmark); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// useExportToken uses up a token from DownloadURL for format and returns
+// the user it was issued to
+func (s *ExportService) useExportToken(ctx context.Context, token string, format ExportFormat) (uint, error) {
+	var userID uint
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var exportToken models.ExportToken
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&exportToken).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidExportToken
+			}
+			return err
+		}
+
+		// Deleting by id stops two concurrent requests from both using the token
+		result := tx.Where("id = ?", exportToken.ID).Delete(&models.ExportToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 || ExportFormat(exportToken.Format) != format || time.Now().After(exportToken.ExpiresAt) {
+			return errInvalidExportToken
+		}
+
+		userID = exportToken.UserID
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// unescapeCollection undoes the HTML escaping of c's text on input
+func unescapeCollection(c *models.Collection) {
+	c.Name = html.UnescapeString(c.Name)
+	c.Description = unescapeStored(c.Description)
+}
+
+// unescapeBookmark undoes the HTML escaping of b's text on input
+func unescapeBookmark(b *models.Bookmark) {
+	b.Title = html.UnescapeString(b.Title)
+	b.Description = unescapeStored(b.Description)
+	b.Notes = unescapeStored(b.Notes)
+	b.Tags = unescapeTags(b.Tags)
+}
+
+func unescapeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	unescaped := make([]string, len(tags))
+	for i, tag := range tags {
+		unescaped[i] = html.UnescapeString(tag)
+	}
+	return unescaped
+}
+
+func unescapeStored(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	unescaped := html.UnescapeString(*s)
+	return &unescaped
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
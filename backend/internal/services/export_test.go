@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/netscape"
+	"markly-backend/internal/testdb"
+	"markly-backend/internal/utils"
+)
+
+func TestExportHTMLNestsCollections(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewExportService(db, "http://localhost", nil)
+	user := testdb.CreateUser(t, db, "alice")
+
+	work := testdb.CreateCollection(t, db, user.ID, "Work", 0)
+	misc := testdb.CreateCollection(t, db, user.ID, "Misc", 0)
+	// Created after Misc, so id order alone would not place it under Work
+	projects := testdb.CreateCollection(t, db, user.ID, "Projects", work.ID)
+	testdb.CreateCollection(t, db, user.ID, "Archive", projects.ID)
+
+	testdb.CreateBookmark(t, db, user.ID, projects.ID, "https://example.com/project")
+	testdb.CreateBookmark(t, db, user.ID, work.ID, "https://example.com/work")
+	testdb.CreateBookmark(t, db, user.ID, misc.ID, "https://example.com/misc")
+
+	var buf bytes.Buffer
+	if err := s.Export(context.Background(), &buf, user.ID, ExportFormatHTML); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	bookmarks, err := netscape.Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	folders := make(map[string][]string)
+	var order []string
+	for _, b := range bookmarks {
+		folders[b.URL] = b.Folders
+		order = append(order, b.URL)
+	}
+	want := map[string][]string{
+		"https://example.com/work":    {"Work"},
+		"https://example.com/project": {"Work", "Projects"},
+		"https://example.com/misc":    {"Misc"},
+	}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("folders = %v, want %v", folders, want)
+	}
+	wantOrder := []string{"https://example.com/work", "https://example.com/project", "https://example.com/misc"}
+	if !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("order = %v, want %v", order, wantOrder)
+	}
+}
+
+func TestExportDownloadURLWorksOnce(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewExportService(db, "http://localhost", nil)
+	user := testdb.CreateUser(t, db, "alice")
+	testdb.CreateCollection(t, db, user.ID, "Root", 0)
+
+	download := func(link string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+		return rec.Code
+	}
+
+	link, expiresAt, err := s.DownloadURL(context.Background(), user.ID, ExportFormatJSON)
+	if err != nil {
+		t.Fatalf("DownloadURL: %v", err)
+	}
+	if !expiresAt.After(time.Now()) {
+		t.Errorf("expiresAt = %v, want in the future", expiresAt)
+	}
+
+	// A token issued for one format does not download another
+	wrongFormat := strings.Replace(link, "format=json", "format=csv", 1)
+	if code := download(wrongFormat); code != http.StatusUnauthorized {
+		t.Errorf("download in another format = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := download(link); code != http.StatusOK {
+		t.Fatalf("first download = %d, want %d", code, http.StatusOK)
+	}
+	if code := download(link); code != http.StatusUnauthorized {
+		t.Errorf("second download = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	expired, _, err := s.DownloadURL(context.Background(), user.ID, ExportFormatJSON)
+	if err != nil {
+		t.Fatalf("DownloadURL: %v", err)
+	}
+	parsed, err := url.Parse(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&models.ExportToken{}).Where("token_hash = ?", hashToken(parsed.Query().Get("token"))).
+		Update("expires_at", time.Now().Add(-time.Minute))
+	if code := download(expired); code != http.StatusUnauthorized {
+		t.Errorf("download after expiry = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestExportUnescapesStoredText(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewExportService(db, "http://localhost", nil)
+	user := testdb.CreateUser(t, db, "alice")
+	collection := testdb.CreateCollection(t, db, user.ID, utils.SanitizeString("Tom & Jerry"), 0)
+	bookmark := testdb.CreateBookmark(t, db, user.ID, collection.ID, "https://example.com/")
+
+	// Stored the way the resolvers store user input
+	const title = `Tom & Jerry's "best" bits`
+	if err := db.Model(bookmark).Updates(map[string]interface{}{
+		"title": utils.SanitizeString(title),
+		"tags":  `["r&amp;d"]`,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(format ExportFormat) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := s.Export(context.Background(), &buf, user.ID, format); err != nil {
+			t.Fatalf("Export %s: %v", format, err)
+		}
+		return buf.Bytes()
+	}
+
+	bookmarks, err := netscape.Parse(bytes.NewReader(export(ExportFormatHTML)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(bookmarks) != 1 || bookmarks[0].Title != title || bookmarks[0].Folders[0] != "Tom & Jerry" {
+		t.Errorf("HTML export = %+v, want title %q in folder %q", bookmarks, title, "Tom & Jerry")
+	}
+
+	var document struct {
+		Collections []struct {
+			Name      string `json:"name"`
+			Bookmarks []struct {
+				Title string   `json:"title"`
+				Tags  []string `json:"tags"`
+			} `json:"bookmarks"`
+		} `json:"collections"`
+	}
+	if err := json.Unmarshal(export(ExportFormatJSON), &document); err != nil {
+		t.Fatalf("decode JSON export: %v", err)
+	}
+	if got := document.Collections[0]; got.Name != "Tom & Jerry" || got.Bookmarks[0].Title != title ||
+		!reflect.DeepEqual(got.Bookmarks[0].Tags, []string{"r&d"}) {
+		t.Errorf("JSON export = %+v, want title %q in %q tagged r&d", got, title, "Tom & Jerry")
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(export(ExportFormatCSV))).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV export: %v", err)
+	}
+	if got := records[1]; got[1] != title || got[5] != "r&d" || got[6] != "Tom & Jerry" {
+		t.Errorf("CSV export row = %q, want title %q tagged r&d in %q", got, title, "Tom & Jerry")
+	}
+}
@@ -30,6 +30,20 @@ func NewImageCaptureService(storageDir, baseURL string) *ImageCaptureService {
 	}
 }
 
+// LocalPath maps a captured image's public URL back to its file in the
+// storage directory. It reports false for URLs this service did not produce.
+func (s *ImageCaptureService) LocalPath(imageURL string) (string, bool) {
+	idx := strings.LastIndex(imageURL, "/images/")
+	if idx < 0 {
+		return "", false
+	}
+	name := imageURL[idx+len("/images/"):]
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	return filepath.Join(s.storageDir, name), true
+}
+
 func (s *ImageCaptureService) CaptureImages(targetURL string) *CaptureResult {
 	result := &CaptureResult{}
 
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"markly-backend/internal/models"
+)
+
+const (
+	// ipAttemptFactor lets a client IP fail more often than a single account,
+	// since several users may share an address
+	ipAttemptFactor = 4
+	baseLockout     = time.Minute
+	maxLockout      = time.Hour
+	// lockoutResetAfter forgets earlier lockouts once an identifier has been
+	// quiet this long
+	lockoutResetAfter = 24 * time.Hour
+)
+
+// LoginLockedError is returned while an account or client IP is locked out
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginThrottleService tracks failed logins per account and per client IP.
+// Reaching maxAttempts failures within the window locks the identifier out;
+// each further lockout doubles in length, up to maxLockout.
+type LoginThrottleService struct {
+	db          *gorm.DB
+	maxAttempts int
+	window      time.Duration
+}
+
+func NewLoginThrottleService(db *gorm.DB, maxAttempts int, window time.Duration) *LoginThrottleService {
+	return &LoginThrottleService{
+		db:          db,
+		maxAttempts: maxAttempts,
+		window:      window,
+	}
+}
+
+// Check returns a *LoginLockedError if the account or the IP is locked out
+func (s *LoginThrottleService) Check(ctx context.Context, email, ip string) error {
+	var locked []models.LoginThrottle
+	if err := s.db.WithContext(ctx).
+		Where("identifier IN ? AND locked_until > ?", s.identifiers(email, ip), time.Now()).
+		Find(&locked).Error; err != nil {
+		return err
+	}
+
+	var retryAfter time.Duration
+	for _, throttle := range locked {
+		if wait := time.Until(*throttle.LockedUntil); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login. It returns a *LoginLockedError when
+// the failure locks the account or the IP out.
+func (s *LoginThrottleService) RecordFailure(ctx context.Context, email, ip string) error {
+	var retryAfter time.Duration
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, id := range s.identifiers(email, ip) {
+			limit := s.maxAttempts
+			if id != accountIdentifier(email) {
+				limit *= ipAttemptFactor
+			}
+
+			wait, err := s.recordFailure(tx, id, limit)
+			if err != nil {
+				return err
+			}
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// RecordSuccess clears the account's failure history. The IP's history is
+// kept, so an attacker cannot reset it by logging into an account of their own.
+func (s *LoginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	db := s.db.WithContext(ctx)
+	if err := db.Where("identifier = ?", accountIdentifier(email)).Delete(&models.LoginThrottle{}).Error; err != nil {
+		return err
+	}
+
+	// Prune identifiers that have been quiet long enough to start over
+	return db.Where("updated_at < ? AND (locked_until IS NULL OR locked_until < ?)", time.Now().Add(-lockoutResetAfter), time.Now()).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+func (s *LoginThrottleService) recordFailure(tx *gorm.DB, id string, limit int) (time.Duration, error) {
+	now := time.Now()
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoginThrottle{Identifier: id, WindowStart: now}).Error; err != nil {
+		return 0, err
+	}
+
+	var throttle models.LoginThrottle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("identifier = ?", id).First(&throttle).Error; err != nil {
+		return 0, err
+	}
+
+	if throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil) {
+		return throttle.LockedUntil.Sub(now), nil
+	}
+	if now.Sub(throttle.UpdatedAt) > lockoutResetAfter {
+		throttle.Lockouts = 0
+	}
+	if now.Sub(throttle.WindowStart) > s.window {
+		throttle.Failures = 0
+		throttle.WindowStart = now
+	}
+
+	var retryAfter time.Duration
+	throttle.Failures++
+	if throttle.Failures >= limit {
+		retryAfter = lockoutDuration(throttle.Lockouts)
+		lockedUntil := now.Add(retryAfter)
+		throttle.LockedUntil = &lockedUntil
+		throttle.Lockouts++
+		throttle.Failures = 0
+		throttle.WindowStart = now
+	}
+
+	if err := tx.Save(&throttle).Error; err != nil {
+		return 0, err
+	}
+	return retryAfter, nil
+}
+
+func (s *LoginThrottleService) identifiers(email, ip string) []string {
+	ids := []string{accountIdentifier(email)}
+	if ip != "" {
+		ids = append(ids, "ip:"+ip)
+	}
+	return ids
+}
+
+func accountIdentifier(email string) string {
+	return "account:" + email
+}
+
+// lockoutDuration doubles the base lockout for every earlier lockout
+func lockoutDuration(lockouts int) time.Duration {
+	if lockouts >= 6 {
+		return maxLockout
+	}
+	if d := baseLockout << lockouts; d < maxLockout {
+		return d
+	}
+	return maxLockout
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+func isLocked(err error) bool {
+	var locked *LoginLockedError
+	return errors.As(err, &locked)
+}
+
+func TestLoginThrottleLocksAccount(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewLoginThrottleService(db, 3, time.Minute)
+	ctx := context.Background()
+
+	for i := 1; i < 3; i++ {
+		if err := s.RecordFailure(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+	}
+	if err := s.Check(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Check before the limit = %v", err)
+	}
+
+	if err := s.RecordFailure(ctx, "alice@example.com", "10.0.0.1"); !isLocked(err) {
+		t.Fatalf("failure at the limit = %v, want a lockout", err)
+	}
+	err := s.Check(ctx, "alice@example.com", "10.0.0.2")
+	if !isLocked(err) {
+		t.Fatalf("Check of the locked account from another IP = %v, want a lockout", err)
+	}
+	if wait := err.(*LoginLockedError).RetryAfter; wait <= 0 || wait > baseLockout {
+		t.Errorf("RetryAfter = %s, want at most %s", wait, baseLockout)
+	}
+
+	// The IP has a higher limit, so other accounts can still log in from it
+	if err := s.Check(ctx, "bob@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("Check of another account from the same IP = %v", err)
+	}
+}
+
+func TestLoginThrottleLocksIP(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewLoginThrottleService(db, 2, time.Minute)
+	ctx := context.Background()
+
+	// Spreading guesses over accounts still runs into the IP's limit
+	var err error
+	for i := 0; i < 2*ipAttemptFactor; i++ {
+		err = s.RecordFailure(ctx, string(rune('a'+i))+"@example.com", "10.0.0.1")
+	}
+	if !isLocked(err) {
+		t.Fatalf("failure at the IP limit = %v, want a lockout", err)
+	}
+	if err := s.Check(ctx, "fresh@example.com", "10.0.0.1"); !isLocked(err) {
+		t.Errorf("Check from the locked IP = %v, want a lockout", err)
+	}
+	if err := s.Check(ctx, "fresh@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("Check from another IP = %v", err)
+	}
+}
+
+func TestLoginThrottleSuccessClearsAccount(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewLoginThrottleService(db, 3, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := s.RecordFailure(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RecordSuccess(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// The count starts over, so two more failures do not lock the account
+	for i := 0; i < 2; i++ {
+		if err := s.RecordFailure(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("failure %d after success: %v", i+1, err)
+		}
+	}
+
+	var ipFailures models.LoginThrottle
+	if err := db.Where("identifier = ?", "ip:10.0.0.1").First(&ipFailures).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ipFailures.Failures != 4 {
+		t.Errorf("IP failures = %d, want 4; a success must not reset them", ipFailures.Failures)
+	}
+}
+
+func TestLoginThrottleWindowExpires(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewLoginThrottleService(db, 2, time.Minute)
+	ctx := context.Background()
+
+	if err := s.RecordFailure(ctx, "alice@example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.LoginThrottle{}).Where("identifier = ?", accountIdentifier("alice@example.com")).
+		Update("window_start", time.Now().Add(-2*time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordFailure(ctx, "alice@example.com", ""); err != nil {
+		t.Errorf("failure in a new window = %v, want none", err)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:  time.Minute,
+		1:  2 * time.Minute,
+		5:  32 * time.Minute,
+		6:  time.Hour,
+		40: time.Hour,
+	}
+	for lockouts, want := range tests {
+		if got := lockoutDuration(lockouts); got != want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", lockouts, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"markly-backend/internal/mail"
+)
+
+// sendInBackground delivers msg without making the caller wait, so response
+// times do not depend on the mail server. Failures are logged.
+func sendInBackground(ctx context.Context, mailer mail.Mailer, userID uint, msg mail.Message) {
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := mailer.Send(sendCtx, msg); err != nil {
+			log.Printf("Failed to send %q email to user %d: %v", msg.Subject, userID, err)
+		}
+	}()
+}
+
+// humanDuration formats whole hours or minutes for use in email text
+func humanDuration(d time.Duration) string {
+	unit, n := "minute", int(d.Round(time.Minute)/time.Minute)
+	if d >= time.Hour && d%time.Hour == 0 {
+		unit, n = "hour", int(d/time.Hour)
+	}
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
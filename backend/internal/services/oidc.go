@@ -0,0 +1,437 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+
+	"markly-backend/internal/config"
+	"markly-backend/internal/models"
+	"markly-backend/internal/utils"
+)
+
+const (
+	oidcFlowCookie = "markly_oidc"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+var (
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not supply a verified email address")
+	usernameUnsafeChars     = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+)
+
+// OIDCService signs users in through an OpenID Connect provider using the
+// authorization code flow with PKCE. Users are matched by the provider's
+// subject, then by verified email address, and created on first login.
+type OIDCService struct {
+	cfg           *config.OIDCConfig
+	db            *gorm.DB
+	secret        []byte
+	appURL        string
+	refreshTokens *RefreshTokenService
+	tokens        *TokenService
+	accounts      *AccountService
+	totp          *TOTPService
+
+	// Discovery runs on first use so the server can start while the
+	// provider is unreachable
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcFlow is kept in a signed cookie between the redirect to the provider
+// and the callback, tying the callback to the browser that started it
+type oidcFlow struct {
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	ExpiresAt int64  `json:"e"`
+}
+
+type oidcClaims struct {
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"`
+	PreferredUsername string      `json:"preferred_username"`
+}
+
+func NewOIDCService(cfg *config.OIDCConfig, db *gorm.DB, secret, appURL string, refreshTokens *RefreshTokenService, tokens *TokenService, accounts *AccountService, totp *TOTPService) *OIDCService {
+	return &OIDCService{
+		cfg:           cfg,
+		db:            db,
+		secret:        []byte(secret),
+		appURL:        strings.TrimRight(appURL, "/"),
+		refreshTokens: refreshTokens,
+		tokens:        tokens,
+		accounts:      accounts,
+		totp:          totp,
+	}
+}
+
+// Login serves GET /auth/oidc/login by redirecting to the provider
+func (s *OIDCService) Login(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := s.client(r.Context())
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state, err := randomHex(16)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	flow := oidcFlow{
+		State:     state,
+		Nonce:     nonce,
+		Verifier:  oauth2.GenerateVerifier(),
+		ExpiresAt: time.Now().Add(oidcFlowTTL).Unix(),
+	}
+
+	http.SetCookie(w, s.flowCookie(s.signFlow(flow), int(oidcFlowTTL/time.Second)))
+	http.Redirect(w, r, conf.AuthCodeURL(flow.State, oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier)), http.StatusFound)
+}
+
+// Callback serves GET /auth/oidc/callback. On success it sends the browser
+// to the frontend with the session tokens in the URL fragment, which is
+// never sent to a server. Users with two-factor authentication get a login
+// challenge there instead, to complete with verifyTotp as after a password.
+func (s *OIDCService) Callback(w http.ResponseWriter, r *http.Request) {
+	// The flow cookie is single use
+	http.SetCookie(w, s.flowCookie("", -1))
+
+	flow, err := s.readFlow(r)
+	if err != nil {
+		s.fail(w, r, "invalid_state", err)
+		return
+	}
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		s.fail(w, r, "invalid_state", errors.New("state mismatch"))
+		return
+	}
+	if providerErr := query.Get("error"); providerErr != "" {
+		s.fail(w, r, "access_denied", fmt.Errorf("provider returned %s: %s", providerErr, query.Get("error_description")))
+		return
+	}
+
+	ctx := r.Context()
+	conf, verifier, err := s.client(ctx)
+	if err != nil {
+		s.fail(w, r, "provider_unavailable", err)
+		return
+	}
+
+	token, err := conf.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		s.fail(w, r, "exchange_failed", err)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		s.fail(w, r, "exchange_failed", errors.New("token response has no id_token"))
+		return
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		s.fail(w, r, "invalid_id_token", err)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		s.fail(w, r, "invalid_id_token", errors.New("nonce mismatch"))
+		return
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		s.fail(w, r, "invalid_id_token", err)
+		return
+	}
+
+	user, err := s.linkUser(ctx, idToken.Issuer, idToken.Subject, claims)
+	if err != nil {
+		code := "login_failed"
+		if errors.Is(err, ErrOIDCEmailNotVerified) {
+			code = "email_not_verified"
+		}
+		s.fail(w, r, code, err)
+		return
+	}
+
+	// Signing in during the deletion grace period restores the account
+	if user.DeletionScheduledAt != nil {
+		if !time.Now().Before(*user.DeletionScheduledAt) {
+			s.fail(w, r, "login_failed", fmt.Errorf("user %d is awaiting purge", user.ID))
+			return
+		}
+		if err := s.accounts.Restore(ctx, user.ID); err != nil {
+			s.fail(w, r, "login_failed", err)
+			return
+		}
+	}
+
+	// The provider's own checks do not stand in for the second factor
+	totpEnabled, err := s.totp.Enabled(ctx, user.ID)
+	if err != nil {
+		s.fail(w, r, "login_failed", err)
+		return
+	}
+	if totpEnabled {
+		challenge, err := s.totp.CreateChallenge(ctx, user.ID)
+		if err != nil {
+			s.fail(w, r, "login_failed", err)
+			return
+		}
+		fragment := url.Values{}
+		fragment.Set("totpChallenge", challenge.Token)
+		fragment.Set("totpChallengeExpiresAt", challenge.ExpiresAt.Format(time.RFC3339))
+		http.Redirect(w, r, s.appURL+"/auth/callback#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	refresh, err := s.refreshTokens.Issue(ctx, user.ID)
+	if err != nil {
+		s.fail(w, r, "login_failed", err)
+		return
+	}
+	accessToken, _, err := s.tokens.GenerateAccessToken(user.ID, refresh.FamilyID)
+	if err != nil {
+		s.fail(w, r, "login_failed", err)
+		return
+	}
+
+	fragment := url.Values{}
+	fragment.Set("token", accessToken)
+	fragment.Set("refreshToken", refresh.Token)
+	http.Redirect(w, r, s.appURL+"/auth/callback#"+fragment.Encode(), http.StatusFound)
+}
+
+// client returns the OAuth2 configuration and ID token verifier, running
+// provider discovery the first time it succeeds
+func (s *OIDCService) client(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.oauth != nil {
+		return s.oauth, s.verifier, nil
+	}
+
+	discoveryCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(discoveryCtx, s.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.oauth = &oauth2.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: s.cfg.ClientSecret,
+		RedirectURL:  s.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       s.cfg.Scopes,
+	}
+	s.verifier = provider.Verifier(&oidc.Config{ClientID: s.cfg.ClientID})
+	return s.oauth, s.verifier, nil
+}
+
+// linkUser finds or creates the user for an external identity
+func (s *OIDCService) linkUser(ctx context.Context, issuer, subject string, claims oidcClaims) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Only a verified address proves the person owns the account it matches
+		email := strings.ToLower(strings.TrimSpace(claims.Email))
+		if email == "" || !claims.emailVerified() {
+			return ErrOIDCEmailNotVerified
+		}
+
+		err = tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			if !user.EmailVerified {
+				if err := tx.Model(&user).Update("email_verified", true).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.createUser(tx, &user, email, claims.PreferredUsername); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:  user.ID,
+			Issuer:  issuer,
+			Subject: subject,
+			Email:   email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createUser registers a user on their first single sign-on login. They get
+// an unguessable password and can set their own through a password reset.
+func (s *OIDCService) createUser(tx *gorm.DB, user *models.User, email, preferredUsername string) error {
+	username, err := availableUsername(tx, preferredUsername, email)
+	if err != nil {
+		return err
+	}
+
+	password, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	*user = models.User{
+		Email:         email,
+		Username:      username,
+		Password:      hashedPassword,
+		EmailVerified: true,
+	}
+	return tx.Create(user).Error
+}
+
+// availableUsername derives a valid, unused username from the provider's
+// preferred username or the email's local part
+func availableUsername(tx *gorm.DB, preferred, email string) (string, error) {
+	base := usernameUnsafeChars.ReplaceAllString(preferred, "_")
+	if len(strings.Trim(base, "_")) < 3 {
+		local, _, _ := strings.Cut(email, "@")
+		base = usernameUnsafeChars.ReplaceAllString(local, "_")
+	}
+	base = strings.Trim(base, "_")
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 20 {
+		base = base[:20]
+	}
+
+	candidate := base
+	for i := 0; i < 10; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 && utils.ValidateUsername(candidate) == nil {
+			return candidate, nil
+		}
+
+		suffix, err := randomHex(3)
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "_" + suffix
+	}
+	return "", errors.New("could not find an available username")
+}
+
+// emailVerified accepts the claim as a boolean or, as some providers send
+// it, a string
+func (c oidcClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+func (s *OIDCService) fail(w http.ResponseWriter, r *http.Request, code string, err error) {
+	log.Printf("OIDC login failed (%s): %v", code, err)
+	http.Redirect(w, r, s.appURL+"/auth/callback#"+url.Values{"error": {code}}.Encode(), http.StatusFound)
+}
+
+func (s *OIDCService) flowCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.cfg.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *OIDCService) signFlow(flow oidcFlow) string {
+	payload, _ := json.Marshal(flow)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *OIDCService) readFlow(r *http.Request) (*oidcFlow, error) {
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return nil, errors.New("missing login flow cookie")
+	}
+
+	encodedPayload, encodedSig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return nil, errors.New("malformed login flow cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errors.New("malformed login flow cookie")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, errors.New("malformed login flow cookie")
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errors.New("invalid login flow cookie signature")
+	}
+
+	var flow oidcFlow
+	if err := json.Unmarshal(payload, &flow); err != nil {
+		return nil, errors.New("malformed login flow cookie")
+	}
+	if time.Now().Unix() > flow.ExpiresAt {
+		return nil, errors.New("login flow expired")
+	}
+	return &flow, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/mail"
+	"markly-backend/internal/models"
+	"markly-backend/internal/utils"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordResetService emails single-use password reset links and applies
+// the new password when a link is used
+type PasswordResetService struct {
+	db     *gorm.DB
+	mailer mail.Mailer
+	appURL string
+	ttl    time.Duration
+}
+
+func NewPasswordResetService(db *gorm.DB, mailer mail.Mailer, appURL string, ttl time.Duration) *PasswordResetService {
+	return &PasswordResetService{
+		db:     db,
+		mailer: mailer,
+		appURL: strings.TrimRight(appURL, "/"),
+		ttl:    ttl,
+	}
+}
+
+// Request emails a reset link to the account registered under email. It
+// succeeds whether or not the account exists, and the mail is sent in the
+// background, so callers cannot use it to discover registered addresses.
+func (s *PasswordResetService) Request(ctx context.Context, email string) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only the most recent link works
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(s.ttl),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/auth/reset-password?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Markly password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password for your Markly account. "+
+			"Open this link within %s to choose a new one:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email and your password will stay the same.\n",
+			user.Username, humanDuration(s.ttl), link),
+	}
+	sendInBackground(ctx, s.mailer, user.ID, msg)
+	return nil
+}
+
+// Reset sets a new password using a reset token and returns the user's ID.
+// The token and any other outstanding tokens for the user are used up, and
+// the user's personal access tokens are revoked, as a reset often follows a
+// compromised account.
+func (s *PasswordResetService) Reset(ctx context.Context, token, newPassword string) (uint, error) {
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return 0, errors.New("failed to process password")
+	}
+
+	var userID uint
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&reset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		// The used_at guard stops two concurrent requests from both using the token
+		now := time.Now()
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrInvalidResetToken
+		}
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", reset.UserID).Delete(&models.APIToken{}).Error; err != nil {
+			return err
+		}
+
+		userID = reset.UserID
+		return tx.Model(&models.User{}).Where("id = ?", reset.UserID).Update("password", hashedPassword).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+	"markly-backend/internal/utils"
+)
+
+func TestResetRevokesAPITokens(t *testing.T) {
+	db := testdb.Open(t)
+	s := NewPasswordResetService(db, nil, "http://localhost", time.Hour)
+	apiTokens := NewAPITokenService(db)
+	ctx := context.Background()
+	user := testdb.CreateUser(t, db, "alice")
+
+	token, _, err := apiTokens.Create(ctx, user.ID, "script", []string{ScopeBookmarksRead}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := db.Create(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken("reset-token"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := s.Reset(ctx, "reset-token", "new-password-1")
+	if err != nil || userID != user.ID {
+		t.Fatalf("Reset = %d, %v; want %d", userID, err, user.ID)
+	}
+	if _, err := apiTokens.VerifyAPIToken(ctx, token); err == nil {
+		t.Error("personal access token still works after a password reset")
+	}
+
+	var stored models.User
+	db.First(&stored, user.ID)
+	if !utils.CheckPasswordHash("new-password-1", stored.Password) {
+		t.Error("password was not changed")
+	}
+	if _, err := s.Reset(ctx, "reset-token", "new-password-2"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("reusing the reset token = %v, want %v", err, ErrInvalidResetToken)
+	}
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/models"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
+// RefreshTokenService issues and rotates refresh tokens and tracks sessions
+// and revoked access tokens. Each login starts a session with its own token
+// family; presenting a token that has already been rotated revokes the whole
+// family, since it means a copy of the token is in someone else's hands.
+type RefreshTokenService struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// IssuedRefreshToken is a newly issued refresh token. Token is only ever
+// available at issue time; the database keeps its hash.
+type IssuedRefreshToken struct {
+	Token     string
+	FamilyID  string
+	ExpiresAt time.Time
+}
+
+func NewRefreshTokenService(db *gorm.DB, ttl time.Duration) *RefreshTokenService {
+	return &RefreshTokenService{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// Issue starts a new token family and session for userID, recording the
+// client's user agent and IP address from ctx
+func (s *RefreshTokenService) Issue(ctx context.Context, userID uint) (*IssuedRefreshToken, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	var issued *IssuedRefreshToken
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(newSession(ctx, userID, familyID)).Error; err != nil {
+			return err
+		}
+
+		var err error
+		issued, _, err = s.create(tx, userID, familyID)
+		return err
+	})
+	return issued, err
+}
+
+// Rotate exchanges a refresh token for a new one in the same family and
+// returns the owning user's ID
+func (s *RefreshTokenService) Rotate(ctx context.Context, token string) (uint, *IssuedRefreshToken, error) {
+	var (
+		userID uint
+		issued *IssuedRefreshToken
+		reused bool
+	)
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			reused = current.ReplacedByID != nil
+			userID = current.UserID
+			if reused {
+				return s.revokeFamily(tx, current.UserID, current.FamilyID)
+			}
+			return nil
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		// Families started before sessions were tracked get one now
+		if err := tx.Where(models.Session{FamilyID: current.FamilyID}).
+			Attrs(newSession(ctx, current.UserID, current.FamilyID)).
+			FirstOrCreate(&models.Session{}).Error; err != nil {
+			return err
+		}
+
+		next, nextID, err := s.create(tx, current.UserID, current.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		// The revoked_at guard makes concurrent rotations of one token count as reuse
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "replaced_by_id": nextID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrRefreshTokenReused
+		}
+
+		userID = current.UserID
+		issued = next
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if reused {
+		log.Printf("Refresh token reuse detected for user %d; session revoked", userID)
+		return 0, nil, ErrRefreshTokenReused
+	}
+	if issued == nil {
+		return 0, nil, ErrInvalidRefreshToken
+	}
+	return userID, issued, nil
+}
+
+// RevokeSession revokes a session and every refresh token in its family
+func (s *RefreshTokenService) RevokeSession(ctx context.Context, userID uint, familyID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.revokeFamily(tx, userID, familyID)
+	})
+}
+
+// RevokeAllSessions revokes every session and refresh token the user holds
+func (s *RefreshTokenService) RevokeAllSessions(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// RevokeSessionByToken revokes the family a refresh token belongs to
+func (s *RefreshTokenService) RevokeSessionByToken(ctx context.Context, userID uint, token string) error {
+	var current models.RefreshToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ? AND user_id = ?", hashToken(token), userID).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return s.RevokeSession(ctx, userID, current.FamilyID)
+}
+
+// RevokeAccessToken blocks an access token until it would have expired anyway
+func (s *RefreshTokenService) RevokeAccessToken(ctx context.Context, userID uint, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+
+	db := s.db.WithContext(ctx)
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return db.Save(&models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}).Error
+}
+
+// IsTokenRevoked implements middleware.RevocationChecker
+func (s *RefreshTokenService) IsTokenRevoked(ctx context.Context, jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		// Fail closed: a token we cannot check is treated as revoked
+		log.Printf("Failed to check token revocation: %v", err)
+		return true
+	}
+	return count > 0
+}
+
+func (s *RefreshTokenService) create(tx *gorm.DB, userID uint, familyID string) (*IssuedRefreshToken, uint, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	record := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return &IssuedRefreshToken{
+		Token:     token,
+		FamilyID:  familyID,
+		ExpiresAt: record.ExpiresAt,
+	}, record.ID, nil
+}
+
+func (s *RefreshTokenService) revokeFamily(tx *gorm.DB, userID uint, familyID string) error {
+	now := time.Now()
+	if err := tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, familyID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, familyID).
+		Update("revoked_at", now).Error
+}
+
+// hashToken returns the value stored for a token. Tokens are random, so a
+// plain SHA-256 is enough to make a leaked table useless.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewRefreshTokenService(db, time.Hour)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, second, err := s.Rotate(ctx, first.Token)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if userID != user.ID {
+		t.Errorf("Rotate returned user %d, want %d", userID, user.ID)
+	}
+	if second.FamilyID != first.FamilyID {
+		t.Errorf("rotated token changed family from %s to %s", first.FamilyID, second.FamilyID)
+	}
+	if second.Token == first.Token {
+		t.Error("rotated token is the same as the original")
+	}
+
+	if _, _, err := s.Rotate(ctx, second.Token); err != nil {
+		t.Errorf("Rotate of the current token: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewRefreshTokenService(db, time.Hour)
+	ctx := context.Background()
+
+	stolen, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, current, err := s.Rotate(ctx, stolen.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.Rotate(ctx, stolen.Token); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Rotate of a rotated token = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, _, err := s.Rotate(ctx, current.Token); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate of the family's current token after reuse = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	var session models.Session
+	if err := db.Where("family_id = ?", stolen.FamilyID).First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.RevokedAt == nil {
+		t.Error("session of the reused token was not revoked")
+	}
+
+	// Other sessions are unaffected
+	if _, _, err := s.Rotate(ctx, other.Token); err != nil {
+		t.Errorf("Rotate in another family: %v", err)
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewRefreshTokenService(db, time.Hour)
+	ctx := context.Background()
+
+	if _, _, err := s.Rotate(ctx, "unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate of an unknown token = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	expired, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.RefreshToken{}).Where("family_id = ?", expired.FamilyID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Rotate(ctx, expired.Token); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("Rotate of an expired token = %v, want %v", err, ErrRefreshTokenExpired)
+	}
+
+	loggedOut, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeSessionByToken(ctx, user.ID, loggedOut.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Rotate(ctx, loggedOut.Token); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate after logout = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestAccessTokenRevocation(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewRefreshTokenService(db, time.Hour)
+	ctx := context.Background()
+
+	if s.IsTokenRevoked(ctx, "jti-1") {
+		t.Fatal("token revoked before RevokeAccessToken")
+	}
+	if err := s.RevokeAccessToken(ctx, user.ID, "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsTokenRevoked(ctx, "jti-1") {
+		t.Error("token not revoked after RevokeAccessToken")
+	}
+	if s.IsTokenRevoked(ctx, "jti-2") {
+		t.Error("unrelated token reported revoked")
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/middleware"
+	"markly-backend/internal/models"
+)
+
+const (
+	// lastSeenResolution limits how often a session's last-seen time is written
+	lastSeenResolution = time.Minute
+	maxUserAgentLength = 512
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// ListSessions returns userID's active sessions, most recently used first.
+// Sessions whose refresh tokens have all expired are left out.
+func (s *RefreshTokenService) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where("EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id = sessions.family_id AND refresh_tokens.revoked_at IS NULL AND refresh_tokens.expires_at > ?)", time.Now()).
+		Order("last_seen_at DESC, id DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSessionByID signs one of userID's sessions out
+func (s *RefreshTokenService) RevokeSessionByID(ctx context.Context, userID, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		if err := tx.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		return s.revokeFamily(tx, userID, session.FamilyID)
+	})
+}
+
+// RevokeOtherSessions signs userID out everywhere except the session
+// identified by familyID
+func (s *RefreshTokenService) RevokeOtherSessions(ctx context.Context, userID uint, familyID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, familyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// TouchSession reports whether the session an access token belongs to is
+// still active, and records when and from where it was last used. It
+// implements middleware.SessionChecker.
+func (s *RefreshTokenService) TouchSession(ctx context.Context, sessionID, jti string) bool {
+	if sessionID == "" {
+		return false
+	}
+
+	var session models.Session
+	if err := s.db.WithContext(ctx).Where("family_id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// The session was purged with its account, or the token predates
+			// session tracking; a refresh creates a session if it still can
+			return false
+		}
+		// Fail closed, as for revoked tokens
+		log.Printf("Failed to check session: %v", err)
+		return false
+	}
+	if session.RevokedAt != nil {
+		return false
+	}
+
+	now := time.Now()
+	ip := middleware.ClientIPFromContext(ctx)
+	if now.Sub(session.LastSeenAt) < lastSeenResolution && session.JTI == jti && (ip == "" || session.IPAddress == ip) {
+		return true
+	}
+
+	updates := map[string]interface{}{"last_seen_at": now, "jti": jti}
+	if ip != "" {
+		updates["ip_address"] = ip
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", session.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update session %d: %v", session.ID, err)
+	}
+	return true
+}
+
+// newSession describes a session started by the client making the request
+func newSession(ctx context.Context, userID uint, familyID string) *models.Session {
+	userAgent := middleware.UserAgentFromContext(ctx)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	return &models.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		UserAgent:  userAgent,
+		IPAddress:  middleware.ClientIPFromContext(ctx),
+		LastSeenAt: time.Now(),
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+func TestTouchSession(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewRefreshTokenService(db, time.Hour)
+	ctx := context.Background()
+
+	issued, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.TouchSession(ctx, issued.FamilyID, "jti-1") {
+		t.Error("active session refused")
+	}
+	if s.TouchSession(ctx, "", "jti-1") {
+		t.Error("token without a session accepted")
+	}
+
+	var session models.Session
+	if err := db.Where("family_id = ?", issued.FamilyID).First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.JTI != "jti-1" {
+		t.Errorf("session JTI = %q, want the last token used", session.JTI)
+	}
+
+	if err := s.RevokeSession(ctx, user.ID, issued.FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	if s.TouchSession(ctx, issued.FamilyID, "jti-1") {
+		t.Error("revoked session accepted")
+	}
+}
+
+func TestTouchSessionMissingRow(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewRefreshTokenService(db, time.Hour)
+	ctx := context.Background()
+
+	issued, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Purging an account deletes its sessions outright
+	if err := db.Where("user_id = ?", user.ID).Delete(&models.Session{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if s.TouchSession(ctx, issued.FamilyID, "jti-1") {
+		t.Error("access token of a deleted session accepted")
+	}
+	if s.TouchSession(ctx, "never-existed", "jti-1") {
+		t.Error("access token of an unknown session accepted")
+	}
+}
+
+func TestLegacyFamilyGetsSessionOnRefresh(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewRefreshTokenService(db, time.Hour)
+	ctx := context.Background()
+
+	issued, err := s.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A family started before sessions were tracked
+	if err := db.Where("family_id = ?", issued.FamilyID).Delete(&models.Session{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if s.TouchSession(ctx, issued.FamilyID, "jti-1") {
+		t.Fatal("access token without a session accepted")
+	}
+
+	if _, _, err := s.Rotate(ctx, issued.Token); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if !s.TouchSession(ctx, issued.FamilyID, "jti-2") {
+		t.Error("session created by the refresh refused")
+	}
+}
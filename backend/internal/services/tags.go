@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"markly-backend/internal/models"
+)
+
+var (
+	ErrTagNotFound = errors.New("tag not found")
+	ErrTagExists   = errors.New("a tag with that name already exists")
+)
+
+// TagUsage is a tag with the number of bookmarks carrying it
+type TagUsage struct {
+	models.Tag
+	BookmarkCount int64
+}
+
+// TagService maintains each user's tags and their links to bookmarks. Changes
+// to a tag are copied into Bookmark.Tags of the bookmarks carrying it in the
+// same transaction.
+type TagService struct {
+	db *gorm.DB
+}
+
+func NewTagService(db *gorm.DB) *TagService {
+	return &TagService{db: db}
+}
+
+// LinkTags replaces bookmark's tag links with the names in bookmark.Tags,
+// creating the tags its owner does not have yet. Call it in the transaction
+// that saves the bookmark.
+func (s *TagService) LinkTags(tx *gorm.DB, bookmark *models.Bookmark) error {
+	if err := tx.Where("bookmark_id = ?", bookmark.ID).Delete(&models.BookmarkTag{}).Error; err != nil {
+		return err
+	}
+	if len(bookmark.Tags) == 0 {
+		return nil
+	}
+
+	tags, err := findOrCreateTags(tx, bookmark.UserID, bookmark.Tags)
+	if err != nil {
+		return err
+	}
+	links := make([]models.BookmarkTag, len(tags))
+	for i, tag := range tags {
+		links[i] = models.BookmarkTag{BookmarkID: bookmark.ID, TagID: tag.ID}
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+}
+
+// List returns userID's tags that are on at least one bookmark, by name
+func (s *TagService) List(ctx context.Context, userID uint) ([]TagUsage, error) {
+	var usages []TagUsage
+	err := tagUsage(s.db.WithContext(ctx)).
+		Where("tags.user_id = ?", userID).
+		Having("COUNT(bookmarks.id) > 0").
+		Order("tags.name").
+		Scan(&usages).Error
+	return usages, err
+}
+
+// Rename changes the name of one of userID's tags on every bookmark carrying
+// it. Renaming to the name of a tag still in use is refused; merge them instead.
+func (s *TagService) Rename(ctx context.Context, userID, tagID uint, name string) (*TagUsage, error) {
+	var usage *TagUsage
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tag, err := findTag(tx, userID, tagID)
+		if err != nil {
+			return err
+		}
+
+		if tag.Name != name {
+			var other models.Tag
+			err := tx.Where("user_id = ? AND name = ? AND id <> ?", userID, name, tag.ID).First(&other).Error
+			switch {
+			case err == nil:
+				var count int64
+				if err := tx.Model(&models.BookmarkTag{}).Where("tag_id = ?", other.ID).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return ErrTagExists
+				}
+				// An unused tag only holds on to the name
+				if err := tx.Delete(&other).Error; err != nil {
+					return err
+				}
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+
+			if err := retag(tx, []uint{tag.ID}, []string{tag.Name}, name); err != nil {
+				return err
+			}
+			if err := tx.Model(tag).Update("name", name).Error; err != nil {
+				return err
+			}
+		}
+
+		usage, err = findTagUsage(tx, tag.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Merge moves every bookmark carrying one of sourceIDs over to targetID and
+// deletes the source tags
+func (s *TagService) Merge(ctx context.Context, userID uint, sourceIDs []uint, targetID uint) (*TagUsage, error) {
+	var usage *TagUsage
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		target, err := findTag(tx, userID, targetID)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]uint, 0, len(sourceIDs))
+		for _, id := range sourceIDs {
+			if id != targetID {
+				ids = append(ids, id)
+			}
+		}
+		var sources []models.Tag
+		if len(ids) > 0 {
+			if err := tx.Where("id IN ? AND user_id = ?", ids, userID).Find(&sources).Error; err != nil {
+				return err
+			}
+		}
+		if len(sources) != len(uniqueIDs(ids)) {
+			return ErrTagNotFound
+		}
+
+		if len(sources) > 0 {
+			mergedIDs := make([]uint, len(sources))
+			names := make([]string, len(sources))
+			for i, source := range sources {
+				mergedIDs[i] = source.ID
+				names[i] = source.Name
+			}
+
+			var bookmarkIDs []uint
+			if err := tx.Model(&models.BookmarkTag{}).Distinct("bookmark_id").
+				Where("tag_id IN ?", mergedIDs).Pluck("bookmark_id", &bookmarkIDs).Error; err != nil {
+				return err
+			}
+			if len(bookmarkIDs) > 0 {
+				links := make([]models.BookmarkTag, len(bookmarkIDs))
+				for i, bookmarkID := range bookmarkIDs {
+					links[i] = models.BookmarkTag{BookmarkID: bookmarkID, TagID: target.ID}
+				}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := retag(tx, mergedIDs, names, target.Name); err != nil {
+				return err
+			}
+			if err := deleteTags(tx, mergedIDs); err != nil {
+				return err
+			}
+		}
+
+		usage, err = findTagUsage(tx, target.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Delete removes one of userID's tags from every bookmark carrying it
+func (s *TagService) Delete(ctx context.Context, userID, tagID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tag, err := findTag(tx, userID, tagID)
+		if err != nil {
+			return err
+		}
+		if err := retag(tx, []uint{tag.ID}, []string{tag.Name}, ""); err != nil {
+			return err
+		}
+		return deleteTags(tx, []uint{tag.ID})
+	})
+}
+
+func findTag(tx *gorm.DB, userID, tagID uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := tx.Where("id = ? AND user_id = ?", tagID, userID).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func findTagUsage(tx *gorm.DB, tagID uint) (*TagUsage, error) {
+	var usage TagUsage
+	if err := tagUsage(tx).Where("tags.id = ?", tagID).Scan(&usage).Error; err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// tagUsage selects tags along with how many bookmarks outside the trash carry each
+func tagUsage(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Tag{}).
+		Select("tags.id, tags.user_id, tags.name, tags.created_at, COUNT(bookmarks.id) AS bookmark_count").
+		Joins("LEFT JOIN bookmark_tags ON bookmark_tags.tag_id = tags.id").
+		Joins("LEFT JOIN bookmarks ON bookmarks.id = bookmark_tags.bookmark_id AND bookmarks.deleted_at IS NULL").
+		Group("tags.id, tags.user_id, tags.name, tags.created_at")
+}
+
+// findOrCreateTags returns userID's tags with the given names, creating any
+// that are missing
+func findOrCreateTags(tx *gorm.DB, userID uint, names []string) ([]models.Tag, error) {
+	var tags []models.Tag
+	if err := tx.Where("user_id = ? AND name IN ?", userID, names).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		existing[tag.Name] = true
+	}
+	var missing []models.Tag
+	for _, name := range names {
+		if !existing[name] {
+			missing = append(missing, models.Tag{UserID: userID, Name: name})
+			existing[name] = true
+		}
+	}
+	if len(missing) == 0 {
+		return tags, nil
+	}
+
+	// Another request may have created some of them in the meantime, and
+	// skipped rows come back without IDs, so read the set again
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+		return nil, err
+	}
+	tags = nil
+	if err := tx.Where("user_id = ? AND name IN ?", userID, names).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// retag rewrites the tag names copied into the bookmarks linked to tagIDs,
+// including those in the trash. Names in from become to, or are dropped when
+// to is empty.
+func retag(tx *gorm.DB, tagIDs []uint, from []string, to string) error {
+	var bookmarks []models.Bookmark
+	linked := tx.Model(&models.BookmarkTag{}).Select("bookmark_id").Where("tag_id IN ?", tagIDs)
+	if err := tx.Unscoped().Select("id", "tags").Where("id IN (?)", linked).Find(&bookmarks).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, bookmark := range bookmarks {
+		tags := make([]string, 0, len(bookmark.Tags))
+		seen := make(map[string]bool, len(bookmark.Tags))
+		for _, name := range bookmark.Tags {
+			if containsFold(from, name) {
+				if to == "" {
+					continue
+				}
+				name = to
+			}
+			if !seen[name] {
+				seen[name] = true
+				tags = append(tags, name)
+			}
+		}
+
+		if err := tx.Unscoped().Model(&models.Bookmark{}).Where("id = ?", bookmark.ID).
+			Select("tags", "updated_at").
+			Updates(&models.Bookmark{Tags: tags, UpdatedAt: now}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteTags(tx *gorm.DB, tagIDs []uint) error {
+	if err := tx.Where("tag_id IN ?", tagIDs).Delete(&models.BookmarkTag{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", tagIDs).Delete(&models.Tag{}).Error
+}
+
+// containsFold reports whether names holds name. Tags written before names
+// were lowercased may differ in case from their Tag.
+func containsFold(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
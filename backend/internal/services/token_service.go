@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"markly-backend/internal/config"
+	"markly-backend/internal/middleware"
+)
+
+// TokenService signs and verifies access tokens. New tokens are signed with
+// the current key and carry its ID in the kid header; verification accepts
+// any configured key, so a previous key can stay active while the tokens it
+// signed expire.
+type TokenService struct {
+	signingKeyID string
+	keys         map[string][]byte
+	issuer       string
+	audience     string
+	expiry       time.Duration
+}
+
+// NewTokenService builds a token service from the JWT configuration.
+// fallbackExpiry is used when JWTConfig.Expiry is not a valid duration.
+func NewTokenService(cfg *config.JWTConfig, fallbackExpiry time.Duration) (*TokenService, error) {
+	if len(cfg.Secret) < 32 {
+		return nil, errors.New("JWT secret must be at least 32 characters long")
+	}
+	if cfg.KeyID == "" {
+		return nil, errors.New("JWT key ID must not be empty")
+	}
+
+	expiry, err := time.ParseDuration(cfg.Expiry)
+	if err != nil || expiry <= 0 {
+		expiry = fallbackExpiry
+	}
+
+	keys := map[string][]byte{cfg.KeyID: []byte(cfg.Secret)}
+	for kid, secret := range cfg.VerificationKeys {
+		if kid == cfg.KeyID {
+			continue
+		}
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("JWT verification key %s must be at least 32 characters long", kid)
+		}
+		keys[kid] = []byte(secret)
+	}
+
+	return &TokenService{
+		signingKeyID: cfg.KeyID,
+		keys:         keys,
+		issuer:       cfg.Issuer,
+		audience:     cfg.Audience,
+		expiry:       expiry,
+	}, nil
+}
+
+// AccessTokenExpiry returns the lifetime of newly issued access tokens
+func (s *TokenService) AccessTokenExpiry() time.Duration {
+	return s.expiry
+}
+
+// GenerateAccessToken signs an access token for a user's login session
+func (s *TokenService) GenerateAccessToken(userID uint, sessionID string) (string, *middleware.JWTClaims, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &middleware.JWTClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   "user-auth",
+			Audience:  []string{s.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.expiry)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = s.signingKeyID
+	signed, err := token.SignedString(s.keys[s.signingKeyID])
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ParseAccessToken verifies a token's signature, issuer, audience and
+// lifetime and returns its claims. It implements middleware.TokenVerifier.
+func (s *TokenService) ParseAccessToken(tokenString string) (*middleware.JWTClaims, error) {
+	claims := &middleware.JWTClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keyFor,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// keyFor selects the verification key named by the token's kid header.
+// Tokens without a kid predate key rotation and are checked against the
+// current signing key.
+func (s *TokenService) keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = s.signingKeyID
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"markly-backend/internal/config"
+	"markly-backend/internal/middleware"
+)
+
+const (
+	oldSecret = "old-secret-old-secret-old-secret-0"
+	newSecret = "new-secret-new-secret-new-secret-1"
+)
+
+func testJWTConfig(keyID, secret string, verification map[string]string) *config.JWTConfig {
+	return &config.JWTConfig{
+		Secret:           secret,
+		KeyID:            keyID,
+		Expiry:           "15m",
+		Issuer:           "markly",
+		Audience:         "markly-api",
+		VerificationKeys: verification,
+	}
+}
+
+func newTestTokenService(t *testing.T, cfg *config.JWTConfig) *TokenService {
+	t.Helper()
+	s, err := NewTokenService(cfg, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	s := newTestTokenService(t, testJWTConfig("k1", oldSecret, nil))
+
+	token, issued, err := s.GenerateAccessToken(7, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken: %v", err)
+	}
+	if claims.UserID != 7 || claims.SessionID != "family" || claims.ID != issued.ID {
+		t.Errorf("claims = %+v, want user 7, session family, jti %s", claims, issued.ID)
+	}
+	if got := claims.ExpiresAt.Sub(claims.IssuedAt.Time); got != 15*time.Minute {
+		t.Errorf("token lifetime = %s, want 15m", got)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &middleware.JWTClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := parsed.Header["kid"]; kid != "k1" {
+		t.Errorf("kid = %v, want k1", kid)
+	}
+}
+
+func TestAccessTokenKeyRotation(t *testing.T) {
+	before := newTestTokenService(t, testJWTConfig("k1", oldSecret, nil))
+	oldToken, _, err := before.GenerateAccessToken(1, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 signs from now on, and k1 is still accepted while its tokens expire
+	during := newTestTokenService(t, testJWTConfig("k2", newSecret, map[string]string{"k1": oldSecret}))
+	if _, err := during.ParseAccessToken(oldToken); err != nil {
+		t.Errorf("token signed with the previous key rejected during rotation: %v", err)
+	}
+	newToken, _, err := during.GenerateAccessToken(1, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := during.ParseAccessToken(newToken); err != nil {
+		t.Errorf("token signed with the current key rejected: %v", err)
+	}
+
+	// Once k1 is dropped, its tokens stop working
+	after := newTestTokenService(t, testJWTConfig("k2", newSecret, nil))
+	if _, err := after.ParseAccessToken(oldToken); err == nil {
+		t.Error("token signed with a retired key accepted")
+	}
+	if _, err := after.ParseAccessToken(newToken); err != nil {
+		t.Errorf("token signed with the current key rejected after rotation: %v", err)
+	}
+}
+
+func TestAccessTokenRejected(t *testing.T) {
+	s := newTestTokenService(t, testJWTConfig("k1", oldSecret, nil))
+	now := time.Now()
+
+	sign := func(claims jwt.Claims, kid string, method jwt.SigningMethod, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	claims := func(issuer, audience string, expiresAt time.Time) *middleware.JWTClaims {
+		return &middleware.JWTClaims{
+			UserID: 1,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Audience:  []string{audience},
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+			},
+		}
+	}
+
+	tests := map[string]string{
+		"wrong secret":   sign(claims("markly", "markly-api", now.Add(time.Hour)), "k1", jwt.SigningMethodHS256, []byte(newSecret)),
+		"unknown kid":    sign(claims("markly", "markly-api", now.Add(time.Hour)), "k9", jwt.SigningMethodHS256, []byte(oldSecret)),
+		"wrong issuer":   sign(claims("someone", "markly-api", now.Add(time.Hour)), "k1", jwt.SigningMethodHS256, []byte(oldSecret)),
+		"wrong audience": sign(claims("markly", "other", now.Add(time.Hour)), "k1", jwt.SigningMethodHS256, []byte(oldSecret)),
+		"expired":        sign(claims("markly", "markly-api", now.Add(-time.Minute)), "k1", jwt.SigningMethodHS256, []byte(oldSecret)),
+		"other method":   sign(claims("markly", "markly-api", now.Add(time.Hour)), "k1", jwt.SigningMethodHS512, []byte(oldSecret)),
+		"no expiry": sign(&middleware.JWTClaims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: "markly", Audience: []string{"markly-api"},
+		}}, "k1", jwt.SigningMethodHS256, []byte(oldSecret)),
+	}
+	for name, token := range tests {
+		if _, err := s.ParseAccessToken(token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	// Tokens from before key IDs were introduced are checked against the signing key
+	legacy := sign(claims("markly", "markly-api", now.Add(time.Hour)), "", jwt.SigningMethodHS256, []byte(oldSecret))
+	if _, err := s.ParseAccessToken(legacy); err != nil {
+		t.Errorf("token without kid rejected: %v", err)
+	}
+}
+
+func TestNewTokenServiceValidatesKeys(t *testing.T) {
+	if _, err := NewTokenService(testJWTConfig("k1", "short", nil), time.Hour); err == nil {
+		t.Error("short signing secret accepted")
+	}
+	if _, err := NewTokenService(testJWTConfig("", oldSecret, nil), time.Hour); err == nil {
+		t.Error("empty key ID accepted")
+	}
+	_, err := NewTokenService(testJWTConfig("k2", newSecret, map[string]string{"k1": "short"}), time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "k1") {
+		t.Errorf("short verification key: error = %v, want one naming k1", err)
+	}
+}
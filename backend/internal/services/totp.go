@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"markly-backend/internal/models"
+)
+
+const (
+	totpIssuer = "Markly"
+	totpPeriod = 30
+	// totpSkew accepts codes from one period either side of now, to allow
+	// for clock drift on the user's device
+	totpSkew             = 1
+	recoveryCodeCount    = 10
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+var (
+	ErrTOTPAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled        = errors.New("two-factor authentication is not enabled")
+	ErrTOTPEnrollmentMissing = errors.New("start two-factor enrollment first")
+	ErrInvalidTOTPCode       = errors.New("invalid authentication code")
+	ErrInvalidLoginChallenge = errors.New("invalid or expired login challenge")
+	recoveryCodeEncoding     = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// TOTPService manages RFC 6238 authenticator app enrollment, recovery codes
+// and the second step of logging in
+type TOTPService struct {
+	db *gorm.DB
+}
+
+func NewTOTPService(db *gorm.DB) *TOTPService {
+	return &TOTPService{db: db}
+}
+
+// TOTPEnrollment is a pending authenticator secret waiting to be confirmed
+type TOTPEnrollment struct {
+	Secret     string
+	OTPAuthURI string
+}
+
+// IssuedLoginChallenge is a challenge token handed out by login. Token is
+// only available at issue time.
+type IssuedLoginChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Enabled reports whether userID has confirmed an authenticator app
+func (s *TOTPService) Enabled(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// BeginEnrollment generates a new secret for user, replacing any earlier
+// unconfirmed one. It takes effect once confirmed with a code.
+func (s *TOTPService) BeginEnrollment(ctx context.Context, user *models.User) (*TOTPEnrollment, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.TOTPCredential
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, "user_id = ?", user.ID).Error
+		switch {
+		case err == nil && existing.ConfirmedAt != nil:
+			return ErrTOTPAlreadyEnabled
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TOTPCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TOTPCredential{UserID: user.ID, Secret: key.Secret()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{Secret: key.Secret(), OTPAuthURI: key.URL()}, nil
+}
+
+// Confirm enables two-factor authentication once the user proves their app
+// produces valid codes, and returns a fresh set of recovery codes
+func (s *TOTPService) Confirm(ctx context.Context, userID uint, code string) ([]string, error) {
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var credential models.TOTPCredential
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&credential, "user_id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTOTPEnrollmentMissing
+			}
+			return err
+		}
+		if credential.ConfirmedAt != nil {
+			return ErrTOTPAlreadyEnabled
+		}
+
+		step, ok := matchTOTP(credential.Secret, code, credential.LastUsedStep)
+		if !ok {
+			return ErrInvalidTOTPCode
+		}
+
+		now := time.Now()
+		if err := tx.Model(&credential).Updates(map[string]interface{}{
+			"confirmed_at":   now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after checking a current TOTP
+// or recovery code
+func (s *TOTPService) Disable(ctx context.Context, userID uint, code string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ok, err := verifySecondFactor(tx, userID, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidTOTPCode
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.LoginChallenge{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error
+	})
+}
+
+// CreateChallenge starts the second login step for userID
+func (s *TOTPService) CreateChallenge(ctx context.Context, userID uint) (*IssuedLoginChallenge, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.db.WithContext(ctx)
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.LoginChallenge{}).Error; err != nil {
+		return nil, err
+	}
+
+	challenge := models.LoginChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return nil, err
+	}
+	return &IssuedLoginChallenge{Token: token, ExpiresAt: challenge.ExpiresAt}, nil
+}
+
+// ChallengeUser returns the user a pending login challenge was issued for
+func (s *TOTPService) ChallengeUser(ctx context.Context, token string) (uint, error) {
+	var challenge models.LoginChallenge
+	if err := s.db.WithContext(ctx).Where("token_hash = ? AND expires_at > ?", hashToken(token), time.Now()).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrInvalidLoginChallenge
+		}
+		return 0, err
+	}
+	return challenge.UserID, nil
+}
+
+// CompleteChallenge checks a TOTP or recovery code against a login challenge
+// and returns the user it was issued for. A challenge can be completed once
+// and allows a handful of wrong codes before it is discarded.
+func (s *TOTPService) CompleteChallenge(ctx context.Context, token, code string) (uint, error) {
+	var (
+		userID uint
+		valid  bool
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var challenge models.LoginChallenge
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(token)).First(&challenge).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidLoginChallenge
+			}
+			return err
+		}
+		if time.Now().After(challenge.ExpiresAt) {
+			return ErrInvalidLoginChallenge
+		}
+		userID = challenge.UserID
+
+		var err error
+		valid, err = verifySecondFactor(tx, challenge.UserID, code)
+		if err != nil {
+			return err
+		}
+
+		if valid || challenge.Attempts+1 >= maxChallengeAttempts {
+			return tx.Delete(&challenge).Error
+		}
+		return tx.Model(&challenge).Update("attempts", challenge.Attempts+1).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !valid {
+		return 0, ErrInvalidTOTPCode
+	}
+	return userID, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code, using it up
+func verifySecondFactor(tx *gorm.DB, userID uint, code string) (bool, error) {
+	var credential models.TOTPCredential
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrTOTPNotEnabled
+		}
+		return false, err
+	}
+
+	if step, ok := matchTOTP(credential.Secret, code, credential.LastUsedStep); ok {
+		err := tx.Model(&credential).Update("last_used_step", step).Error
+		return err == nil, err
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return false, nil
+	}
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// matchTOTP checks code against the periods around now and returns the
+// matching time step. Steps at or before lastUsedStep are rejected so an
+// observed code cannot be replayed.
+func matchTOTP(secret, code string, lastUsedStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != int(otp.DigitsSix) {
+		return 0, false
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		ok, err := hotp.ValidateCustom(code, uint64(step), secret, hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && ok {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// replaceRecoveryCodes discards userID's recovery codes and stores a new set,
+// returning the codes in the form shown to the user
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the separators and case users may type
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != 10 {
+		return ""
+	}
+	return code
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enableTOTP enrolls user and returns the secret and recovery codes
+func enableTOTP(t *testing.T, s *TOTPService, user *models.User) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := s.BeginEnrollment(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.Confirm(ctx, user.ID, totpCode(t, enrollment.Secret, time.Now()))
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTOTPService(db)
+	ctx := context.Background()
+
+	if _, err := s.Confirm(ctx, user.ID, "123456"); !errors.Is(err, ErrTOTPEnrollmentMissing) {
+		t.Errorf("Confirm without enrollment = %v, want %v", err, ErrTOTPEnrollmentMissing)
+	}
+
+	enrollment, err := s.BeginEnrollment(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := totpCode(t, enrollment.Secret, time.Now().Add(-time.Hour))
+	if _, err := s.Confirm(ctx, user.ID, wrong); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("Confirm with a stale code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	if enabled, _ := s.Enabled(ctx, user.ID); enabled {
+		t.Fatal("enabled before confirmation")
+	}
+
+	codes, err := s.Confirm(ctx, user.ID, totpCode(t, enrollment.Secret, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if enabled, _ := s.Enabled(ctx, user.ID); !enabled {
+		t.Error("not enabled after confirmation")
+	}
+	if _, err := s.BeginEnrollment(ctx, user); !errors.Is(err, ErrTOTPAlreadyEnabled) {
+		t.Errorf("BeginEnrollment when enabled = %v, want %v", err, ErrTOTPAlreadyEnabled)
+	}
+}
+
+func TestTOTPChallengeRejectsReplayedCode(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTOTPService(db)
+	ctx := context.Background()
+	secret, _ := enableTOTP(t, s, user)
+
+	// The code used to confirm cannot be used again
+	challenge, err := s.CreateChallenge(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompleteChallenge(ctx, challenge.Token, totpCode(t, secret, time.Now())); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("replayed code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+
+	next := totpCode(t, secret, time.Now().Add(totpPeriod*time.Second))
+	userID, err := s.CompleteChallenge(ctx, challenge.Token, next)
+	if err != nil {
+		t.Fatalf("CompleteChallenge with the next code: %v", err)
+	}
+	if userID != user.ID {
+		t.Errorf("CompleteChallenge returned user %d, want %d", userID, user.ID)
+	}
+
+	// A completed challenge is gone
+	if _, err := s.CompleteChallenge(ctx, challenge.Token, next); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("reusing a completed challenge = %v, want %v", err, ErrInvalidLoginChallenge)
+	}
+}
+
+func TestTOTPChallengeAttempts(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTOTPService(db)
+	ctx := context.Background()
+	enableTOTP(t, s, user)
+
+	challenge, err := s.CreateChallenge(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxChallengeAttempts; i++ {
+		if _, err := s.CompleteChallenge(ctx, challenge.Token, "000000"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("attempt %d = %v, want %v", i+1, err, ErrInvalidTOTPCode)
+		}
+	}
+	if _, err := s.CompleteChallenge(ctx, challenge.Token, "000000"); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("attempt after the limit = %v, want %v", err, ErrInvalidLoginChallenge)
+	}
+
+	expired, err := s.CreateChallenge(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.LoginChallenge{}).Where("token_hash = ?", hashToken(expired.Token)).
+		Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ChallengeUser(ctx, expired.Token); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("ChallengeUser of an expired challenge = %v, want %v", err, ErrInvalidLoginChallenge)
+	}
+}
+
+func TestTOTPRecoveryCodes(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTOTPService(db)
+	ctx := context.Background()
+	_, codes := enableTOTP(t, s, user)
+
+	challenge, err := s.CreateChallenge(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Recovery codes may be typed without the dash and in capitals
+	typed := " " + strings.ToUpper(codes[0][:5]+codes[0][6:]) + " "
+	if _, err := s.CompleteChallenge(ctx, challenge.Token, typed); err != nil {
+		t.Fatalf("recovery code rejected: %v", err)
+	}
+
+	again, err := s.CreateChallenge(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompleteChallenge(ctx, again.Token, codes[0]); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("used recovery code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	if _, err := s.CompleteChallenge(ctx, again.Token, codes[1]); err != nil {
+		t.Errorf("unused recovery code rejected: %v", err)
+	}
+}
+
+func TestTOTPDisable(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTOTPService(db)
+	ctx := context.Background()
+	_, codes := enableTOTP(t, s, user)
+
+	if err := s.Disable(ctx, user.ID, "000000"); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("Disable with a wrong code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	if err := s.Disable(ctx, user.ID, codes[2]); err != nil {
+		t.Fatalf("Disable with a recovery code: %v", err)
+	}
+	if enabled, _ := s.Enabled(ctx, user.ID); enabled {
+		t.Error("still enabled after Disable")
+	}
+	var remaining int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ?", user.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d recovery codes left after Disable", remaining)
+	}
+	if err := s.Disable(ctx, user.ID, codes[3]); !errors.Is(err, ErrTOTPNotEnabled) {
+		t.Errorf("Disable when not enabled = %v, want %v", err, ErrTOTPNotEnabled)
+	}
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/models"
+)
+
+var (
+	ErrCollectionNotFound    = errors.New("collection not found")
+	ErrNotInTrash            = errors.New("item is not in the trash")
+	ErrCollectionInTrash     = errors.New("the bookmark's collection is in the trash; restore it first")
+	ErrParentCollectionTrash = errors.New("the parent collection is in the trash; restore it first")
+)
+
+// TrashService moves deleted bookmarks and collections to the trash, where
+// they can be restored until the purger removes them for good once they have
+// been there for the retention period.
+//
+// A collection goes to the trash along with the collections nested in it and
+// all of their bookmarks, and they share its DeletedAt. Restoring it brings
+// back what was trashed with it, but not what had been deleted before.
+type TrashService struct {
+	db        *gorm.DB
+	images    *ImageCaptureService
+	retention time.Duration
+}
+
+func NewTrashService(db *gorm.DB, images *ImageCaptureService, retention time.Duration) *TrashService {
+	return &TrashService{
+		db:        db,
+		images:    images,
+		retention: retention,
+	}
+}
+
+// TrashBookmark moves one of userID's bookmarks to the trash. It reports
+// false if there is no such bookmark outside the trash.
+func (s *TrashService) TrashBookmark(ctx context.Context, userID, bookmarkID uint) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.Bookmark{}).
+		Where("id = ? AND user_id = ?", bookmarkID, userID).
+		UpdateColumns(trashedBookmarkColumns(trashTime()))
+	return result.RowsAffected > 0, result.Error
+}
+
+// TrashCollection moves one of userID's collections to the trash along with
+// everything in it, and returns how many bookmarks went with it. Call it in
+// the transaction that decides what to do with the collection's contents.
+func (s *TrashService) TrashCollection(tx *gorm.DB, userID, collectionID uint) (int64, error) {
+	var collections []models.Collection
+	if err := tx.Select("id", "parent_id").Where("user_id = ?", userID).Find(&collections).Error; err != nil {
+		return 0, err
+	}
+	ids := subtreeIDs(collections, collectionID, func(models.Collection) bool { return true })
+	if len(ids) == 0 {
+		return 0, ErrCollectionNotFound
+	}
+
+	deletedAt := trashTime()
+	if err := tx.Model(&models.Collection{}).Where("id IN ?", ids).UpdateColumn("deleted_at", deletedAt).Error; err != nil {
+		return 0, err
+	}
+	result := tx.Model(&models.Bookmark{}).Where("collection_id IN ?", ids).UpdateColumns(trashedBookmarkColumns(deletedAt))
+	return result.RowsAffected, result.Error
+}
+
+// List returns what userID deleted, most recently deleted first. Collections
+// and bookmarks that went to the trash with a collection are left out, as
+// they are restored with it.
+func (s *TrashService) List(ctx context.Context, userID uint) ([]models.Collection, []models.Bookmark, error) {
+	db := s.db.WithContext(ctx).Unscoped().Session(&gorm.Session{})
+
+	var collections []models.Collection
+	if err := db.Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Where("NOT EXISTS (SELECT 1 FROM collections p WHERE p.id = collections.parent_id AND p.deleted_at = collections.deleted_at)").
+		Order("deleted_at DESC, id DESC").Find(&collections).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var bookmarks []models.Bookmark
+	if err := db.Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Where("NOT EXISTS (SELECT 1 FROM collections c WHERE c.id = bookmarks.collection_id AND c.deleted_at = bookmarks.deleted_at)").
+		Order("deleted_at DESC, id DESC").Find(&bookmarks).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return collections, bookmarks, nil
+}
+
+// RestoreBookmark takes one of userID's bookmarks out of the trash. Its
+// collection must not be in the trash. A bookmark whose URL was saved again
+// in the meantime comes back as a duplicate of it.
+func (s *TrashService) RestoreBookmark(ctx context.Context, userID, bookmarkID uint) (*models.Bookmark, error) {
+	var bookmark models.Bookmark
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", bookmarkID, userID).First(&bookmark).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotInTrash
+			}
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Collection{}).Where("id = ?", bookmark.CollectionID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrCollectionInTrash
+		}
+
+		bookmark.DeletedAt = gorm.DeletedAt{}
+		if err := tx.Unscoped().Model(&bookmark).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return assignURLKeys(tx, []uint{bookmark.ID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bookmark, nil
+}
+
+// RestoreCollection takes one of userID's collections out of the trash, along
+// with the collections and bookmarks trashed with it. The collection it is
+// nested in must not be in the trash.
+func (s *TrashService) RestoreCollection(ctx context.Context, userID, collectionID uint) (*models.Collection, error) {
+	var restored *models.Collection
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var collections []models.Collection
+		if err := tx.Unscoped().Where("user_id = ?", userID).Find(&collections).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]*models.Collection, len(collections))
+		for i := range collections {
+			byID[collections[i].ID] = &collections[i]
+		}
+
+		restored = byID[collectionID]
+		if restored == nil || !restored.DeletedAt.Valid {
+			return ErrNotInTrash
+		}
+		if restored.ParentID != nil {
+			if parent := byID[*restored.ParentID]; parent != nil && parent.DeletedAt.Valid {
+				return ErrParentCollectionTrash
+			}
+		}
+
+		deletedAt := restored.DeletedAt.Time
+		ids := subtreeIDs(collections, collectionID, func(collection models.Collection) bool {
+			return collection.DeletedAt.Valid && collection.DeletedAt.Time.Equal(deletedAt)
+		})
+		if err := tx.Unscoped().Model(&models.Collection{}).Where("id IN ?", ids).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		var bookmarkIDs []uint
+		if err := tx.Unscoped().Model(&models.Bookmark{}).
+			Where("collection_id IN ? AND deleted_at = ?", ids, restored.DeletedAt).
+			Pluck("id", &bookmarkIDs).Error; err != nil {
+			return err
+		}
+		if len(bookmarkIDs) > 0 {
+			if err := tx.Unscoped().Model(&models.Bookmark{}).Where("id IN ?", bookmarkIDs).
+				UpdateColumn("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			if err := assignURLKeys(tx, bookmarkIDs); err != nil {
+				return err
+			}
+		}
+
+		restored.DeletedAt = gorm.DeletedAt{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// Empty permanently deletes everything in userID's trash
+func (s *TrashService) Empty(ctx context.Context, userID uint) error {
+	_, err := s.purge(ctx, "user_id = ?", userID)
+	return err
+}
+
+// PurgeDue permanently deletes everything that has been in the trash for
+// longer than the retention period. Without one, nothing is purged.
+func (s *TrashService) PurgeDue(ctx context.Context) (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+	return s.purge(ctx, "deleted_at <= ?", trashTime().Add(-s.retention))
+}
+
+// RunPurger calls PurgeDue every interval until ctx is cancelled
+func (s *TrashService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := s.PurgeDue(ctx); err != nil {
+			log.Printf("Failed to purge the trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d items from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge permanently deletes the trashed collections and bookmarks matching
+// query and args, along with any bookmarks still left in those collections
+// and the smart collections filtered on them. It returns how many
+// collections and bookmarks were deleted.
+func (s *TrashService) purge(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var imageURLs []string
+	purged := 0
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped().Session(&gorm.Session{})
+
+		var collectionIDs []uint
+		if err := tx.Model(&models.Collection{}).Where("deleted_at IS NOT NULL").Where(query, args...).
+			Pluck("id", &collectionIDs).Error; err != nil {
+			return err
+		}
+
+		trashed := tx.Where("deleted_at IS NOT NULL").Where(query, args...)
+		if len(collectionIDs) > 0 {
+			trashed = tx.Where(trashed).Or("collection_id IN ?", collectionIDs)
+		}
+		var bookmarks []models.Bookmark
+		if err := tx.Select("id", "favicon", "screenshot").Where(trashed).Find(&bookmarks).Error; err != nil {
+			return err
+		}
+
+		if len(bookmarks) > 0 {
+			bookmarkIDs := make([]uint, len(bookmarks))
+			for i := range bookmarks {
+				bookmarkIDs[i] = bookmarks[i].ID
+				imageURLs = appendImageURLs(imageURLs, &bookmarks[i])
+			}
+			if err := tx.Where("id IN ?", bookmarkIDs).Delete(&models.Bookmark{}).Error; err != nil {
+				return err
+			}
+			purged += len(bookmarks)
+		}
+
+		if len(collectionIDs) > 0 {
+			// A filter on a collection that is gone would match nothing ever again
+			if err := tx.Where("collection_id IN ?", collectionIDs).Delete(&models.SmartCollection{}).Error; err != nil {
+				return err
+			}
+			// MySQL checks parent_id as each row goes, so unlink them first
+			if err := tx.Model(&models.Collection{}).Where("parent_id IN ?", collectionIDs).
+				UpdateColumn("parent_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", collectionIDs).Delete(&models.Collection{}).Error; err != nil {
+				return err
+			}
+			purged += len(collectionIDs)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Files cannot be part of the transaction, so they go once the rows are gone
+	removeUnusedImages(ctx, s.db, s.images, imageURLs)
+	return purged, nil
+}
+
+// trashTime is the DeletedAt given to items moved to the trash together. It
+// is stored in UTC at millisecond precision so that every database reads it
+// back unchanged, letting restores match it exactly.
+func trashTime() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// trashedBookmarkColumns moves bookmarks to the trash at deletedAt. Their
+// URL keys are released so that the URLs can be bookmarked again.
+func trashedBookmarkColumns(deletedAt time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"deleted_at": deletedAt,
+		"url_key":    nil,
+	}
+}
+
+// subtreeIDs returns the ID of rootID and of the collections nested in it
+// that keep satisfies, stopping at the first one that does not
+func subtreeIDs(collections []models.Collection, rootID uint, keep func(models.Collection) bool) []uint {
+	children := make(map[uint][]uint)
+	found := false
+	for _, collection := range collections {
+		if collection.ID == rootID {
+			found = true
+		}
+		if collection.ParentID != nil && keep(collection) {
+			children[*collection.ParentID] = append(children[*collection.ParentID], collection.ID)
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	ids := []uint{rootID}
+	seen := map[uint]bool{rootID: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"markly-backend/internal/models"
+	"markly-backend/internal/testdb"
+)
+
+// nextTrashTime waits until trashTime moves on, so that items trashed before
+// and after the call do not share a DeletedAt
+func nextTrashTime() {
+	start := trashTime()
+	for trashTime().Equal(start) {
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+func bookmarkIDs(bookmarks []models.Bookmark) []uint {
+	ids := make([]uint, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		ids[i] = bookmark.ID
+	}
+	return ids
+}
+
+func collectionIDs(collections []models.Collection) []uint {
+	ids := make([]uint, len(collections))
+	for i, collection := range collections {
+		ids[i] = collection.ID
+	}
+	return ids
+}
+
+func equalIDs(got, want []uint) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isLive(t *testing.T, db *gorm.DB, model interface{}, id uint) bool {
+	t.Helper()
+	var count int64
+	if err := db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func trashCollection(t *testing.T, db *gorm.DB, s *TrashService, userID, collectionID uint) int64 {
+	t.Helper()
+	var trashed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		trashed, err = s.TrashCollection(tx, userID, collectionID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trashed
+}
+
+func TestTrashCollectionTakesSubtree(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTrashService(db, nil, time.Hour)
+	ctx := context.Background()
+
+	root := testdb.CreateCollection(t, db, user.ID, "Root", 0)
+	child := testdb.CreateCollection(t, db, user.ID, "Child", root.ID)
+	other := testdb.CreateCollection(t, db, user.ID, "Other", 0)
+	inRoot := testdb.CreateBookmark(t, db, user.ID, root.ID, "https://a.example")
+	inChild := testdb.CreateBookmark(t, db, user.ID, child.ID, "https://b.example")
+	elsewhere := testdb.CreateBookmark(t, db, user.ID, other.ID, "https://c.example")
+
+	if trashed := trashCollection(t, db, s, user.ID, root.ID); trashed != 2 {
+		t.Errorf("TrashCollection trashed %d bookmarks, want 2", trashed)
+	}
+	if isLive(t, db, &models.Collection{}, child.ID) || isLive(t, db, &models.Bookmark{}, inChild.ID) || isLive(t, db, &models.Bookmark{}, inRoot.ID) {
+		t.Error("nested collection or bookmarks left out of the trash")
+	}
+	if !isLive(t, db, &models.Bookmark{}, elsewhere.ID) {
+		t.Error("bookmark of another collection was trashed")
+	}
+
+	// Only the collection itself is listed; the rest comes back with it
+	collections, bookmarks, err := s.List(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(collectionIDs(collections), []uint{root.ID}) || len(bookmarks) != 0 {
+		t.Errorf("List = collections %v, bookmarks %v; want only collection %d",
+			collectionIDs(collections), bookmarkIDs(bookmarks), root.ID)
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := s.TrashCollection(tx, user.ID, root.ID)
+		return err
+	}); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("trashing a trashed collection = %v, want %v", err, ErrCollectionNotFound)
+	}
+}
+
+func TestRestoreCollectionMatchesDeletedAt(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTrashService(db, nil, time.Hour)
+	ctx := context.Background()
+
+	root := testdb.CreateCollection(t, db, user.ID, "Root", 0)
+	child := testdb.CreateCollection(t, db, user.ID, "Child", root.ID)
+	earlierChild := testdb.CreateCollection(t, db, user.ID, "Earlier", root.ID)
+	kept := testdb.CreateBookmark(t, db, user.ID, child.ID, "https://a.example")
+	earlier := testdb.CreateBookmark(t, db, user.ID, root.ID, "https://b.example")
+
+	// Deleted on their own before the collection
+	if ok, err := s.TrashBookmark(ctx, user.ID, earlier.ID); err != nil || !ok {
+		t.Fatalf("TrashBookmark = %v, %v", ok, err)
+	}
+	trashCollection(t, db, s, user.ID, earlierChild.ID)
+	nextTrashTime()
+	trashCollection(t, db, s, user.ID, root.ID)
+
+	collections, bookmarks, err := s.List(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(collectionIDs(collections), []uint{root.ID, earlierChild.ID}) || !equalIDs(bookmarkIDs(bookmarks), []uint{earlier.ID}) {
+		t.Errorf("List = collections %v, bookmarks %v; want collections [%d %d], bookmarks [%d]",
+			collectionIDs(collections), bookmarkIDs(bookmarks), root.ID, earlierChild.ID, earlier.ID)
+	}
+
+	if _, err := s.RestoreBookmark(ctx, user.ID, earlier.ID); !errors.Is(err, ErrCollectionInTrash) {
+		t.Errorf("RestoreBookmark into a trashed collection = %v, want %v", err, ErrCollectionInTrash)
+	}
+	if _, err := s.RestoreCollection(ctx, user.ID, child.ID); !errors.Is(err, ErrParentCollectionTrash) {
+		t.Errorf("RestoreCollection into a trashed parent = %v, want %v", err, ErrParentCollectionTrash)
+	}
+
+	restored, err := s.RestoreCollection(ctx, user.ID, root.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt.Valid {
+		t.Error("restored collection still has DeletedAt")
+	}
+	if !isLive(t, db, &models.Collection{}, child.ID) || !isLive(t, db, &models.Bookmark{}, kept.ID) {
+		t.Error("items trashed with the collection were not restored")
+	}
+	if isLive(t, db, &models.Collection{}, earlierChild.ID) || isLive(t, db, &models.Bookmark{}, earlier.ID) {
+		t.Error("items deleted before the collection were restored with it")
+	}
+
+	if _, err := s.RestoreBookmark(ctx, user.ID, earlier.ID); err != nil {
+		t.Errorf("RestoreBookmark once its collection is back: %v", err)
+	}
+	if _, err := s.RestoreBookmark(ctx, user.ID, earlier.ID); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("restoring a live bookmark = %v, want %v", err, ErrNotInTrash)
+	}
+}
+
+func TestTrashIsPerUser(t *testing.T) {
+	db := testdb.Open(t)
+	alice := testdb.CreateUser(t, db, "alice")
+	bob := testdb.CreateUser(t, db, "bob")
+	s := NewTrashService(db, nil, time.Hour)
+	ctx := context.Background()
+
+	collection := testdb.CreateCollection(t, db, alice.ID, "Root", 0)
+	bookmark := testdb.CreateBookmark(t, db, alice.ID, collection.ID, "https://a.example")
+
+	if ok, err := s.TrashBookmark(ctx, bob.ID, bookmark.ID); err != nil || ok {
+		t.Errorf("TrashBookmark of another user's bookmark = %v, %v", ok, err)
+	}
+	if ok, err := s.TrashBookmark(ctx, alice.ID, bookmark.ID); err != nil || !ok {
+		t.Fatalf("TrashBookmark = %v, %v", ok, err)
+	}
+	if _, err := s.RestoreBookmark(ctx, bob.ID, bookmark.ID); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("RestoreBookmark by another user = %v, want %v", err, ErrNotInTrash)
+	}
+	if err := s.Empty(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RestoreBookmark(ctx, alice.ID, bookmark.ID); err != nil {
+		t.Errorf("another user's Empty purged the bookmark: %v", err)
+	}
+}
+
+func TestPurgeDue(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTrashService(db, nil, time.Hour)
+	ctx := context.Background()
+
+	old := testdb.CreateCollection(t, db, user.ID, "Old", 0)
+	oldChild := testdb.CreateCollection(t, db, user.ID, "Old child", old.ID)
+	recent := testdb.CreateCollection(t, db, user.ID, "Recent", 0)
+	inOld := testdb.CreateBookmark(t, db, user.ID, oldChild.ID, "https://a.example")
+	inRecent := testdb.CreateBookmark(t, db, user.ID, recent.ID, "https://b.example")
+	live := testdb.CreateBookmark(t, db, user.ID, recent.ID, "https://c.example")
+
+	trashCollection(t, db, s, user.ID, old.ID)
+	if ok, err := s.TrashBookmark(ctx, user.ID, inRecent.ID); err != nil || !ok {
+		t.Fatalf("TrashBookmark = %v, %v", ok, err)
+	}
+	longAgo := time.Now().Add(-2 * time.Hour)
+	if err := db.Unscoped().Model(&models.Collection{}).Where("id IN ?", []uint{old.ID, oldChild.ID}).
+		UpdateColumn("deleted_at", longAgo).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unscoped().Model(&models.Bookmark{}).Where("id = ?", inOld.ID).
+		UpdateColumn("deleted_at", longAgo).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := s.PurgeDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 3 {
+		t.Errorf("PurgeDue purged %d items, want 3", purged)
+	}
+
+	var remaining int64
+	db.Unscoped().Model(&models.Bookmark{}).Where("id = ?", inOld.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Error("bookmark in a purged collection survived")
+	}
+	db.Unscoped().Model(&models.Bookmark{}).Where("id IN ?", []uint{inRecent.ID, live.ID}).Count(&remaining)
+	if remaining != 2 {
+		t.Errorf("%d of the recent and live bookmarks survived, want 2", remaining)
+	}
+
+	disabled := NewTrashService(db, nil, 0)
+	if purged, err := disabled.PurgeDue(ctx); err != nil || purged != 0 {
+		t.Errorf("PurgeDue without retention = %d, %v; want nothing purged", purged, err)
+	}
+}
+
+func TestPurgeDeletesSmartCollectionsOnCollection(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, "alice")
+	s := NewTrashService(db, nil, time.Hour)
+	ctx := context.Background()
+
+	doomed := testdb.CreateCollection(t, db, user.ID, "Doomed", 0)
+	kept := testdb.CreateCollection(t, db, user.ID, "Kept", 0)
+	onDoomed := models.SmartCollection{Name: "On doomed", CollectionID: &doomed.ID, UserID: user.ID}
+	onKept := models.SmartCollection{Name: "On kept", CollectionID: &kept.ID, UserID: user.ID}
+	for _, smart := range []*models.SmartCollection{&onDoomed, &onKept} {
+		if err := db.Create(smart).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trashCollection(t, db, s, user.ID, doomed.ID)
+	if _, err := s.RestoreCollection(ctx, user.ID, doomed.ID); err != nil {
+		t.Fatalf("RestoreCollection: %v", err)
+	}
+	var count int64
+	db.Model(&models.SmartCollection{}).Where("id = ?", onDoomed.ID).Count(&count)
+	if count != 1 {
+		t.Fatal("trashing and restoring the collection deleted its smart collection")
+	}
+
+	trashCollection(t, db, s, user.ID, doomed.ID)
+	if err := s.Empty(ctx, user.ID); err != nil {
+		t.Fatalf("Empty: %v", err)
+	}
+	var ids []uint
+	db.Model(&models.SmartCollection{}).Order("id").Pluck("id", &ids)
+	if !equalIDs(ids, []uint{onKept.ID}) {
+		t.Errorf("smart collections after purge = %v, want %v", ids, []uint{onKept.ID})
+	}
+}
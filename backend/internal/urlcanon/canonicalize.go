@@ -0,0 +1,123 @@
+// Package urlcanon reduces bookmark URLs to a canonical form, so that URLs
+// that only differ in ways that do not change the page they lead to compare
+// equal.
+package urlcanon
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrNotAbsolute = errors.New("URL must include a scheme and a host")
+
+// defaultPorts are left out of canonical URLs
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// trackingParams are query parameters added by analytics and ad platforms
+// to follow a link around; they never change the page
+var trackingParams = map[string]bool{
+	"fbclid":      true,
+	"gclid":       true,
+	"dclid":       true,
+	"gbraid":      true,
+	"wbraid":      true,
+	"msclkid":     true,
+	"yclid":       true,
+	"twclid":      true,
+	"igshid":      true,
+	"mc_cid":      true,
+	"mc_eid":      true,
+	"_ga":         true,
+	"_gl":         true,
+	"_hsenc":      true,
+	"_hsmi":       true,
+	"mkt_tok":     true,
+	"oly_anon_id": true,
+	"oly_enc_id":  true,
+	"vero_id":     true,
+	"ref_src":     true,
+}
+
+// trackingPrefixes start the names of families of tracking parameters, such
+// as utm_source and utm_campaign
+var trackingPrefixes = []string{"utm_", "pk_", "mtm_"}
+
+// Canonicalize returns the canonical form of rawURL:
+//
+//   - the scheme and host are lowercased, and the port is dropped when it is
+//     the scheme's default
+//   - tracking parameters are removed and the remaining ones sorted by name
+//   - a trailing slash is removed from the path, and an empty path becomes /
+//   - the fragment is removed, unless it starts with / or ! as the routes of
+//     single-page applications do
+//
+// The result is only meant for comparing URLs; bookmarks keep the URL they
+// were saved with.
+func Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", ErrNotAbsolute
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	path := strings.TrimRight(u.EscapedPath(), "/")
+	if path == "" {
+		path = "/"
+	}
+	u.RawPath = path
+	if u.Path, err = url.PathUnescape(path); err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for name := range query {
+		if isTrackingParam(name) {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	if !strings.HasPrefix(u.Fragment, "/") && !strings.HasPrefix(u.Fragment, "!") {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	return u.String(), nil
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	if trackingParams[name] {
+		return true
+	}
+	for _, prefix := range trackingPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
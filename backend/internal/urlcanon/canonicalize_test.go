@@ -0,0 +1,85 @@
+package urlcanon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"lowercases scheme and host", "HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"drops default http port", "http://example.com:80/a", "http://example.com/a"},
+		{"drops default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"keeps other ports", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"keeps port of other scheme", "http://example.com:443/a", "http://example.com:443/a"},
+		{"empty path becomes slash", "https://example.com", "https://example.com/"},
+		{"trims trailing slash", "https://example.com/a/b/", "https://example.com/a/b"},
+		{"trims repeated trailing slashes", "https://example.com/a//", "https://example.com/a"},
+		{"strips tracking parameters", "https://example.com/a?utm_source=x&utm_Medium=y&fbclid=z&id=1", "https://example.com/a?id=1"},
+		{"strips every tracking parameter", "https://example.com/a?gclid=1&mc_cid=2", "https://example.com/a"},
+		{"sorts query parameters", "https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"drops empty query", "https://example.com/a?", "https://example.com/a"},
+		{"drops fragment", "https://example.com/a#section", "https://example.com/a"},
+		{"keeps route fragment", "https://example.com/#/inbox", "https://example.com/#/inbox"},
+		{"keeps hashbang fragment", "https://example.com/#!/inbox", "https://example.com/#!/inbox"},
+		{"trims whitespace", "  https://example.com/a  ", "https://example.com/a"},
+		{"drops trailing dot of host", "https://example.com./a", "https://example.com/a"},
+		{"keeps escaped path", "https://example.com/a%2Fb", "https://example.com/a%2Fb"},
+		{"brackets IPv6 host", "http://[::1]:80/a", "http://[::1]/a"},
+		{"keeps IPv6 port", "http://[::1]:8080/a", "http://[::1]:8080/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize(tt.in)
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) returned error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeEquivalentURLs(t *testing.T) {
+	urls := []string{
+		"https://Example.com/page/?b=2&a=1",
+		"https://example.com:443/page?a=1&b=2&utm_campaign=spring",
+		"https://example.com/page?a=1&b=2#comments",
+	}
+	want, err := Canonicalize(urls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range urls[1:] {
+		if got, err := Canonicalize(u); err != nil || got != want {
+			t.Errorf("Canonicalize(%q) = %q, %v; want %q", u, got, err, want)
+		}
+	}
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr error
+	}{
+		{"example.com/a", ErrNotAbsolute},
+		{"/relative/path", ErrNotAbsolute},
+		{"https:///no-host", ErrNotAbsolute},
+		{"https://example.com/%zz", nil},
+	}
+	for _, tt := range tests {
+		_, err := Canonicalize(tt.in)
+		if err == nil {
+			t.Errorf("Canonicalize(%q) returned no error", tt.in)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("Canonicalize(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+		}
+	}
+}
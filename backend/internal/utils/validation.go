@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"errors"
 	"html"
 	"regexp"
 	"strings"
@@ -237,6 +236,15 @@ func ValidateColor(color string) error {
 	return nil
 }
 
+// ValidateSearch validates a saved search query
+func ValidateSearch(search string) error {
+	if utf8.RuneCountInString(search) > 500 {
+		return ValidationError{Field: "search", Message: "Search is too long"}
+	}
+	
+	return nil
+}
+
 // SanitizeString sanitizes string input to prevent XSS
 func SanitizeString(input string) string {
 	// HTML escape the input
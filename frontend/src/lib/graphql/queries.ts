@@ -100,7 +100,9 @@ export const UPDATE_COLLECTION_MUTATION = gql`
 
 export const DELETE_COLLECTION_MUTATION = gql`
   mutation DeleteCollection($id: ID!) {
-    deleteCollection(id: $id)
+    deleteCollection(id: $id) {
+      bookmarksDeleted
+    }
   }
 `;
 